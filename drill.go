@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/drill"
+	"github.com/jorgepascosoto/auto-db-backups/internal/notify"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+func runDrillCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("drill", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Name of a specific database to drill (drills all if not specified)")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	databases := cfg.Databases
+	if *databaseName != "" {
+		db, err := findDatabase(cfg, *databaseName)
+		if err != nil {
+			return err
+		}
+		databases = []config.DatabaseConfig{*db}
+	}
+
+	var failures int
+	for i := range databases {
+		db := &databases[i]
+
+		summary := drillDatabase(ctx, cfg, db)
+		if summary.Success {
+			log.Printf("Drill passed for %s in %s", db.Name, summary.Duration.Round(time.Second))
+		} else {
+			log.Printf("Drill failed for %s: %v", db.Name, summary.Error)
+			failures++
+		}
+
+		if err := sendCheckNotifications(ctx, cfg.ForDatabase(db), summary); err != nil {
+			log.Printf("Warning: failed to send notifications: %v", err)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("drill failed for %d of %d database(s)", failures, len(databases))
+	}
+
+	return nil
+}
+
+// drillDatabase restores the latest backup of db into a scratch database and
+// runs its sanity checks
+func drillDatabase(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig) *notify.CheckSummary {
+	cfg = cfg.ForDatabase(db)
+	startTime := time.Now()
+	summary := &notify.CheckSummary{
+		Kind:         "drill",
+		DatabaseType: string(db.Type),
+		DatabaseName: db.Name,
+	}
+	defer func() {
+		summary.Duration = time.Since(startTime)
+	}()
+
+	admin, ok := cfg.DrillTargets[db.Type]
+	if !ok {
+		summary.Error = fmt.Errorf("no drill target configured for %s databases (set DRILL_%s_URL)", db.Type, strings.ToUpper(string(db.Type)))
+		return summary
+	}
+
+	server, err := drill.NewScratchServer(admin)
+	if err != nil {
+		summary.Error = err
+		return summary
+	}
+
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	if err != nil {
+		summary.Error = fmt.Errorf("failed to create storage client: %w", err)
+		return summary
+	}
+
+	key, err := latestBackupKey(ctx, backend, db)
+	if err != nil {
+		summary.Error = err
+		return summary
+	}
+	summary.BackupKey = key
+
+	log.Printf("Drilling %s...", key)
+	result, err := drill.Run(ctx, backend, key, db, server, cfg.DrillChecks[db.Name], cfg.DecryptionKeys())
+	summary.Checks = checkResults(result.Checks)
+
+	summary.Success = err == nil
+	summary.Error = err
+	return summary
+}
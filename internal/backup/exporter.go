@@ -1,18 +1,48 @@
 package backup
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"os/exec"
+	"strings"
 )
 
 type Exporter interface {
 	Export(ctx context.Context) (io.ReadCloser, error)
+	// ToolVersion returns the version line of the dump tool, e.g.
+	// "pg_dump (PostgreSQL) 17.2"
+	ToolVersion(ctx context.Context) (string, error)
 	DatabaseName() string
 	DatabaseType() string
 }
 
+// CompressionNegotiator is implemented by exporters whose dump tool can
+// compress its own output. NegotiateCompression is called before Export
+// with the algorithm the pipeline will compress with ("none" if it won't);
+// the exporter configures its tool so the dump isn't compressed twice and
+// returns the compression the dump itself carries, or "" if it has none.
+type CompressionNegotiator interface {
+	NegotiateCompression(pipeline string) string
+}
+
 type ExportResult struct {
 	Reader       io.ReadCloser
 	DatabaseName string
 	DatabaseType string
 }
+
+// toolVersion runs `tool --version` and returns the first line of its output
+func toolVersion(ctx context.Context, tool string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, tool, "--version")
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", tool, err)
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	return strings.TrimSpace(line), nil
+}
@@ -18,3 +18,18 @@ func NewExporter(db *config.DatabaseConfig) (Exporter, error) {
 		return nil, fmt.Errorf("unsupported database type: %s", db.Type)
 	}
 }
+
+// RequiredTools returns the programs backing up a database of type dbType
+// runs, which must be on PATH
+func RequiredTools(dbType config.DatabaseType) []string {
+	switch dbType {
+	case config.DatabaseTypePostgres:
+		return []string{"pg_dump"}
+	case config.DatabaseTypeMySQL:
+		return []string{"mysqldump"}
+	case config.DatabaseTypeMongoDB:
+		return []string{"mongodump", "tar"}
+	default:
+		return nil
+	}
+}
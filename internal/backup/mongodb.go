@@ -69,6 +69,10 @@ func (e *MongoDBExporter) Export(ctx context.Context) (io.ReadCloser, error) {
 	}, nil
 }
 
+func (e *MongoDBExporter) ToolVersion(ctx context.Context) (string, error) {
+	return toolVersion(ctx, "mongodump")
+}
+
 func (e *MongoDBExporter) DatabaseName() string {
 	return e.db.Name
 }
@@ -46,6 +46,10 @@ func (e *MySQLExporter) Export(ctx context.Context) (io.ReadCloser, error) {
 	}, nil
 }
 
+func (e *MySQLExporter) ToolVersion(ctx context.Context) (string, error) {
+	return toolVersion(ctx, "mysqldump")
+}
+
 func (e *MySQLExporter) DatabaseName() string {
 	return e.db.Name
 }
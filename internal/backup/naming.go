@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+)
+
+// TimestampFormat is the layout of the UTC timestamp embedded in backup names
+const TimestampFormat = "20060102-150405"
+
+// Filename returns the name for a backup of db taken at t, before any
+// compression or encryption extension is appended:
+// <type>-<name>-<timestamp>.<ext>
+func Filename(db *config.DatabaseConfig, t time.Time) string {
+	return FilenamePrefix(db) + t.UTC().Format(TimestampFormat) + DumpExtension(db.Type)
+}
+
+// FilenamePrefix returns the part of the backup name shared by every backup
+// of db
+func FilenamePrefix(db *config.DatabaseConfig) string {
+	return fmt.Sprintf("%s-%s-", db.Type, db.Name)
+}
+
+// DumpExtension returns the extension of the raw dump format for a type
+func DumpExtension(dbType config.DatabaseType) string {
+	switch dbType {
+	case config.DatabaseTypePostgres:
+		return ".dump"
+	case config.DatabaseTypeMySQL:
+		return ".sql"
+	case config.DatabaseTypeMongoDB:
+		return ".tar"
+	default:
+		return ""
+	}
+}
+
+// BackupInfo describes a backup, as recovered from its object key
+type BackupInfo struct {
+	Key          string
+	DatabaseType config.DatabaseType
+	DatabaseName string
+	Timestamp    time.Time
+	Compression  string // "gzip" or "zstd", or "" if uncompressed
+	Encrypted    bool
+}
+
+// ParseKey recovers the details encoded in a backup's name by Filename and
+// the compression and encryption stages. Keys that don't follow the naming
+// convention return an error.
+func ParseKey(key string) (*BackupInfo, error) {
+	info := &BackupInfo{Key: key}
+	name := path.Base(key)
+
+	if algorithm, ext := encrypt.ByExtension(name); algorithm != "" {
+		info.Encrypted = true
+		name = strings.TrimSuffix(name, ext)
+	}
+	if algorithm, ext := compress.ByExtension(name); algorithm != "" {
+		info.Compression = algorithm
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	typeName, rest, ok := strings.Cut(name, "-")
+	if !ok {
+		return nil, fmt.Errorf("not a backup name: %s", key)
+	}
+	info.DatabaseType = config.DatabaseType(typeName)
+
+	ext := DumpExtension(info.DatabaseType)
+	if ext == "" || !strings.HasSuffix(rest, ext) {
+		return nil, fmt.Errorf("not a backup name: %s", key)
+	}
+	rest = strings.TrimSuffix(rest, ext)
+
+	// <name>-<timestamp>, where the name itself may contain dashes
+	if len(rest) < len(TimestampFormat)+2 || rest[len(rest)-len(TimestampFormat)-1] != '-' {
+		return nil, fmt.Errorf("not a backup name: %s", key)
+	}
+	timestamp, err := time.Parse(TimestampFormat, rest[len(rest)-len(TimestampFormat):])
+	if err != nil {
+		return nil, fmt.Errorf("not a backup name: %s", key)
+	}
+	info.Timestamp = timestamp
+	info.DatabaseName = rest[:len(rest)-len(TimestampFormat)-1]
+
+	return info, nil
+}
+
+// IsBackupOf reports whether the key names a backup of db
+func (i *BackupInfo) IsBackupOf(db *config.DatabaseConfig) bool {
+	return i.DatabaseType == db.Type && i.DatabaseName == db.Name
+}
@@ -7,12 +7,17 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
 	"github.com/jorgepascosoto/auto-db-backups/internal/config"
 	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
 )
 
 type PostgresExporter struct {
 	db *config.DatabaseConfig
+
+	// compress is passed to pg_dump's --compress when set; by default the
+	// custom format is gzip-compressed by pg_dump itself
+	compress string
 }
 
 func NewPostgresExporter(db *config.DatabaseConfig) *PostgresExporter {
@@ -48,6 +53,22 @@ func (e *PostgresExporter) Export(ctx context.Context) (io.ReadCloser, error) {
 	}, nil
 }
 
+func (e *PostgresExporter) ToolVersion(ctx context.Context) (string, error) {
+	return toolVersion(ctx, "pg_dump")
+}
+
+// NegotiateCompression turns off pg_dump's own compression when the
+// pipeline compresses the dump anyway: compressing the custom format twice
+// costs CPU for almost no gain, and the pipeline's compressor is faster
+func (e *PostgresExporter) NegotiateCompression(pipeline string) string {
+	if pipeline == compress.NoneName {
+		e.compress = ""
+		return compress.GzipName
+	}
+	e.compress = "0"
+	return ""
+}
+
 func (e *PostgresExporter) DatabaseName() string {
 	return e.db.Name
 }
@@ -57,18 +78,22 @@ func (e *PostgresExporter) DatabaseType() string {
 }
 
 func (e *PostgresExporter) buildArgs() []string {
+	format := []string{"--format=custom"}
+	if e.compress != "" {
+		format = append(format, fmt.Sprintf("--compress=%s", e.compress))
+	}
+
 	// If connection string is provided, use it directly
 	if e.db.ConnectionString != "" {
-		return []string{e.db.ConnectionString, "--format=custom"}
+		return append([]string{e.db.ConnectionString}, format...)
 	}
 
-	args := []string{
-		"--format=custom",
+	args := append(format,
 		"--no-password",
 		fmt.Sprintf("--host=%s", e.db.Host),
 		fmt.Sprintf("--port=%d", e.db.Port),
 		fmt.Sprintf("--dbname=%s", e.db.Name),
-	}
+	)
 
 	if e.db.User != "" {
 		args = append(args, fmt.Sprintf("--username=%s", e.db.User))
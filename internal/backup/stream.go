@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ExitStatusReader wraps an export's output so that the dump command's exit
+// status is reported as a read error at EOF. Downstream consumers (compression,
+// encryption, the multipart uploader) then see a failed dump as a failed read
+// instead of a clean end of stream.
+type ExitStatusReader struct {
+	rc io.ReadCloser
+
+	once     sync.Once
+	closeErr error
+
+	mu      sync.Mutex
+	exitErr error
+}
+
+func NewExitStatusReader(rc io.ReadCloser) *ExitStatusReader {
+	return &ExitStatusReader{rc: rc}
+}
+
+func (r *ExitStatusReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if err == io.EOF {
+		// The exit status is only available once all output has been read
+		if closeErr := r.Close(); closeErr != nil {
+			r.mu.Lock()
+			r.exitErr = closeErr
+			r.mu.Unlock()
+			return n, closeErr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying reader once and returns its result on every call.
+func (r *ExitStatusReader) Close() error {
+	r.once.Do(func() {
+		r.closeErr = r.rc.Close()
+	})
+	return r.closeErr
+}
+
+// ExitErr returns the error reported by the dump command after its output was
+// read to completion, or nil if it succeeded or hasn't finished yet.
+func (r *ExitStatusReader) ExitErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exitErr
+}
+
+// CountingReader counts the bytes read through it.
+type CountingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read so far.
+func (c *CountingReader) Count() int64 {
+	return c.n.Load()
+}
@@ -0,0 +1,100 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Compressor compresses backup streams and reverses it on restore
+type Compressor interface {
+	// Compress returns a reader yielding the compressed contents of r
+	Compress(r io.Reader) io.ReadCloser
+	// Decompress returns a reader yielding the original contents of r
+	Decompress(r io.Reader) (io.ReadCloser, error)
+	// Extension is appended to backup names, e.g. ".gz"; empty for none
+	Extension() string
+	// Name names the algorithm in COMPRESSION, manifests and listings
+	Name() string
+}
+
+// NoneName disables compression
+const NoneName = "none"
+
+// New returns the compressor for the named algorithm. A level of 0 selects
+// the algorithm's default.
+func New(name string, level int) (Compressor, error) {
+	switch name {
+	case GzipName:
+		if level == 0 {
+			return NewGzipCompressor(), nil
+		}
+		return NewGzipCompressorLevel(level)
+	case ZstdName:
+		if level == 0 {
+			return NewZstdCompressor(), nil
+		}
+		return NewZstdCompressorLevel(level)
+	case NoneName, "":
+		if level != 0 {
+			return nil, fmt.Errorf("compression %q takes no level", NoneName)
+		}
+		return NoneCompressor{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q (expected %s, %s or %s)", name, GzipName, ZstdName, NoneName)
+	}
+}
+
+// ParseSpec parses an "algorithm[:level]" setting such as "zstd:6". The
+// level is 0 when not given.
+func ParseSpec(spec string) (name string, level int, err error) {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	if !hasLevel {
+		return name, 0, nil
+	}
+	level, err = strconv.Atoi(levelStr)
+	if err != nil || level < 1 {
+		return "", 0, fmt.Errorf("invalid compression level %q", levelStr)
+	}
+	return name, level, nil
+}
+
+// ByExtension returns the name of the algorithm whose extension name ends
+// with, and the extension itself. Both are empty if none matches.
+func ByExtension(name string) (algorithm, extension string) {
+	switch {
+	case strings.HasSuffix(name, GzipExtension):
+		return GzipName, GzipExtension
+	case strings.HasSuffix(name, ZstdExtension):
+		return ZstdName, ZstdExtension
+	default:
+		return "", ""
+	}
+}
+
+// Magic bytes at the start of each compressed format
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Detect identifies the compression of a stream by its magic bytes. It
+// returns the algorithm's name, or an empty string if the stream isn't
+// compressed in a known format, and a reader that still yields the whole
+// stream. Read errors are left for the returned reader to report.
+func Detect(r io.Reader) (string, io.Reader) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return GzipName, br
+	case bytes.HasPrefix(head, zstdMagic):
+		return ZstdName, br
+	default:
+		return "", br
+	}
+}
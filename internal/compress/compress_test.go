@@ -0,0 +1,133 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		level     int
+		extension string
+		errorMsg  string
+	}{
+		{"gzip", 0, ".gz", ""},
+		{"gzip", 6, ".gz", ""},
+		{"zstd", 0, ".zst", ""},
+		{"zstd", 19, ".zst", ""},
+		{"none", 0, "", ""},
+		{"gzip", 10, "", "invalid gzip compression level"},
+		{"zstd", 23, "", "invalid zstd compression level"},
+		{"none", 1, "", "takes no level"},
+		{"lz4", 0, "", "unsupported compression algorithm"},
+	}
+
+	for _, tt := range tests {
+		compressor, err := New(tt.name, tt.level)
+		if tt.errorMsg != "" {
+			require.Error(t, err, tt.name)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.name, compressor.Name())
+		assert.Equal(t, tt.extension, compressor.Extension())
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	t.Parallel()
+
+	name, level, err := ParseSpec("zstd:6")
+	require.NoError(t, err)
+	assert.Equal(t, "zstd", name)
+	assert.Equal(t, 6, level)
+
+	name, level, err = ParseSpec(" GZIP ")
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", name)
+	assert.Equal(t, 0, level)
+
+	for _, spec := range []string{"zstd:", "zstd:fast", "zstd:0", "gzip:-1"} {
+		_, _, err := ParseSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestByExtension(t *testing.T) {
+	t.Parallel()
+
+	algorithm, ext := ByExtension("postgres-app-20240115-140532.dump.gz")
+	assert.Equal(t, "gzip", algorithm)
+	assert.Equal(t, ".gz", ext)
+
+	algorithm, ext = ByExtension("postgres-app-20240115-140532.dump.zst")
+	assert.Equal(t, "zstd", algorithm)
+	assert.Equal(t, ".zst", ext)
+
+	algorithm, ext = ByExtension("postgres-app-20240115-140532.dump")
+	assert.Empty(t, algorithm)
+	assert.Empty(t, ext)
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	original := strings.Repeat("PGDMP raw dump contents ", 100)
+	gzipped, err := io.ReadAll(NewGzipCompressor().Compress(strings.NewReader(original)))
+	require.NoError(t, err)
+	zstded, err := io.ReadAll(NewZstdCompressor().Compress(strings.NewReader(original)))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"gzip", gzipped, "gzip"},
+		{"zstd", zstded, "zstd"},
+		{"plain", []byte(original), ""},
+		{"short", []byte{0x1f}, ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		algorithm, r := Detect(bytes.NewReader(tt.data))
+		assert.Equal(t, tt.expected, algorithm, tt.name)
+
+		// The peeked bytes are still read
+		data, err := io.ReadAll(r)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, len(tt.data), len(data), tt.name)
+	}
+}
+
+func TestNoneCompressor(t *testing.T) {
+	t.Parallel()
+
+	data, err := io.ReadAll(NoneCompressor{}.Compress(strings.NewReader("raw")))
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(data))
+
+	decompressed, err := NoneCompressor{}.Decompress(strings.NewReader("raw"))
+	require.NoError(t, err)
+	data, err = io.ReadAll(decompressed)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(data))
+}
+
+func TestCompressor_InterfaceCompliance(t *testing.T) {
+	t.Parallel()
+
+	var _ Compressor = (*GzipCompressor)(nil)
+	var _ Compressor = (*ZstdCompressor)(nil)
+	var _ Compressor = NoneCompressor{}
+}
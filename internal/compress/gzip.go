@@ -2,20 +2,48 @@ package compress
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
 )
 
+const (
+	// GzipExtension is appended to the names of gzip-compressed backups
+	GzipExtension = ".gz"
+
+	// GzipName names the algorithm in backup manifests and listings
+	GzipName = "gzip"
+)
+
 type GzipCompressor struct {
 	level int
+
+	// Parallel mode, used when workers > 1
+	workers   int
+	blockSize int
 }
 
 func NewGzipCompressor() *GzipCompressor {
 	return &GzipCompressor{level: gzip.BestCompression}
 }
 
+// NewGzipCompressorLevel returns a compressor using one of gzip's levels 1-9
+func NewGzipCompressorLevel(level int) (*GzipCompressor, error) {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid gzip compression level %d (expected %d-%d)", level, gzip.BestSpeed, gzip.BestCompression)
+	}
+	return &GzipCompressor{level: level}, nil
+}
+
 func (c *GzipCompressor) Compress(r io.Reader) io.ReadCloser {
 	pr, pw := io.Pipe()
 
+	if c.workers > 1 {
+		go func() {
+			pw.CloseWithError(c.compressParallel(r, pw))
+		}()
+		return pr
+	}
+
 	go func() {
 		gw, err := gzip.NewWriterLevel(pw, c.level)
 		if err != nil {
@@ -42,5 +70,18 @@ func (c *GzipCompressor) Compress(r io.Reader) io.ReadCloser {
 }
 
 func (c *GzipCompressor) Extension() string {
-	return ".gz"
+	return GzipExtension
+}
+
+func (c *GzipCompressor) Name() string {
+	return GzipName
+}
+
+// Decompress decompresses data compressed with Compress
+func (c *GzipCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gzip header: %w", err)
+	}
+	return gr, nil
 }
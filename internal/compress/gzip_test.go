@@ -25,6 +25,7 @@ func TestGzipCompressor_Extension(t *testing.T) {
 
 	compressor := NewGzipCompressor()
 	assert.Equal(t, ".gz", compressor.Extension())
+	assert.Equal(t, "gzip", compressor.Name())
 }
 
 func TestGzipCompressor_CompressDecompress_SmallData(t *testing.T) {
@@ -326,3 +327,30 @@ func BenchmarkGzipCompressor_LargeData(b *testing.B) {
 		reader.Close()
 	}
 }
+
+func TestGzipCompressor_Decompress(t *testing.T) {
+	t.Parallel()
+
+	compressor := NewGzipCompressor()
+	originalData := []byte(strings.Repeat("round trip through Decompress ", 1000))
+
+	compressed, err := io.ReadAll(compressor.Compress(bytes.NewReader(originalData)))
+	require.NoError(t, err)
+
+	decompressedReader, err := compressor.Decompress(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	defer decompressedReader.Close()
+
+	decompressed, err := io.ReadAll(decompressedReader)
+	require.NoError(t, err)
+	assert.Equal(t, originalData, decompressed)
+}
+
+func TestGzipCompressor_Decompress_InvalidData(t *testing.T) {
+	t.Parallel()
+
+	compressor := NewGzipCompressor()
+
+	_, err := compressor.Decompress(strings.NewReader("not gzip data"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package compress
+
+import "io"
+
+// NoneCompressor passes backups through unchanged
+type NoneCompressor struct{}
+
+func (NoneCompressor) Compress(r io.Reader) io.ReadCloser {
+	return io.NopCloser(r)
+}
+
+func (NoneCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+func (NoneCompressor) Extension() string {
+	return ""
+}
+
+func (NoneCompressor) Name() string {
+	return NoneName
+}
@@ -0,0 +1,157 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultGzipBlockSize is the amount of input each worker compresses
+	// at a time in parallel mode
+	DefaultGzipBlockSize = 1 << 20
+
+	// MinGzipBlockSize keeps blocks at least as large as deflate's window,
+	// below which the ratio suffers noticeably
+	MinGzipBlockSize = 32 << 10
+)
+
+// NewParallelGzipCompressor returns a compressor that splits its input into
+// blocks of blockSize bytes and compresses them on workers goroutines, like
+// pigz. Each block becomes an independent gzip member; gzip readers,
+// including gunzip and Decompress, read the concatenation as one stream.
+// A level of 0 selects the default level.
+func NewParallelGzipCompressor(level, workers, blockSize int) (*GzipCompressor, error) {
+	c := NewGzipCompressor()
+	if level != 0 {
+		var err error
+		if c, err = NewGzipCompressorLevel(level); err != nil {
+			return nil, err
+		}
+	}
+
+	if workers < 1 {
+		return nil, fmt.Errorf("invalid gzip worker count %d", workers)
+	}
+	if blockSize < MinGzipBlockSize {
+		return nil, fmt.Errorf("invalid gzip block size %d (minimum %d)", blockSize, MinGzipBlockSize)
+	}
+
+	c.workers = workers
+	c.blockSize = blockSize
+	return c, nil
+}
+
+// gzipBlock is one block of input on its way through a worker
+type gzipBlock struct {
+	data []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// compressParallel writes r to w as a series of gzip members. Blocks are
+// written in input order; at most 2*workers blocks are held in memory.
+func (c *GzipCompressor) compressParallel(r io.Reader, w io.Writer) error {
+	jobs := make(chan *gzipBlock)
+	// The queue preserves input order while workers finish out of order
+	queue := make(chan *gzipBlock, c.workers)
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var gw *gzip.Writer
+			for b := range jobs {
+				if gw == nil {
+					gw, b.err = gzip.NewWriterLevel(&b.out, c.level)
+				} else {
+					gw.Reset(&b.out)
+				}
+				if b.err == nil {
+					if _, b.err = gw.Write(b.data); b.err == nil {
+						b.err = gw.Close()
+					}
+				}
+				b.data = nil
+				close(b.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		for {
+			select {
+			case <-stop:
+				readErr <- nil
+				return
+			default:
+			}
+
+			data := make([]byte, c.blockSize)
+			n, err := io.ReadFull(r, data)
+			if n > 0 {
+				b := &gzipBlock{data: data[:n], done: make(chan struct{})}
+				select {
+				case queue <- b:
+				case <-stop:
+					readErr <- nil
+					return
+				}
+				jobs <- b
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				readErr <- nil
+				return
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	var wrote bool
+	for b := range queue {
+		<-b.done
+		if firstErr != nil {
+			continue
+		}
+		err := b.err
+		if err == nil {
+			_, err = w.Write(b.out.Bytes())
+			wrote = true
+		}
+		if err != nil {
+			firstErr = err
+			close(stop)
+		}
+	}
+	wg.Wait()
+
+	if err := <-readErr; err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// An empty input still has to be a valid gzip stream
+	if !wrote {
+		gw, err := gzip.NewWriterLevel(w, c.level)
+		if err != nil {
+			return err
+		}
+		return gw.Close()
+	}
+
+	return nil
+}
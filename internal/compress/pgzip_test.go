@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewParallelGzipCompressor(t *testing.T) {
+	t.Parallel()
+
+	compressor, err := NewParallelGzipCompressor(0, 4, DefaultGzipBlockSize)
+	require.NoError(t, err)
+	assert.Equal(t, gzip.BestCompression, compressor.level)
+	assert.Equal(t, 4, compressor.workers)
+	assert.Equal(t, ".gz", compressor.Extension())
+	assert.Equal(t, "gzip", compressor.Name())
+
+	_, err = NewParallelGzipCompressor(10, 4, DefaultGzipBlockSize)
+	assert.Error(t, err)
+	_, err = NewParallelGzipCompressor(0, 0, DefaultGzipBlockSize)
+	assert.Error(t, err)
+	_, err = NewParallelGzipCompressor(0, 4, MinGzipBlockSize-1)
+	assert.Error(t, err)
+}
+
+func TestParallelGzip_CompressDecompress(t *testing.T) {
+	t.Parallel()
+
+	random := make([]byte, 300*1024)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	inputs := map[string][]byte{
+		"empty":              {},
+		"smaller than block": []byte("Hello, World!"),
+		"exact blocks":       bytes.Repeat([]byte("abcdefgh"), 2*MinGzipBlockSize/8),
+		"many blocks":        []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20000)),
+		"random":             random,
+	}
+
+	compressor, err := NewParallelGzipCompressor(6, 4, MinGzipBlockSize)
+	require.NoError(t, err)
+
+	for name, original := range inputs {
+		compressed, err := io.ReadAll(compressor.Compress(bytes.NewReader(original)))
+		require.NoError(t, err, name)
+
+		// Decompress reads every member
+		decompressed, err := compressor.Decompress(bytes.NewReader(compressed))
+		require.NoError(t, err, name)
+		data, err := io.ReadAll(decompressed)
+		require.NoError(t, err, name)
+		assert.Equal(t, original, data, name)
+	}
+}
+
+func TestParallelGzip_WritesOneMemberPerBlock(t *testing.T) {
+	t.Parallel()
+
+	compressor, err := NewParallelGzipCompressor(1, 3, MinGzipBlockSize)
+	require.NoError(t, err)
+
+	original := bytes.Repeat([]byte("x"), 5*MinGzipBlockSize+1)
+	compressed, err := io.ReadAll(compressor.Compress(bytes.NewReader(original)))
+	require.NoError(t, err)
+
+	// A bufio.Reader keeps gzip from reading past the end of each member
+	br := bufio.NewReader(bytes.NewReader(compressed))
+	gr, err := gzip.NewReader(br)
+	require.NoError(t, err)
+
+	var members, total int
+	for {
+		gr.Multistream(false)
+		n, err := io.Copy(io.Discard, gr)
+		require.NoError(t, err)
+		members++
+		total += int(n)
+
+		if err := gr.Reset(br); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	assert.Equal(t, 6, members)
+	assert.Equal(t, len(original), total)
+}
+
+func TestParallelGzip_ReadErrorPropagates(t *testing.T) {
+	t.Parallel()
+
+	compressor, err := NewParallelGzipCompressor(1, 2, MinGzipBlockSize)
+	require.NoError(t, err)
+
+	input := io.MultiReader(bytes.NewReader(make([]byte, 3*MinGzipBlockSize)), iotest.ErrReader(errors.New("dump failed")))
+	_, err = io.ReadAll(compressor.Compress(input))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dump failed")
+}
+
+func TestParallelGzip_CloseStopsCompression(t *testing.T) {
+	t.Parallel()
+
+	compressor, err := NewParallelGzipCompressor(1, 2, MinGzipBlockSize)
+	require.NoError(t, err)
+
+	// Endless input: closing the reader must stop the workers rather than
+	// compress forever
+	reader := compressor.Compress(&zeroReader{})
+	buf := make([]byte, 1024)
+	_, err = io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+}
+
+// zeroReader yields zeros forever
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,86 @@
+package compress
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ZstdExtension is appended to the names of zstd-compressed backups
+	ZstdExtension = ".zst"
+
+	// ZstdName names the algorithm in backup manifests and listings
+	ZstdName = "zstd"
+
+	// zstdDefaultLevel matches the zstd command line tool
+	zstdDefaultLevel = 3
+)
+
+type ZstdCompressor struct {
+	level int
+}
+
+func NewZstdCompressor() *ZstdCompressor {
+	return &ZstdCompressor{level: zstdDefaultLevel}
+}
+
+// NewZstdCompressorLevel returns a compressor using one of zstd's levels
+// 1-22. The encoder supports fewer speeds than that, so nearby levels share
+// the same speed.
+func NewZstdCompressorLevel(level int) (*ZstdCompressor, error) {
+	if level < 1 || level > 22 {
+		return nil, fmt.Errorf("invalid zstd compression level %d (expected 1-22)", level)
+	}
+	return &ZstdCompressor{level: level}, nil
+}
+
+func (c *ZstdCompressor) Compress(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		// Write a frame even for an empty dump so the output is always
+		// recognizable as zstd
+		zw, err := zstd.NewWriter(pw,
+			zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.level)),
+			zstd.WithZeroFrames(true))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		_, err = io.Copy(zw, r)
+		if err != nil {
+			zw.Close()
+			pw.CloseWithError(err)
+			return
+		}
+
+		if err := zw.Close(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.Close()
+	}()
+
+	return pr
+}
+
+func (c *ZstdCompressor) Extension() string {
+	return ZstdExtension
+}
+
+func (c *ZstdCompressor) Name() string {
+	return ZstdName
+}
+
+// Decompress decompresses data compressed with Compress
+func (c *ZstdCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+	}
+	return zr.IOReadCloser(), nil
+}
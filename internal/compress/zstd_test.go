@@ -0,0 +1,93 @@
+package compress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewZstdCompressor(t *testing.T) {
+	t.Parallel()
+
+	compressor := NewZstdCompressor()
+	require.NotNil(t, compressor)
+	assert.Equal(t, zstdDefaultLevel, compressor.level)
+	assert.Equal(t, ".zst", compressor.Extension())
+	assert.Equal(t, "zstd", compressor.Name())
+}
+
+func TestNewZstdCompressorLevel(t *testing.T) {
+	t.Parallel()
+
+	for _, level := range []int{1, 6, 19, 22} {
+		compressor, err := NewZstdCompressorLevel(level)
+		require.NoError(t, err)
+		assert.Equal(t, level, compressor.level)
+	}
+
+	for _, level := range []int{-1, 0, 23} {
+		_, err := NewZstdCompressorLevel(level)
+		assert.Error(t, err, level)
+	}
+}
+
+func TestZstdCompressor_CompressDecompress(t *testing.T) {
+	t.Parallel()
+
+	random := make([]byte, 256*1024)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	inputs := map[string][]byte{
+		"empty":  {},
+		"text":   []byte(strings.Repeat("Hello, World! ", 10000)),
+		"random": random,
+	}
+
+	for name, original := range inputs {
+		for _, level := range []int{1, 3, 19} {
+			compressor, err := NewZstdCompressorLevel(level)
+			require.NoError(t, err)
+
+			compressed, err := io.ReadAll(compressor.Compress(bytes.NewReader(original)))
+			require.NoError(t, err, name)
+			assert.True(t, bytes.HasPrefix(compressed, zstdMagic), name)
+
+			decompressed, err := compressor.Decompress(bytes.NewReader(compressed))
+			require.NoError(t, err, name)
+			data, err := io.ReadAll(decompressed)
+			require.NoError(t, err, name)
+			require.NoError(t, decompressed.Close())
+			assert.Equal(t, original, data, name)
+		}
+	}
+}
+
+func TestZstdCompressor_CompressReadError(t *testing.T) {
+	t.Parallel()
+
+	reader := NewZstdCompressor().Compress(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("disk error"))))
+	_, err := io.ReadAll(reader)
+	assert.Error(t, err)
+}
+
+func TestZstdCompressor_DecompressCorrupt(t *testing.T) {
+	t.Parallel()
+
+	compressed, err := io.ReadAll(NewZstdCompressor().Compress(strings.NewReader(strings.Repeat("data", 1000))))
+	require.NoError(t, err)
+	compressed = compressed[:len(compressed)/2]
+
+	decompressed, err := NewZstdCompressor().Decompress(bytes.NewReader(compressed))
+	if err == nil {
+		_, err = io.ReadAll(decompressed)
+	}
+	assert.Error(t, err)
+}
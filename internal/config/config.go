@@ -3,11 +3,20 @@ package config
 import (
 	"encoding/base64"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io"
+	"log"
 	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
 )
 
 type DatabaseType string
@@ -18,12 +27,59 @@ const (
 	DatabaseTypeMongoDB  DatabaseType = "mongodb"
 )
 
+// StorageBackendType selects where backups are stored
+type StorageBackendType string
+
+const (
+	StorageBackendR2    StorageBackendType = "r2"
+	StorageBackendS3    StorageBackendType = "s3"
+	StorageBackendLocal StorageBackendType = "local"
+)
+
+// ReplicaPolicy decides whether a backup that reached only some of its
+// destinations counts as a failure
+type ReplicaPolicy string
+
+const (
+	ReplicaPolicyAll     ReplicaPolicy = "all"     // every destination must succeed
+	ReplicaPolicyPrimary ReplicaPolicy = "primary" // replica failures are only warnings
+)
+
+// RetentionKeepAll as a GFS retention count keeps the newest backup of
+// every period, e.g. RETENTION_YEARLY=-1 keeps yearlies forever
+const RetentionKeepAll = -1
+
 // DatabaseJSONEntry represents a single database in the DATABASES_JSON array
+// or the config file's databases list
 type DatabaseJSONEntry struct {
-	Connection string `json:"connection"`
-	Name       string `json:"name,omitempty"`
-	Prefix     string `json:"prefix,omitempty"`
-	Type       string `json:"type,omitempty"`
+	Connection string `json:"connection" yaml:"connection"`
+	Name       string `json:"name,omitempty" yaml:"name"`
+	Prefix     string `json:"prefix,omitempty" yaml:"prefix"`
+	Type       string `json:"type,omitempty" yaml:"type"`
+
+	// Optional overrides of the shared settings for this database
+	Compression      string        `json:"compression,omitempty" yaml:"compression"`
+	EncryptionKey    string        `json:"encryption_key,omitempty" yaml:"encryption_key"`
+	RetentionDays    *int          `json:"retention_days,omitempty" yaml:"retention_days"`
+	RetentionCount   *int          `json:"retention_count,omitempty" yaml:"retention_count"`
+	RetentionDaily   *int          `json:"retention_daily,omitempty" yaml:"retention_daily"`
+	RetentionWeekly  *int          `json:"retention_weekly,omitempty" yaml:"retention_weekly"`
+	RetentionMonthly *int          `json:"retention_monthly,omitempty" yaml:"retention_monthly"`
+	RetentionYearly  *int          `json:"retention_yearly,omitempty" yaml:"retention_yearly"`
+	RetentionMinKeep *int          `json:"retention_min_keep,omitempty" yaml:"retention_min_keep"`
+	RetentionMaxSize string        `json:"retention_max_size,omitempty" yaml:"retention_max_size"`
+	Storage          *StorageEntry `json:"storage,omitempty" yaml:"storage"`
+	WebhookURL       string        `json:"webhook_url,omitempty" yaml:"webhook_url"`
+	NotifyOnSuccess  *bool         `json:"notify_on_success,omitempty" yaml:"notify_on_success"`
+	NotifyOnFailure  *bool         `json:"notify_on_failure,omitempty" yaml:"notify_on_failure"`
+}
+
+// StorageEntry sends a single database's backups to another destination.
+// Credentials still come from the shared settings of the chosen backend.
+type StorageEntry struct {
+	Backend string `json:"backend,omitempty" yaml:"backend"`
+	Bucket  string `json:"bucket,omitempty" yaml:"bucket"` // R2 or S3 bucket
+	Path    string `json:"path,omitempty" yaml:"path"`     // local storage directory
 }
 
 // DatabaseConfig holds settings for a single database to back up
@@ -36,6 +92,41 @@ type DatabaseConfig struct {
 	Password         string
 	ConnectionString string
 	BackupPrefix     string
+
+	// Overrides of the shared settings; see Config.ForDatabase
+	Overrides DatabaseOverrides
+}
+
+// DatabaseOverrides holds the shared settings a single database replaces.
+// Zero values keep the shared setting.
+type DatabaseOverrides struct {
+	CompressionAlgorithm string
+	CompressionLevel     int
+	EncryptionKey        []byte
+	RetentionDays        *int
+	RetentionCount       *int
+	RetentionDaily       *int
+	RetentionWeekly      *int
+	RetentionMonthly     *int
+	RetentionYearly      *int
+	RetentionMinKeep     *int
+	RetentionMaxSize     *int64
+	StorageBackend       StorageBackendType
+	BucketName           string
+	LocalStoragePath     string
+	WebhookURL           string
+	NotifyOnSuccess      *bool
+	NotifyOnFailure      *bool
+}
+
+// DrillCheck is a sanity query run against a database restored by a drill.
+// The query must return a single number, which must lie within Min and Max
+// when they are set.
+type DrillCheck struct {
+	Name  string   `json:"name" yaml:"name"`
+	Query string   `json:"query" yaml:"query"`
+	Min   *float64 `json:"min,omitempty" yaml:"min"`
+	Max   *float64 `json:"max,omitempty" yaml:"max"`
 }
 
 // Config holds the application configuration
@@ -43,128 +134,332 @@ type Config struct {
 	// Database settings (multiple databases supported)
 	Databases []DatabaseConfig
 
-	// R2 settings (shared across all backups)
+	// Storage backend (shared across all backups)
+	StorageBackend StorageBackendType
+
+	// Further backends every backup is also uploaded to, each using its own
+	// settings below. The StorageBackend is the primary the other commands
+	// read from.
+	ReplicaBackends []StorageBackendType
+	ReplicaPolicy   ReplicaPolicy
+
+	// ReplicaBufferSize is how many bytes a replica that doesn't decide the
+	// outcome may fall behind the stream before it is dropped, 0 for the
+	// default
+	ReplicaBufferSize int64
+
+	// R2 settings (STORAGE_BACKEND=r2)
 	R2AccountID       string
 	R2AccessKeyID     string
 	R2SecretAccessKey string
 	R2BucketName      string
 
+	// S3-compatible settings (STORAGE_BACKEND=s3), e.g. AWS S3 or MinIO
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3BucketName      string
+	S3ForcePathStyle  bool
+
+	// Local filesystem settings (STORAGE_BACKEND=local)
+	LocalStoragePath string
+
 	// Backup settings (shared)
-	Compression   bool
-	EncryptionKey []byte
+	Compression          bool             // whether backups are compressed at all
+	CompressionAlgorithm string           // "gzip", "zstd" or "none"
+	CompressionLevel     int              // 0 selects the algorithm's default
+	GzipWorkers          int              // parallel gzip when > 1
+	GzipBlockSize        int              // bytes each parallel gzip worker compresses at a time
+	Keyring              *encrypt.Keyring // nil when backups aren't encrypted with AES
+	MaxParallel          int              // databases backed up concurrently
+
+	// Passphrase-based encryption: each backup's key is derived from the
+	// passphrase with a memory-hard KDF. It takes over from the keyring for
+	// new backups, while the keyring still decrypts older ones.
+	Passphrase *encrypt.PassphraseWrapper
+
+	// databaseKey is set when a database's own encryption_key overrides
+	// the shared keys for new backups
+	databaseKey bool
+
+	// Public-key encryption: new backups are encrypted to the recipients
+	// when set, and only the identities (private keys) decrypt them
+	AgeRecipients *encrypt.AgeEncryptor
+	AgeIdentities *encrypt.AgeIdentities
+
+	// Manifest signing: new manifests are signed by Signer when set, and
+	// signatures are checked against SignatureVerifier's public keys, which
+	// default to the signer's own
+	Signer            *signing.Signer
+	SignatureVerifier *signing.Verifier
 
-	// Retention settings (shared)
-	RetentionDays  int
-	RetentionCount int
+	// Retry settings for transient export and upload failures (shared)
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+
+	// Retention settings (shared). The GFS counts keep the newest backup of
+	// that many days, weeks, months and years; RetentionKeepAll keeps one
+	// from every period. RetentionMinKeep backups are always left behind.
+	RetentionDays    int
+	RetentionCount   int
+	RetentionDaily   int
+	RetentionWeekly  int
+	RetentionMonthly int
+	RetentionYearly  int
+	RetentionMinKeep int
+	RetentionDryRun  bool // only report what retention would delete
+
+	// Storage budgets in bytes, 0 for none: for each database's backups,
+	// and for everything in a bucket
+	RetentionMaxSize       int64
+	RetentionBucketMaxSize int64
 
 	// Notification settings (shared)
 	WebhookURL      string
 	NotifyOnSuccess bool
 	NotifyOnFailure bool
+
+	// Restore drill settings: the server each database type is restored to
+	// (DRILL_<TYPE>_URL) and the sanity checks per database name
+	DrillTargets map[DatabaseType]*DatabaseConfig
+	DrillChecks  map[string][]DrillCheck
 }
 
+// Load reads the configuration from the environment, along with the YAML
+// config file named by CONFIG_FILE if set
 func Load() (*Config, error) {
-	cfg := &Config{}
+	return LoadFile("")
+}
+
+// LoadFile is like Load, reading the YAML config file at path (CONFIG_FILE
+// when path is empty). Environment variables take precedence over the file.
+// The error lists every problem found, as Problems. Warnings, such as a
+// number that couldn't be parsed and was replaced by its default, are
+// logged rather than returned.
+func LoadFile(path string) (*Config, error) {
+	cfg, problems, warnings := load(path)
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: %s: %s", warning.Field, warning.Message)
+	}
+	return cfg, nil
+}
+
+// Inspect loads the configuration like LoadFile, but returns it even when
+// it has problems, along with every problem found. This includes warnings
+// that don't stop Load, such as numbers, booleans and durations that
+// couldn't be parsed, which Load replaces with their defaults. The Config is
+// nil if the config file itself couldn't be read.
+func Inspect(path string) (*Config, Problems) {
+	cfg, problems, warnings := load(path)
+	return cfg, append(warnings, problems...)
+}
+
+// load reads the configuration, collecting problems rather than stopping at
+// the first. Settings that couldn't be parsed and fell back to their
+// defaults, and other problems a backup can run with, are reported
+// separately in warnings.
+func load(path string) (cfg *Config, problems, warnings Problems) {
+	in := inputs{}
+	if path == "" {
+		path = in.getInput("config_file")
+	}
+	if path != "" {
+		var err error
+		in, err = readConfigFile(path)
+		if err != nil {
+			problems.Add("config_file", "%v", err)
+			return nil, problems, nil
+		}
+	}
+	in.unparsed = &warnings
+
+	cfg = &Config{}
 
 	// Determine global database type (used as default)
-	dbType := getInput("database_type")
-	var globalDBType DatabaseType
-	switch strings.ToLower(dbType) {
-	case "postgres", "postgresql", "":
-		globalDBType = DatabaseTypePostgres // Default to postgres
-	case "mysql", "mariadb":
-		globalDBType = DatabaseTypeMySQL
-	case "mongodb", "mongo":
-		globalDBType = DatabaseTypeMongoDB
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	globalDBType, err := parseDatabaseType(in.getInput("database_type"))
+	if err != nil {
+		problems.Add("database_type", "%v", err)
+		globalDBType = DatabaseTypePostgres
 	}
 
-	// Load database connections from JSON
-	databases, err := loadDatabaseConfigs(globalDBType)
+	// Load database connections from DATABASES_JSON or the config file
+	cfg.Databases = loadDatabaseConfigs(in, globalDBType, &problems)
+
+	// Storage settings
+	cfg.StorageBackend, err = parseStorageBackend(in.getInput("storage_backend"))
 	if err != nil {
-		return nil, err
+		problems.Add("storage_backend", "%v", err)
 	}
-	cfg.Databases = databases
+	if replicas := in.getInput("replica_backends"); replicas != "" {
+		for _, name := range strings.Split(replicas, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			backend, err := parseStorageBackend(name)
+			if err != nil {
+				problems.Add("replica_backends", "%v", err)
+				continue
+			}
+			cfg.ReplicaBackends = append(cfg.ReplicaBackends, backend)
+		}
+	}
+	switch policy := strings.ToLower(in.getInput("replica_policy")); policy {
+	case "", string(ReplicaPolicyAll):
+		cfg.ReplicaPolicy = ReplicaPolicyAll
+	case string(ReplicaPolicyPrimary):
+		cfg.ReplicaPolicy = ReplicaPolicyPrimary
+	default:
+		problems.Add("replica_policy", "unsupported policy %q (expected all or primary)", policy)
+	}
+	cfg.ReplicaBufferSize = in.getInputSize("replica_buffer_size", 0)
 
-	// R2 settings
-	cfg.R2AccountID = getInput("r2_account_id")
-	cfg.R2AccessKeyID = getInput("r2_access_key_id")
-	cfg.R2SecretAccessKey = getInput("r2_secret_access_key")
-	cfg.R2BucketName = getInput("r2_bucket_name")
+	cfg.R2AccountID = in.getInput("r2_account_id")
+	cfg.R2AccessKeyID = in.getInput("r2_access_key_id")
+	cfg.R2SecretAccessKey = in.getInput("r2_secret_access_key")
+	cfg.R2BucketName = in.getInput("r2_bucket_name")
 
-	// Backup settings
-	cfg.Compression = getInputBool("compression", true)
+	cfg.S3Endpoint = in.getInput("s3_endpoint")
+	cfg.S3Region = in.getInput("s3_region")
+	if cfg.S3Region == "" {
+		cfg.S3Region = "us-east-1"
+	}
+	cfg.S3AccessKeyID = in.getInput("s3_access_key_id")
+	cfg.S3SecretAccessKey = in.getInput("s3_secret_access_key")
+	cfg.S3BucketName = in.getInput("s3_bucket_name")
+	// Most self-hosted S3 implementations (MinIO etc.) need path-style URLs
+	cfg.S3ForcePathStyle = in.getInputBool("s3_force_path_style", cfg.S3Endpoint != "")
 
-	encKeyStr := getInput("encryption_key")
-	if encKeyStr != "" {
-		key, err := base64.StdEncoding.DecodeString(encKeyStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid encryption key: must be base64 encoded: %w", err)
-		}
-		if len(key) != 32 {
-			return nil, fmt.Errorf("invalid encryption key: must be exactly 32 bytes (256 bits), got %d bytes", len(key))
-		}
-		cfg.EncryptionKey = key
+	cfg.LocalStoragePath = in.getInput("local_storage_path")
+
+	// Backup settings
+	compression := in.getInput("compression")
+	cfg.CompressionAlgorithm, cfg.CompressionLevel, err = parseCompression(compression)
+	if stderrors.Is(err, errUnknownCompression) {
+		in.invalid("compression", compression, "a compression algorithm or true/false", "backing up uncompressed")
+	} else if err != nil {
+		problems.Add("compression", "%v", err)
+		cfg.CompressionAlgorithm = compress.GzipName
+	}
+	cfg.Compression = cfg.CompressionAlgorithm != compress.NoneName
+	if strings.EqualFold(in.getInput("gzip_workers"), "auto") {
+		cfg.GzipWorkers = runtime.GOMAXPROCS(0)
+	} else {
+		cfg.GzipWorkers = in.getInputInt("gzip_workers", 1)
 	}
+	cfg.GzipBlockSize = int(in.getInputSize("gzip_block_size", compress.DefaultGzipBlockSize))
+
+	cfg.Keyring = loadKeyring(in, &problems)
+	cfg.Passphrase = loadPassphrase(in, &problems)
+	cfg.AgeRecipients, cfg.AgeIdentities = loadAgeKeys(in, &problems)
+	cfg.Signer, cfg.SignatureVerifier = loadSigningKeys(in, &problems)
+
+	cfg.MaxParallel = in.getInputInt("max_parallel", 1)
+
+	// Retry settings
+	cfg.RetryMaxAttempts = in.getInputInt("retry_max_attempts", 3)
+	cfg.RetryBaseDelay = in.getInputDuration("retry_base_delay", 10*time.Second)
+	cfg.RetryMaxDelay = in.getInputDuration("retry_max_delay", 2*time.Minute)
 
 	// Retention settings
-	cfg.RetentionDays = getInputInt("retention_days", 0)
-	cfg.RetentionCount = getInputInt("retention_count", 0)
+	cfg.RetentionDays = in.getInputInt("retention_days", 0)
+	cfg.RetentionCount = in.getInputInt("retention_count", 0)
+	cfg.RetentionDaily = in.getInputInt("retention_daily", 0)
+	cfg.RetentionWeekly = in.getInputInt("retention_weekly", 0)
+	cfg.RetentionMonthly = in.getInputInt("retention_monthly", 0)
+	cfg.RetentionYearly = in.getInputInt("retention_yearly", 0)
+	cfg.RetentionMinKeep = in.getInputInt("retention_min_keep", 0)
+	cfg.RetentionDryRun = in.getInputBool("retention_dry_run", false)
+	cfg.RetentionMaxSize = in.getInputSize("retention_max_size", 0)
+	cfg.RetentionBucketMaxSize = in.getInputSize("retention_bucket_max_size", 0)
 
 	// Notification settings
-	cfg.WebhookURL = getInput("webhook_url")
-	cfg.NotifyOnSuccess = getInputBool("notify_on_success", true)
-	cfg.NotifyOnFailure = getInputBool("notify_on_failure", true)
+	cfg.WebhookURL = in.getInput("webhook_url")
+	cfg.NotifyOnSuccess = in.getInputBool("notify_on_success", true)
+	cfg.NotifyOnFailure = in.getInputBool("notify_on_failure", true)
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+	// Restore drill settings
+	cfg.DrillTargets = make(map[DatabaseType]*DatabaseConfig)
+	for _, dbType := range []DatabaseType{DatabaseTypePostgres, DatabaseTypeMySQL, DatabaseTypeMongoDB} {
+		field := fmt.Sprintf("drill_%s_url", dbType)
+		connection := in.getInput(field)
+		if connection == "" {
+			continue
+		}
+		target, err := NewDatabaseConfig(connection, dbType)
+		if err != nil {
+			problems.Add(field, "%v", err)
+			continue
+		}
+		cfg.DrillTargets[dbType] = target
 	}
 
-	return cfg, nil
-}
-
-// loadDatabaseConfigs loads database configurations from DATABASES_JSON
-func loadDatabaseConfigs(globalDBType DatabaseType) ([]DatabaseConfig, error) {
-	jsonStr := getInput("databases_json")
-	if jsonStr == "" {
-		return nil, fmt.Errorf("DATABASES_JSON is required")
+	if checksJSON := in.getInput("drill_checks_json"); checksJSON != "" {
+		if err := json.Unmarshal([]byte(checksJSON), &cfg.DrillChecks); err != nil {
+			problems.Add("drill_checks_json", "invalid DRILL_CHECKS_JSON: %v", err)
+		}
+	} else {
+		cfg.DrillChecks = in.drillChecks
 	}
 
-	var entries []DatabaseJSONEntry
-	if err := json.Unmarshal([]byte(jsonStr), &entries); err != nil {
-		return nil, fmt.Errorf("invalid DATABASES_JSON: %w", err)
-	}
+	problems = append(problems, cfg.problems()...)
+	warnings = append(warnings, cfg.prefixWarnings()...)
+
+	return cfg, problems, warnings
+}
 
-	if len(entries) == 0 {
-		return nil, fmt.Errorf("DATABASES_JSON must contain at least one database")
+// loadDatabaseConfigs loads database configurations from DATABASES_JSON, or
+// from the config file's databases list when it isn't set. Entries with
+// problems are left out.
+func loadDatabaseConfigs(in inputs, globalDBType DatabaseType, problems *Problems) []DatabaseConfig {
+	entries := in.databases
+	if jsonStr := in.getInput("databases_json"); jsonStr != "" {
+		entries = nil
+		if err := json.Unmarshal([]byte(jsonStr), &entries); err != nil {
+			problems.Add("databases_json", "invalid DATABASES_JSON: %v", err)
+			return nil
+		}
+		if len(entries) == 0 {
+			problems.Add("databases_json", "DATABASES_JSON must contain at least one database")
+			return nil
+		}
+	} else if len(entries) == 0 {
+		problems.Add("databases_json", "DATABASES_JSON is required (or a databases list in the config file)")
+		return nil
 	}
 
 	var databases []DatabaseConfig
 	for i, entry := range entries {
 		if entry.Connection == "" {
-			return nil, fmt.Errorf("database %d: connection is required", i+1)
+			problems.Add(DatabaseField(i, "connection"), "connection is required")
+			continue
 		}
 
 		// Determine database type for this entry
 		dbType := globalDBType
 		if entry.Type != "" {
-			switch strings.ToLower(entry.Type) {
-			case "postgres", "postgresql":
-				dbType = DatabaseTypePostgres
-			case "mysql", "mariadb":
-				dbType = DatabaseTypeMySQL
-			case "mongodb", "mongo":
-				dbType = DatabaseTypeMongoDB
-			default:
-				return nil, fmt.Errorf("database %d: unsupported type: %s", i+1, entry.Type)
+			var err error
+			dbType, err = parseDatabaseType(entry.Type)
+			if err != nil {
+				problems.Add(DatabaseField(i, "type"), "unsupported type: %s", entry.Type)
+				continue
 			}
 		}
 
 		// Parse connection string to extract components
 		parsed, err := parseConnectionString(entry.Connection, dbType)
 		if err != nil {
-			return nil, fmt.Errorf("database %d: %w", i+1, err)
+			problems.Add(DatabaseField(i, "connection"), "%v", err)
+			continue
+		}
+
+		overrides, ok := parseOverrides(i, &entry, problems)
+		if !ok {
+			continue
 		}
 
 		// Use custom name if provided, otherwise use parsed name
@@ -191,10 +486,303 @@ func loadDatabaseConfigs(globalDBType DatabaseType) ([]DatabaseConfig, error) {
 			Password:         parsed.Password,
 			ConnectionString: entry.Connection,
 			BackupPrefix:     prefix,
+			Overrides:        overrides,
 		})
 	}
 
-	return databases, nil
+	return databases
+}
+
+// parseOverrides parses the settings the i-th database entry overrides,
+// reporting whether they were all valid
+func parseOverrides(i int, entry *DatabaseJSONEntry, problems *Problems) (DatabaseOverrides, bool) {
+	o := DatabaseOverrides{
+		RetentionDays:    entry.RetentionDays,
+		RetentionCount:   entry.RetentionCount,
+		RetentionDaily:   entry.RetentionDaily,
+		RetentionWeekly:  entry.RetentionWeekly,
+		RetentionMonthly: entry.RetentionMonthly,
+		RetentionYearly:  entry.RetentionYearly,
+		RetentionMinKeep: entry.RetentionMinKeep,
+		WebhookURL:       entry.WebhookURL,
+		NotifyOnSuccess:  entry.NotifyOnSuccess,
+		NotifyOnFailure:  entry.NotifyOnFailure,
+	}
+	before := len(*problems)
+
+	if entry.Compression != "" {
+		var err error
+		o.CompressionAlgorithm, o.CompressionLevel, err = parseCompression(entry.Compression)
+		if stderrors.Is(err, errUnknownCompression) {
+			problems.Add(DatabaseField(i, "compression"), "unsupported algorithm %q", entry.Compression)
+		} else if err != nil {
+			problems.Add(DatabaseField(i, "compression"), "%v", err)
+		}
+	}
+
+	if entry.RetentionMaxSize != "" {
+		size, err := parseSize(entry.RetentionMaxSize)
+		if err != nil {
+			problems.Add(DatabaseField(i, "retention_max_size"), "%v", err)
+		}
+		o.RetentionMaxSize = &size
+	}
+
+	if entry.EncryptionKey != "" {
+		var err error
+		o.EncryptionKey, err = parseEncryptionKey(entry.EncryptionKey)
+		if err != nil {
+			problems.Add(DatabaseField(i, "encryption_key"), "%v", err)
+		}
+	}
+
+	if entry.Storage != nil {
+		if entry.Storage.Backend != "" {
+			var err error
+			o.StorageBackend, err = parseStorageBackend(entry.Storage.Backend)
+			if err != nil {
+				problems.Add(DatabaseField(i, "storage.backend"), "%v", err)
+			}
+		}
+		o.BucketName = entry.Storage.Bucket
+		o.LocalStoragePath = entry.Storage.Path
+	}
+
+	return o, len(*problems) == before
+}
+
+func parseDatabaseType(val string) (DatabaseType, error) {
+	switch strings.ToLower(val) {
+	case "postgres", "postgresql", "":
+		return DatabaseTypePostgres, nil // Default to postgres
+	case "mysql", "mariadb":
+		return DatabaseTypeMySQL, nil
+	case "mongodb", "mongo":
+		return DatabaseTypeMongoDB, nil
+	default:
+		return "", fmt.Errorf("unsupported database type: %s", val)
+	}
+}
+
+func parseStorageBackend(val string) (StorageBackendType, error) {
+	switch strings.ToLower(val) {
+	case "r2", "":
+		return StorageBackendR2, nil // Default to R2
+	case "s3", "minio":
+		return StorageBackendS3, nil
+	case "local", "filesystem":
+		return StorageBackendLocal, nil
+	default:
+		return "", fmt.Errorf("unsupported storage backend: %s", val)
+	}
+}
+
+// loadKeyring reads ENCRYPTION_KEY, a single key, or ENCRYPTION_KEYS, a
+// comma-separated list of id:key pairs with ENCRYPTION_ACTIVE_KEY naming the
+// one new backups are encrypted with. It returns nil without either.
+func loadKeyring(in inputs, problems *Problems) *encrypt.Keyring {
+	single := in.getInput("encryption_key")
+	list := in.getInput("encryption_keys")
+	active := in.getInput("encryption_active_key")
+
+	switch {
+	case single != "" && list != "":
+		problems.Add("encryption_keys", "set either encryption_key or encryption_keys, not both")
+		return nil
+	case single != "":
+		if active != "" {
+			problems.Add("encryption_active_key", "only used with encryption_keys")
+		}
+		key, err := parseEncryptionKey(single)
+		if err != nil {
+			problems.Add("encryption_key", "%v", err)
+			return nil
+		}
+		return singleKeyring(key)
+	case list == "":
+		if active != "" {
+			problems.Add("encryption_active_key", "only used with encryption_keys")
+		}
+		return nil
+	}
+
+	var keys []encrypt.Key
+	for i, entry := range strings.Split(list, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			// Never echo the entry, it holds a key
+			problems.Add("encryption_keys", "entry %d must be <id>:<base64 key>", i+1)
+			continue
+		}
+		key, err := parseEncryptionKey(secret)
+		if err != nil {
+			problems.Add("encryption_keys", "key %q: %v", id, err)
+			continue
+		}
+		keys = append(keys, encrypt.Key{ID: strings.TrimSpace(id), Secret: key})
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	keyring, err := encrypt.NewKeyring(keys, active)
+	if err != nil {
+		problems.Add("encryption_keys", "%v", err)
+		return nil
+	}
+	return keyring
+}
+
+// minPassphraseLen is the shortest passphrase accepted. The KDF slows down
+// guessing but can't make up for a short passphrase.
+const minPassphraseLen = 12
+
+// loadPassphrase reads ENCRYPTION_PASSPHRASE and the KDF it is stretched
+// with, ENCRYPTION_KDF. It returns nil without a passphrase.
+func loadPassphrase(in inputs, problems *Problems) *encrypt.PassphraseWrapper {
+	passphrase := in.getInput("encryption_passphrase")
+	kdf := in.getInput("encryption_kdf")
+	if passphrase == "" {
+		if kdf != "" {
+			problems.Add("encryption_kdf", "only used with encryption_passphrase")
+		}
+		return nil
+	}
+	if len(passphrase) < minPassphraseLen {
+		// Never echo the passphrase
+		problems.Add("encryption_passphrase", "must be at least %d characters", minPassphraseLen)
+		return nil
+	}
+
+	if kdf == "" {
+		kdf = encrypt.KDFArgon2id
+	}
+	params, err := encrypt.DefaultKDFParams(strings.ToLower(kdf))
+	if err != nil {
+		problems.Add("encryption_kdf", "%v", err)
+		return nil
+	}
+	wrapper, err := encrypt.NewPassphraseWrapper(passphrase, params)
+	if err != nil {
+		problems.Add("encryption_passphrase", "%v", err)
+		return nil
+	}
+	return wrapper
+}
+
+// loadAgeKeys reads ENCRYPTION_RECIPIENTS, a comma-separated list of age
+// public keys, and the private keys in ENCRYPTION_IDENTITY or the file named
+// by ENCRYPTION_IDENTITY_FILE. Either may be nil.
+func loadAgeKeys(in inputs, problems *Problems) (*encrypt.AgeEncryptor, *encrypt.AgeIdentities) {
+	var recipients *encrypt.AgeEncryptor
+	if list := in.getInput("encryption_recipients"); list != "" {
+		var keys []string
+		for _, key := range strings.Split(list, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		var err error
+		recipients, err = encrypt.NewAgeEncryptor(keys)
+		if err != nil {
+			problems.Add("encryption_recipients", "%v", err)
+		}
+	}
+
+	inline := in.getInput("encryption_identity")
+	path := in.getInput("encryption_identity_file")
+	var source io.Reader
+	field := "encryption_identity"
+	switch {
+	case inline != "" && path != "":
+		problems.Add("encryption_identity_file", "set either encryption_identity or encryption_identity_file, not both")
+		return recipients, nil
+	case inline != "":
+		source = strings.NewReader(inline)
+	case path != "":
+		f, err := os.Open(path)
+		if err != nil {
+			problems.Add("encryption_identity_file", "%v", err)
+			return recipients, nil
+		}
+		defer f.Close()
+		source, field = f, "encryption_identity_file"
+	default:
+		return recipients, nil
+	}
+
+	identities, err := encrypt.ParseAgeIdentities(source)
+	if err != nil {
+		problems.Add(field, "%v", err)
+		return recipients, nil
+	}
+	return recipients, identities
+}
+
+// loadSigningKeys reads SIGNING_KEY, the base64-encoded Ed25519 seed new
+// manifests are signed with, and SIGNING_PUBLIC_KEYS, a comma-separated list
+// of the public keys signatures are trusted from. Without public keys, the
+// signing key's own is trusted. Either may be nil.
+func loadSigningKeys(in inputs, problems *Problems) (*signing.Signer, *signing.Verifier) {
+	var signer *signing.Signer
+	if key := in.getInput("signing_key"); key != "" {
+		var err error
+		signer, err = signing.ParseSigner(key)
+		if err != nil {
+			// Never echo the key
+			problems.Add("signing_key", "%v", err)
+		}
+	}
+
+	if list := in.getInput("signing_public_keys"); list != "" {
+		verifier, err := signing.ParseVerifier(list)
+		if err != nil {
+			problems.Add("signing_public_keys", "%v", err)
+		}
+		return signer, verifier
+	}
+	if signer == nil {
+		return nil, nil
+	}
+	verifier, _ := signing.NewVerifier(signer.PublicKey())
+	return signer, verifier
+}
+
+// singleKeyring returns a keyring of just key, identified by its fingerprint
+func singleKeyring(key []byte) *encrypt.Keyring {
+	keyring, _ := encrypt.NewKeyring([]encrypt.Key{{ID: encrypt.Fingerprint(key), Secret: key}}, "")
+	return keyring
+}
+
+// parseEncryptionKey decodes a base64-encoded AES-256 key
+func parseEncryptionKey(val string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid encryption key: must be exactly 32 bytes (256 bits), got %d bytes", len(key))
+	}
+	return key, nil
+}
+
+// NewDatabaseConfig builds a DatabaseConfig from a bare connection string,
+// such as a restore target, taking the name from the connection's database
+func NewDatabaseConfig(connection string, dbType DatabaseType) (*DatabaseConfig, error) {
+	parsed, err := parseConnectionString(connection, dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DatabaseConfig{
+		Type:             dbType,
+		Host:             parsed.Host,
+		Port:             parsed.Port,
+		Name:             parsed.Name,
+		User:             parsed.User,
+		Password:         parsed.Password,
+		ConnectionString: connection,
+	}, nil
 }
 
 // parsedConnection holds components extracted from a connection string
@@ -243,71 +831,540 @@ func parseConnectionString(connStr string, dbType DatabaseType) (*parsedConnecti
 	return parsed, nil
 }
 
+// Validate checks the loaded settings fit together, returning every
+// problem found as Problems
 func (c *Config) Validate() error {
+	return c.problems().err()
+}
+
+func (c *Config) problems() Problems {
+	var problems Problems
+
 	// Validate each database config
+	names := make(map[string]int)
 	for i, db := range c.Databases {
 		if db.Name == "" {
-			return fmt.Errorf("database %d: name could not be determined from connection string", i+1)
+			problems.Add(DatabaseField(i, "name"), "name could not be determined from connection string")
+		} else if first, ok := names[db.Name]; ok {
+			problems.Add(DatabaseField(i, "name"), "duplicate database name '%s' (also databases[%d])", db.Name, first)
+		} else {
+			names[db.Name] = i
 		}
 		// For MySQL, we need host to be set since mysqldump doesn't accept connection URLs
 		if db.Type == DatabaseTypeMySQL && db.Host == "" {
-			return fmt.Errorf("database %d: host could not be parsed from connection string", i+1)
+			problems.Add(DatabaseField(i, "connection"), "host could not be parsed from connection string")
+		}
+	}
+
+	if c.GzipWorkers < 0 {
+		problems.Add("gzip_workers", "must not be negative")
+	}
+	if _, err := c.Compressor(); err != nil {
+		problems.Add("compression", "invalid compression: %v", err)
+	}
+
+	if c.MaxParallel < 0 {
+		problems.Add("max_parallel", "must not be negative")
+	}
+	if c.ReplicaBufferSize < 0 {
+		problems.Add("replica_buffer_size", "must not be negative")
+	}
+	if c.RetryMaxAttempts < 0 {
+		problems.Add("retry_max_attempts", "must not be negative")
+	}
+	for _, keep := range gfsRetention(&c.RetentionDaily, &c.RetentionWeekly, &c.RetentionMonthly, &c.RetentionYearly) {
+		keep.check(&problems, keep.name)
+	}
+	if c.RetentionMinKeep < 0 {
+		problems.Add("retention_min_keep", "must not be negative")
+	}
+
+	problems = append(problems, c.storageProblems()...)
+	seen := map[StorageBackendType]bool{c.StorageBackend: true}
+	for _, backend := range c.ReplicaBackends {
+		if seen[backend] {
+			problems.Add("replica_backends", "%s is listed more than once, or is also the storage_backend", backend)
+			continue
 		}
+		seen[backend] = true
+		problems = append(problems, c.forBackend(backend).storageProblems()...)
 	}
 
-	// R2 settings are always required
-	if c.R2AccountID == "" {
-		return fmt.Errorf("r2_account_id is required")
+	// Overrides are checked against the settings they end up combined with
+	for i := range c.Databases {
+		db := &c.Databases[i]
+		effective := c.ForDatabase(db)
+		o := &db.Overrides
+		for _, keep := range gfsRetention(o.RetentionDaily, o.RetentionWeekly, o.RetentionMonthly, o.RetentionYearly) {
+			keep.check(&problems, DatabaseField(i, keep.name))
+		}
+		if o.RetentionMinKeep != nil && *o.RetentionMinKeep < 0 {
+			problems.Add(DatabaseField(i, "retention_min_keep"), "must not be negative")
+		}
+		if db.Overrides.CompressionAlgorithm != "" {
+			if _, err := effective.Compressor(); err != nil {
+				problems.Add(DatabaseField(i, "compression"), "invalid compression: %v", err)
+			}
+		}
+		if db.Overrides.StorageBackend != "" || db.Overrides.BucketName != "" || db.Overrides.LocalStoragePath != "" {
+			for _, problem := range effective.storageProblems() {
+				problems.Add(DatabaseField(i, "storage"), "%s %s", problem.Field, problem.Message)
+			}
+		}
+		// Settings for another backend would otherwise be ignored
+		if o.BucketName != "" && effective.StorageBackend == StorageBackendLocal {
+			problems.Add(DatabaseField(i, "storage.bucket"), "does not apply to the local storage backend, use path")
+		}
+		if o.LocalStoragePath != "" && effective.StorageBackend != StorageBackendLocal {
+			problems.Add(DatabaseField(i, "storage.path"), "does not apply to the %s storage backend, use bucket", effective.StorageBackend)
+		}
+	}
+
+	for dbType, target := range c.DrillTargets {
+		// mysql doesn't accept connection URLs, so the host must be known
+		if dbType == DatabaseTypeMySQL && target.Host == "" {
+			problems.Add("drill_mysql_url", "host could not be parsed from connection string")
+		}
 	}
-	if c.R2AccessKeyID == "" {
-		return fmt.Errorf("r2_access_key_id is required")
+
+	for name, checks := range c.DrillChecks {
+		if !c.hasDatabase(name) {
+			problems.Add("drill_checks_json", "database '%s' is not configured", name)
+		}
+		for i, check := range checks {
+			if check.Name == "" || check.Query == "" {
+				problems.Add("drill_checks_json", "check %d for '%s' needs a name and a query", i+1, name)
+			}
+			if check.Min != nil && check.Max != nil && *check.Min > *check.Max {
+				problems.Add("drill_checks_json", "check '%s' for '%s' has min greater than max", check.Name, name)
+			}
+		}
 	}
-	if c.R2SecretAccessKey == "" {
-		return fmt.Errorf("r2_secret_access_key is required")
+
+	return problems
+}
+
+// prefixWarnings reports databases whose backups share a folder: a prefix
+// that contains another database's prefix in the same storage destination.
+// Retention and restores only pick up each database's own backups, so this
+// is allowed, but it is rarely intended.
+func (c *Config) prefixWarnings() Problems {
+	var problems Problems
+	for i := range c.Databases {
+		for j := range i {
+			a, b := &c.Databases[j], &c.Databases[i]
+			if c.ForDatabase(a).Destination() != c.ForDatabase(b).Destination() {
+				continue
+			}
+			if strings.HasPrefix(a.BackupPrefix, b.BackupPrefix) || strings.HasPrefix(b.BackupPrefix, a.BackupPrefix) {
+				problems.Add(DatabaseField(i, "prefix"), "prefix '%s' collides with '%s' of databases[%d]", b.BackupPrefix, a.BackupPrefix, j)
+			}
+		}
 	}
-	if c.R2BucketName == "" {
-		return fmt.Errorf("r2_bucket_name is required")
+	return problems
+}
+
+func (c *Config) storageProblems() Problems {
+	var problems Problems
+
+	// Only the selected storage backend's settings are required
+	switch c.StorageBackend {
+	case StorageBackendR2, "":
+		required := []struct{ field, value string }{
+			{"r2_account_id", c.R2AccountID},
+			{"r2_access_key_id", c.R2AccessKeyID},
+			{"r2_secret_access_key", c.R2SecretAccessKey},
+			{"r2_bucket_name", c.R2BucketName},
+		}
+		for _, setting := range required {
+			if setting.value == "" {
+				problems.Add(setting.field, "required for the r2 storage backend")
+			}
+		}
+	case StorageBackendS3:
+		if c.S3BucketName == "" {
+			problems.Add("s3_bucket_name", "required for the s3 storage backend")
+		}
+		// Static credentials are optional (the default AWS credential chain
+		// is used otherwise), but a half-configured pair is a mistake
+		if (c.S3AccessKeyID == "") != (c.S3SecretAccessKey == "") {
+			problems.Add("s3_access_key_id", "s3_access_key_id and s3_secret_access_key must be set together")
+		}
+	case StorageBackendLocal:
+		if c.LocalStoragePath == "" {
+			problems.Add("local_storage_path", "required for the local storage backend")
+		}
 	}
 
-	return nil
+	return problems
+}
+
+func (c *Config) hasDatabase(name string) bool {
+	for _, db := range c.Databases {
+		if db.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Config) HasEncryption() bool {
-	return len(c.EncryptionKey) > 0
+	return c.Keyring != nil || c.Passphrase != nil || c.AgeRecipients != nil
+}
+
+// Encryptor returns the encryptor new backups are encrypted with: age
+// recipients when configured, otherwise AES with the EnvelopeWrapper. Call
+// it only when HasEncryption.
+func (c *Config) Encryptor() (encrypt.Encryptor, error) {
+	if c.AgeRecipients != nil {
+		return c.AgeRecipients, nil
+	}
+	wrapper, err := c.EnvelopeWrapper()
+	if err != nil {
+		return nil, err
+	}
+	return encrypt.NewEnvelopeEncryptor(wrapper), nil
+}
+
+// EnvelopeWrapper returns what wraps the data keys of new AES backups: the
+// passphrase, unless the database has its own key, otherwise the keyring's
+// active key. It is nil when neither is configured.
+func (c *Config) EnvelopeWrapper() (encrypt.KeyWrapper, error) {
+	switch {
+	case c.Passphrase != nil && !c.databaseKey:
+		return c.Passphrase, nil
+	case c.Keyring != nil:
+		encryptor, err := c.Keyring.Encryptor()
+		if err != nil {
+			return nil, err
+		}
+		return encryptor.Wrapper(), nil
+	default:
+		return nil, nil
+	}
+}
+
+// DecryptionKeys returns every key configured for reading backups
+func (c *Config) DecryptionKeys() encrypt.Keys {
+	return encrypt.Keys{Keyring: c.Keyring, Passphrase: c.Passphrase, AgeIdentities: c.AgeIdentities}
+}
+
+// Parallelism returns how many databases to back up concurrently, at least 1
+func (c *Config) Parallelism() int {
+	return max(c.MaxParallel, 1)
 }
 
 func (c *Config) HasRetention() bool {
-	return c.RetentionDays > 0 || c.RetentionCount > 0
+	return c.RetentionDays > 0 || c.RetentionCount > 0 ||
+		c.RetentionDaily != 0 || c.RetentionWeekly != 0 || c.RetentionMonthly != 0 || c.RetentionYearly != 0 ||
+		c.RetentionMaxSize > 0 || c.RetentionBucketMaxSize > 0
+}
+
+// Destinations returns the settings of every destination backups are
+// uploaded to: the primary storage backend, then each replica
+func (c *Config) Destinations() []*Config {
+	destinations := []*Config{c}
+	for _, backend := range c.ReplicaBackends {
+		// A database's own storage override may have made a replica primary
+		if backend != c.StorageBackend {
+			destinations = append(destinations, c.forBackend(backend))
+		}
+	}
+	return destinations
+}
+
+// forBackend returns the settings with backend as the storage backend
+func (c *Config) forBackend(backend StorageBackendType) *Config {
+	replica := *c
+	replica.StorageBackend = backend
+	replica.ReplicaBackends = nil
+	return &replica
 }
 
-func getInput(name string) string {
+// Destination identifies where backups are stored, without the prefix.
+// Databases with the same destination share a bucket or directory.
+func (c *Config) Destination() string {
+	switch c.StorageBackend {
+	case StorageBackendS3:
+		return fmt.Sprintf("s3:%s/%s", c.S3Endpoint, c.S3BucketName)
+	case StorageBackendLocal:
+		return "local:" + c.LocalStoragePath
+	default:
+		return fmt.Sprintf("r2:%s/%s", c.R2AccountID, c.R2BucketName)
+	}
+}
+
+// retentionKeep is a GFS retention count, nil when not set
+type retentionKeep struct {
+	name  string
+	count *int
+}
+
+func gfsRetention(daily, weekly, monthly, yearly *int) []retentionKeep {
+	return []retentionKeep{
+		{"retention_daily", daily},
+		{"retention_weekly", weekly},
+		{"retention_monthly", monthly},
+		{"retention_yearly", yearly},
+	}
+}
+
+func (k retentionKeep) check(problems *Problems, field string) {
+	if k.count != nil && *k.count < RetentionKeepAll {
+		problems.Add(field, "must be a count, or %d to keep every period", RetentionKeepAll)
+	}
+}
+
+// ForDatabase returns the settings that apply to db: the shared settings
+// with db's overrides applied
+func (c *Config) ForDatabase(db *DatabaseConfig) *Config {
+	effective := *c
+	o := &db.Overrides
+
+	if o.CompressionAlgorithm != "" {
+		effective.CompressionAlgorithm = o.CompressionAlgorithm
+		effective.CompressionLevel = o.CompressionLevel
+		effective.Compression = o.CompressionAlgorithm != compress.NoneName
+	}
+	if o.EncryptionKey != nil {
+		// The database's own key wins over shared recipients and the
+		// passphrase too
+		effective.AgeRecipients = nil
+		effective.databaseKey = true
+		// The shared keys still decrypt the database's older backups
+		if c.Keyring != nil {
+			effective.Keyring = c.Keyring.WithActive(encrypt.Key{ID: encrypt.Fingerprint(o.EncryptionKey), Secret: o.EncryptionKey})
+		} else {
+			effective.Keyring = singleKeyring(o.EncryptionKey)
+		}
+	}
+	if o.RetentionDays != nil {
+		effective.RetentionDays = *o.RetentionDays
+	}
+	if o.RetentionCount != nil {
+		effective.RetentionCount = *o.RetentionCount
+	}
+	if o.RetentionDaily != nil {
+		effective.RetentionDaily = *o.RetentionDaily
+	}
+	if o.RetentionWeekly != nil {
+		effective.RetentionWeekly = *o.RetentionWeekly
+	}
+	if o.RetentionMonthly != nil {
+		effective.RetentionMonthly = *o.RetentionMonthly
+	}
+	if o.RetentionYearly != nil {
+		effective.RetentionYearly = *o.RetentionYearly
+	}
+	if o.RetentionMinKeep != nil {
+		effective.RetentionMinKeep = *o.RetentionMinKeep
+	}
+	if o.RetentionMaxSize != nil {
+		effective.RetentionMaxSize = *o.RetentionMaxSize
+	}
+
+	if o.StorageBackend != "" {
+		effective.StorageBackend = o.StorageBackend
+	}
+	if o.BucketName != "" {
+		switch effective.StorageBackend {
+		case StorageBackendR2, "":
+			effective.R2BucketName = o.BucketName
+		case StorageBackendS3:
+			effective.S3BucketName = o.BucketName
+		}
+	}
+	if o.LocalStoragePath != "" {
+		effective.LocalStoragePath = o.LocalStoragePath
+	}
+
+	if o.WebhookURL != "" {
+		effective.WebhookURL = o.WebhookURL
+	}
+	if o.NotifyOnSuccess != nil {
+		effective.NotifyOnSuccess = *o.NotifyOnSuccess
+	}
+	if o.NotifyOnFailure != nil {
+		effective.NotifyOnFailure = *o.NotifyOnFailure
+	}
+
+	return &effective
+}
+
+// inputs resolves settings by name from the environment, falling back to
+// the config file if one was read
+type inputs struct {
+	file        map[string]string // top-level settings, by lower-case name
+	databases   []DatabaseJSONEntry
+	drillChecks map[string][]DrillCheck
+
+	// unparsed collects settings that couldn't be parsed and fell back to
+	// their defaults, if not nil
+	unparsed *Problems
+}
+
+// invalid records that the setting name holds val, which isn't expected
+// and was read as described by fallback
+func (in inputs) invalid(name, val, expected, fallback string) {
+	if in.unparsed != nil {
+		in.unparsed.Add(name, "%q is not %s, %s", val, expected, fallback)
+	}
+}
+
+func (in inputs) getInput(name string) string {
 	// First try regular env var (for local development)
 	envName := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
 	if val := os.Getenv(envName); val != "" {
 		return strings.TrimSpace(val)
 	}
 	// Fall back to INPUT_ prefixed (GitHub Actions convention)
-	return strings.TrimSpace(os.Getenv("INPUT_" + envName))
+	if val := strings.TrimSpace(os.Getenv("INPUT_" + envName)); val != "" {
+		return val
+	}
+	// Finally the config file
+	return in.file[strings.ToLower(envName)]
 }
 
-func getInputInt(name string, defaultVal int) int {
-	val := getInput(name)
+func (in inputs) getInputInt(name string, defaultVal int) int {
+	val := in.getInput(name)
 	if val == "" {
 		return defaultVal
 	}
 	i, err := strconv.Atoi(val)
 	if err != nil {
+		in.invalid(name, val, "a whole number", "using the default")
 		return defaultVal
 	}
 	return i
 }
 
-func getInputBool(name string, defaultVal bool) bool {
-	val := strings.ToLower(getInput(name))
+// getInputDuration parses a Go duration ("30s", "2m"); a bare number is
+// taken as seconds
+func (in inputs) getInputDuration(name string, defaultVal time.Duration) time.Duration {
+	val := in.getInput(name)
+	if val == "" {
+		return defaultVal
+	}
+	if secs, err := strconv.Atoi(val); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		in.invalid(name, val, "a duration", "using the default")
+		return defaultVal
+	}
+	return d
+}
+
+// Compressor returns the compressor new backups are written with
+func (c *Config) Compressor() (compress.Compressor, error) {
+	if !c.Compression {
+		return compress.New(compress.NoneName, c.CompressionLevel)
+	}
+	algorithm := c.CompressionAlgorithm
+	if algorithm == "" {
+		algorithm = compress.GzipName
+	}
+	if algorithm == compress.GzipName && c.GzipWorkers > 1 {
+		blockSize := c.GzipBlockSize
+		if blockSize == 0 {
+			blockSize = compress.DefaultGzipBlockSize
+		}
+		return compress.NewParallelGzipCompressor(c.CompressionLevel, c.GzipWorkers, blockSize)
+	}
+	return compress.New(algorithm, c.CompressionLevel)
+}
+
+// parseCompression parses COMPRESSION: an algorithm with an optional level
+// ("zstd", "gzip:6", "none"), or the older on/off switch, where on means gzip
+func parseCompression(val string) (algorithm string, level int, err error) {
+	switch strings.ToLower(val) {
+	case "", "true", "yes", "1":
+		return compress.GzipName, 0, nil
+	}
+
+	algorithm, level, err = compress.ParseSpec(val)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid compression %q: %w", val, err)
+	}
+	switch algorithm {
+	case compress.GzipName, compress.ZstdName, compress.NoneName:
+		return algorithm, level, nil
+	}
+	if level != 0 {
+		return "", 0, fmt.Errorf("invalid compression %q: unsupported algorithm %q", val, algorithm)
+	}
+
+	// Any other value switches compression off, as before algorithms
+	// could be chosen, but only these obviously meant to
+	switch algorithm {
+	case "false", "no", "0", "off":
+		return compress.NoneName, 0, nil
+	}
+	return compress.NoneName, 0, errUnknownCompression
+}
+
+// errUnknownCompression is returned along with compress.NoneName for a
+// COMPRESSION value that is neither an algorithm nor a way of saying off,
+// such as a typo of "true"
+var errUnknownCompression = stderrors.New("unknown compression algorithm")
+
+// getInputSize parses a byte count with an optional binary suffix ("512K",
+// "4MiB", "1G")
+func (in inputs) getInputSize(name string, defaultVal int64) int64 {
+	val := in.getInput(name)
 	if val == "" {
 		return defaultVal
 	}
-	return val == "true" || val == "yes" || val == "1"
+	size, err := parseSize(val)
+	if err != nil {
+		in.invalid(name, val, "a size", "using the default")
+		return defaultVal
+	}
+	return size
+}
+
+func parseSize(val string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(val))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", val)
+	}
+	return n * multiplier, nil
+}
+
+func (in inputs) getInputBool(name string, defaultVal bool) bool {
+	val := strings.ToLower(in.getInput(name))
+	switch val {
+	case "":
+		return defaultVal
+	case "true", "yes", "1":
+		return true
+	case "false", "no", "0":
+		return false
+	}
+	// Anything else has always meant false
+	in.invalid(name, val, "true or false", "reading it as false")
+	return false
 }
 
 func defaultPort(dbType DatabaseType) int {
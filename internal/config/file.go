@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${NAME} in config file values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// readConfigFile reads the YAML config file at path. Top-level settings use
+// the environment variable names in lower case (retention_days: 7), except
+// for the databases list and drill_checks, which are written out in YAML
+// rather than as JSON strings. ${NAME} in any value is replaced by the
+// environment variable NAME, so secrets can stay out of the file.
+func readConfigFile(path string) (inputs, error) {
+	in := inputs{file: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return in, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return in, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return in, nil // empty file
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return in, fmt.Errorf("invalid config file %s: expected a mapping of settings", path)
+	}
+	if err := interpolate(doc); err != nil {
+		return in, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		name := strings.ToLower(strings.ReplaceAll(doc.Content[i].Value, "-", "_"))
+		value := doc.Content[i+1]
+
+		switch name {
+		case "databases":
+			if err := value.Decode(&in.databases); err != nil {
+				return in, fmt.Errorf("invalid config file %s: databases: %w", path, err)
+			}
+		case "drill_checks":
+			if err := value.Decode(&in.drillChecks); err != nil {
+				return in, fmt.Errorf("invalid config file %s: drill_checks: %w", path, err)
+			}
+		default:
+			if value.Kind != yaml.ScalarNode {
+				return in, fmt.Errorf("invalid config file %s: line %d: %s must be a single value", path, value.Line, name)
+			}
+			if value.ShortTag() == "!!null" {
+				continue
+			}
+			in.file[name] = strings.TrimSpace(value.Value)
+		}
+	}
+
+	return in, nil
+}
+
+// interpolate replaces ${NAME} in the scalar values under node with the
+// environment variable NAME. An unset variable is an error, so a missing
+// secret doesn't silently become an empty setting.
+func interpolate(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var missing string
+		expanded := envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return val
+		})
+		if missing != "" {
+			return fmt.Errorf("line %d: environment variable %s is not set", node.Line, missing)
+		}
+		if expanded != node.Value {
+			node.Value = expanded
+			// Let the substituted value decide an unquoted scalar's type, so
+			// retention_days: ${DAYS} is still a number
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		// Only values are interpolated, not keys
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolate(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, child := range node.Content {
+			if err := interpolate(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+// Problems lists every problem found in a configuration, so they can all be
+// fixed at once rather than one run at a time
+type Problems []*errors.ConfigError
+
+// Add records a problem with the setting named field
+func (p *Problems) Add(field, format string, args ...any) {
+	*p = append(*p, errors.NewConfigError(field, fmt.Sprintf(format, args...)))
+}
+
+func (p Problems) Error() string {
+	if len(p) == 1 {
+		return p[0].Error()
+	}
+
+	messages := make([]string, len(p))
+	for i, problem := range p {
+		messages[i] = problem.Error()
+	}
+	return fmt.Sprintf("%d configuration errors: %s", len(p), strings.Join(messages, "; "))
+}
+
+// err returns p as an error, or nil when there are no problems
+func (p Problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// DatabaseField names a setting of the i-th configured database
+func DatabaseField(i int, name string) string {
+	return fmt.Sprintf("databases[%d].%s", i, name)
+}
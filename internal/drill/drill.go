@@ -0,0 +1,161 @@
+package drill
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/restore"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+	"github.com/jorgepascosoto/auto-db-backups/internal/verify"
+)
+
+// Names of the checks reported around the user-defined sanity checks
+const (
+	CheckRestore = "restore"
+	CheckCleanup = "cleanup"
+)
+
+// dropTimeout bounds dropping the scratch database, which still runs when
+// the drill itself was cancelled
+const dropTimeout = 2 * time.Minute
+
+// Result describes one restore drill
+type Result struct {
+	Key             string
+	ScratchDatabase string
+	Checks          []verify.Check
+}
+
+// Passed reports whether no check failed
+func (r *Result) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Status == verify.StatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// Run restores the backup at key, a backup of db, into a new scratch
+// database on server, runs the sanity checks against it and drops it again.
+// The returned Result is never nil; the error summarizes what failed.
+func Run(ctx context.Context, backend storage.Backend, key string, db *config.DatabaseConfig, server ScratchServer, checks []config.DrillCheck, keys encrypt.Keys) (result *Result, err error) {
+	result = &Result{Key: key, ScratchDatabase: ScratchName(db.Name, time.Now())}
+
+	target, err := server.Create(ctx, result.ScratchDatabase)
+	if err != nil {
+		result.Checks = append(result.Checks, verify.Check{Name: CheckRestore, Status: verify.StatusFailed, Detail: err.Error()})
+		skipChecks(result, checks)
+		return result, fmt.Errorf("%s check failed: %w", CheckRestore, err)
+	}
+
+	// Always drop the scratch database, even if the drill was cancelled
+	defer func() {
+		dropCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dropTimeout)
+		defer cancel()
+
+		if dropErr := server.Drop(dropCtx, result.ScratchDatabase); dropErr != nil {
+			result.Checks = append(result.Checks, verify.Check{Name: CheckCleanup, Status: verify.StatusFailed, Detail: dropErr.Error()})
+			if err == nil {
+				err = fmt.Errorf("%s check failed: %w", CheckCleanup, dropErr)
+			}
+			return
+		}
+		result.Checks = append(result.Checks, verify.Check{Name: CheckCleanup, Status: verify.StatusPassed, Detail: "dropped " + result.ScratchDatabase})
+	}()
+
+	startTime := time.Now()
+	if err := restoreInto(ctx, backend, key, target, keys); err != nil {
+		result.Checks = append(result.Checks, verify.Check{Name: CheckRestore, Status: verify.StatusFailed, Detail: err.Error()})
+		skipChecks(result, checks)
+		return result, fmt.Errorf("%s check failed: %w", CheckRestore, err)
+	}
+	result.Checks = append(result.Checks, verify.Check{
+		Name:   CheckRestore,
+		Status: verify.StatusPassed,
+		Detail: fmt.Sprintf("restored into %s in %s", result.ScratchDatabase, time.Since(startTime).Round(time.Second)),
+	})
+
+	var failed int
+	for _, check := range checks {
+		output, queryErr := server.Query(ctx, target, check.Query)
+		detail, checkErr := "", queryErr
+		if queryErr == nil {
+			detail, checkErr = evaluate(check, output)
+		}
+		if checkErr != nil {
+			result.Checks = append(result.Checks, verify.Check{Name: check.Name, Status: verify.StatusFailed, Detail: checkErr.Error()})
+			failed++
+			continue
+		}
+		result.Checks = append(result.Checks, verify.Check{Name: check.Name, Status: verify.StatusPassed, Detail: detail})
+	}
+
+	if failed > 0 {
+		return result, fmt.Errorf("%d of %d sanity checks failed", failed, len(checks))
+	}
+
+	return result, nil
+}
+
+func restoreInto(ctx context.Context, backend storage.Backend, key string, target *config.DatabaseConfig, keys encrypt.Keys) error {
+	importer, err := restore.NewImporter(target)
+	if err != nil {
+		return fmt.Errorf("failed to create importer: %w", err)
+	}
+
+	reader, err := restore.Open(ctx, backend, key, keys)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return importer.Import(ctx, reader)
+}
+
+func skipChecks(result *Result, checks []config.DrillCheck) {
+	for _, check := range checks {
+		result.Checks = append(result.Checks, verify.Check{Name: check.Name, Status: verify.StatusSkipped, Detail: "not reached"})
+	}
+}
+
+// evaluate parses the single number a sanity query returned and checks it
+// against the thresholds
+func evaluate(check config.DrillCheck, output string) (string, error) {
+	// Tools may print notices before the result, so use the last line
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+
+	value, err := strconv.ParseFloat(last, 64)
+	if err != nil {
+		return "", fmt.Errorf("query returned %q, expected a single number", last)
+	}
+
+	if check.Min != nil && value < *check.Min {
+		return "", fmt.Errorf("got %s, below the minimum of %s", formatNumber(value), formatNumber(*check.Min))
+	}
+	if check.Max != nil && value > *check.Max {
+		return "", fmt.Errorf("got %s, above the maximum of %s", formatNumber(value), formatNumber(*check.Max))
+	}
+
+	var bounds []string
+	if check.Min != nil {
+		bounds = append(bounds, "min "+formatNumber(*check.Min))
+	}
+	if check.Max != nil {
+		bounds = append(bounds, "max "+formatNumber(*check.Max))
+	}
+	if len(bounds) == 0 {
+		return formatNumber(value), nil
+	}
+	return fmt.Sprintf("%s (%s)", formatNumber(value), strings.Join(bounds, ", ")), nil
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,78 @@
+package drill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type MongoDBScratch struct {
+	admin *config.DatabaseConfig
+}
+
+func NewMongoDBScratch(admin *config.DatabaseConfig) *MongoDBScratch {
+	return &MongoDBScratch{admin: admin}
+}
+
+// Create returns the target without touching the server: mongorestore
+// creates the database. The connection string is kept as is since its
+// database also selects where to authenticate; the restore and queries
+// address the scratch database by name instead.
+func (s *MongoDBScratch) Create(ctx context.Context, name string) (*config.DatabaseConfig, error) {
+	target := *s.admin
+	target.Name = name
+	return &target, nil
+}
+
+// Query evaluates a mongosh expression, such as db.users.countDocuments(),
+// with db set to the target database
+func (s *MongoDBScratch) Query(ctx context.Context, target *config.DatabaseConfig, query string) (string, error) {
+	return s.mongosh(ctx, fmt.Sprintf("db = db.getSiblingDB(%q); %s", target.Name, query))
+}
+
+func (s *MongoDBScratch) Drop(ctx context.Context, name string) error {
+	if _, err := s.mongosh(ctx, fmt.Sprintf("db.getSiblingDB(%q).dropDatabase()", name)); err != nil {
+		return fmt.Errorf("failed to drop scratch database: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoDBScratch) mongosh(ctx context.Context, script string) (string, error) {
+	cmd := exec.CommandContext(ctx, "mongosh", buildMongoshArgs(s.admin, script)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("mongosh failed: %w: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func buildMongoshArgs(db *config.DatabaseConfig, script string) []string {
+	var args []string
+
+	// If connection string is provided, use it
+	if db.ConnectionString != "" {
+		args = append(args, db.ConnectionString)
+	} else {
+		args = append(args,
+			fmt.Sprintf("--host=%s", db.Host),
+			fmt.Sprintf("--port=%d", db.Port),
+		)
+		if db.User != "" {
+			args = append(args, fmt.Sprintf("--username=%s", db.User))
+		}
+		if db.Password != "" {
+			args = append(args, fmt.Sprintf("--password=%s", db.Password))
+		}
+	}
+
+	return append(args, "--quiet", "--eval", script)
+}
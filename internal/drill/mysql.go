@@ -0,0 +1,77 @@
+package drill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type MySQLScratch struct {
+	admin *config.DatabaseConfig
+}
+
+func NewMySQLScratch(admin *config.DatabaseConfig) *MySQLScratch {
+	return &MySQLScratch{admin: admin}
+}
+
+func (s *MySQLScratch) Create(ctx context.Context, name string) (*config.DatabaseConfig, error) {
+	if _, err := s.mysql(ctx, s.admin, fmt.Sprintf("CREATE DATABASE `%s`", name)); err != nil {
+		return nil, fmt.Errorf("failed to create scratch database: %w", err)
+	}
+	return withDatabase(s.admin, name)
+}
+
+func (s *MySQLScratch) Query(ctx context.Context, target *config.DatabaseConfig, query string) (string, error) {
+	return s.mysql(ctx, target, query)
+}
+
+func (s *MySQLScratch) Drop(ctx context.Context, name string) error {
+	if _, err := s.mysql(ctx, s.admin, fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", name)); err != nil {
+		return fmt.Errorf("failed to drop scratch database: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLScratch) mysql(ctx context.Context, db *config.DatabaseConfig, sql string) (string, error) {
+	cmd := exec.CommandContext(ctx, "mysql", buildMySQLArgs(db, sql)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("mysql failed: %w: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func buildMySQLArgs(db *config.DatabaseConfig, sql string) []string {
+	// mysql doesn't accept connection URLs, so always pass components
+	args := []string{
+		"--batch",
+		"--skip-column-names",
+		fmt.Sprintf("--host=%s", db.Host),
+		fmt.Sprintf("--port=%d", db.Port),
+	}
+
+	if db.User != "" {
+		args = append(args, fmt.Sprintf("--user=%s", db.User))
+	}
+
+	if db.Password != "" {
+		args = append(args, fmt.Sprintf("--password=%s", db.Password))
+	}
+
+	args = append(args, "--execute="+sql)
+
+	if db.Name != "" {
+		args = append(args, db.Name)
+	}
+
+	return args
+}
@@ -0,0 +1,86 @@
+package drill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type PostgresScratch struct {
+	admin *config.DatabaseConfig
+}
+
+func NewPostgresScratch(admin *config.DatabaseConfig) *PostgresScratch {
+	return &PostgresScratch{admin: admin}
+}
+
+func (s *PostgresScratch) Create(ctx context.Context, name string) (*config.DatabaseConfig, error) {
+	if _, err := s.psql(ctx, s.admin, fmt.Sprintf(`CREATE DATABASE "%s"`, name)); err != nil {
+		return nil, fmt.Errorf("failed to create scratch database: %w", err)
+	}
+	return withDatabase(s.admin, name)
+}
+
+func (s *PostgresScratch) Query(ctx context.Context, target *config.DatabaseConfig, query string) (string, error) {
+	return s.psql(ctx, target, query)
+}
+
+func (s *PostgresScratch) Drop(ctx context.Context, name string) error {
+	if _, err := s.psql(ctx, s.admin, fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, name)); err != nil {
+		return fmt.Errorf("failed to drop scratch database: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresScratch) psql(ctx context.Context, db *config.DatabaseConfig, sql string) (string, error) {
+	cmd := exec.CommandContext(ctx, "psql", buildPsqlArgs(db, sql)...)
+	cmd.Env = os.Environ()
+	if db.Password != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("PGPASSWORD=%s", db.Password))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("psql failed: %w: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func buildPsqlArgs(db *config.DatabaseConfig, sql string) []string {
+	// Print bare values and stop at the first error
+	args := []string{
+		"--no-psqlrc",
+		"--quiet",
+		"--tuples-only",
+		"--no-align",
+		"--set=ON_ERROR_STOP=1",
+		"--command=" + sql,
+	}
+
+	// If connection string is provided, use it directly
+	if db.ConnectionString != "" {
+		return append(args, "--dbname="+db.ConnectionString)
+	}
+
+	args = append(args,
+		"--no-password",
+		fmt.Sprintf("--host=%s", db.Host),
+		fmt.Sprintf("--port=%d", db.Port),
+		fmt.Sprintf("--dbname=%s", db.Name),
+	)
+
+	if db.User != "" {
+		args = append(args, fmt.Sprintf("--username=%s", db.User))
+	}
+
+	return args
+}
@@ -0,0 +1,78 @@
+package drill
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+// ScratchServer creates and drops the throwaway databases drills restore
+// into, and runs sanity queries against them
+type ScratchServer interface {
+	// Create creates an empty database and returns the config to restore into
+	Create(ctx context.Context, name string) (*config.DatabaseConfig, error)
+	// Query runs query against target and returns its trimmed output
+	Query(ctx context.Context, target *config.DatabaseConfig, query string) (string, error)
+	Drop(ctx context.Context, name string) error
+}
+
+// NewScratchServer returns the ScratchServer for the server admin connects to
+func NewScratchServer(admin *config.DatabaseConfig) (ScratchServer, error) {
+	switch admin.Type {
+	case config.DatabaseTypePostgres:
+		return NewPostgresScratch(admin), nil
+	case config.DatabaseTypeMySQL:
+		return NewMySQLScratch(admin), nil
+	case config.DatabaseTypeMongoDB:
+		return NewMongoDBScratch(admin), nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", admin.Type)
+	}
+}
+
+// maxScratchNameLen keeps ScratchName within the 63 character identifier
+// limit of PostgreSQL
+const maxScratchNameLen = 40
+
+// ScratchName returns the name of the scratch database for a drill of the
+// database named dbName started at t: drill_<name>_<timestamp>, using only
+// characters that need no quoting on any supported server
+func ScratchName(dbName string, t time.Time) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(dbName) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	name := sb.String()
+	if len(name) > maxScratchNameLen {
+		name = name[:maxScratchNameLen]
+	}
+
+	return fmt.Sprintf("drill_%s_%s", name, t.UTC().Format("20060102150405"))
+}
+
+// withDatabase returns a copy of admin that connects to the database name
+// instead, rewriting the connection string's path if there is one
+func withDatabase(admin *config.DatabaseConfig, name string) (*config.DatabaseConfig, error) {
+	target := *admin
+	target.Name = name
+
+	if admin.ConnectionString != "" {
+		u, err := url.Parse(admin.ConnectionString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection string: %w", err)
+		}
+		u.Path = "/" + name
+		u.RawPath = ""
+		target.ConnectionString = u.String()
+	}
+
+	return &target, nil
+}
@@ -1,9 +1,12 @@
 package encrypt
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 )
@@ -11,82 +14,235 @@ import (
 const (
 	NonceSize = 12 // GCM standard nonce size
 	KeySize   = 32 // AES-256
+	TagSize   = 16 // GCM authentication tag size
+
+	// Extension is appended to the names of encrypted backups
+	Extension = ".enc"
+
+	// Algorithm names the cipher in backup manifests
+	Algorithm = "AES-256-GCM"
 )
 
+// AESEncryptor encrypts each backup with its own random data key, which it
+// stores in the backup's header wrapped by a master key
 type AESEncryptor struct {
-	key []byte
+	wrapper KeyWrapper
 }
 
+// NewAESEncryptor returns an encryptor whose data keys are wrapped by key,
+// identified by its fingerprint
 func NewAESEncryptor(key []byte) (*AESEncryptor, error) {
-	if len(key) != KeySize {
-		return nil, fmt.Errorf("key must be exactly %d bytes, got %d", KeySize, len(key))
+	wrapper, err := NewLocalKeyWrapper("", key)
+	if err != nil {
+		return nil, err
 	}
-	return &AESEncryptor{key: key}, nil
+	return &AESEncryptor{wrapper: wrapper}, nil
 }
 
+// NewEnvelopeEncryptor returns an encryptor whose data keys are wrapped by
+// wrapper
+func NewEnvelopeEncryptor(wrapper KeyWrapper) *AESEncryptor {
+	return &AESEncryptor{wrapper: wrapper}
+}
+
+// Encrypt encrypts r with a new data key using the chunked stream format
+// (see stream.go), holding at most one chunk in memory
 func (e *AESEncryptor) Encrypt(r io.Reader) (io.ReadCloser, error) {
-	block, err := aes.NewCipher(e.key)
+	dataKey, err := newDataKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
-
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(dataKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	wrapped, err := e.wrapper.Wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	header, err := newEnvelopeHeader(e.wrapper.KeyID(), wrapped)
+	if err != nil {
+		return nil, err
 	}
 
 	pr, pw := io.Pipe()
 
 	go func() {
-		// Write nonce first (unencrypted, prepended to ciphertext)
-		if _, err := pw.Write(nonce); err != nil {
+		if err := encryptStream(pw, r, gcm, header); err != nil {
 			pw.CloseWithError(err)
 			return
 		}
+		pw.Close()
+	}()
+
+	return pr, nil
+}
+
+func (e *AESEncryptor) Extension() string {
+	return Extension
+}
+
+func (e *AESEncryptor) Algorithm() string {
+	return Algorithm
+}
 
-		// Read all data (AES-GCM needs complete data for authentication tag)
-		plaintext, err := io.ReadAll(r)
+// KeyID returns the ID of the master key written to the stream header, by
+// default a short fingerprint of it, so backups can record which key
+// encrypted them without revealing it
+func (e *AESEncryptor) KeyID() string {
+	return e.wrapper.KeyID()
+}
+
+// Wrapper returns the wrapper that protects the data keys of new backups
+func (e *AESEncryptor) Wrapper() KeyWrapper {
+	return e.wrapper
+}
+
+// Fingerprint returns a short, non-reversible identifier of key
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Decrypt decrypts data encrypted with Encrypt. Streams written before
+// envelope encryption, which the master key encrypted directly, and the
+// legacy format (12-byte nonce followed by a single GCM ciphertext) are
+// accepted too; only the legacy format can't be decrypted in constant
+// memory.
+func (e *AESEncryptor) Decrypt(r io.Reader) (io.ReadCloser, error) {
+	return decrypt(r, func(string) ([]KeyWrapper, error) {
+		return []KeyWrapper{e.wrapper}, nil
+	})
+}
+
+// keySource returns the master keys to try on a stream whose header names
+// the key keyID, which is empty for streams that name none
+type keySource func(keyID string) ([]KeyWrapper, error)
+
+// decrypt decrypts r with whichever of the keys from keys it was encrypted
+// with
+func decrypt(r io.Reader, keys keySource) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(streamHeaderLen)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if !isStreamFormat(prefix) {
+		candidates, err := keys("")
 		if err != nil {
-			pw.CloseWithError(fmt.Errorf("failed to read plaintext: %w", err))
-			return
+			return nil, err
+		}
+		secrets, err := secretsOf(candidates)
+		if err != nil {
+			return nil, err
+		}
+		return decryptLegacy(br, secrets)
+	}
+
+	header, raw, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := keys(header.keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var gcm cipher.AEAD
+	chunks := br
+	if header.version == streamVersion3 {
+		gcm, err = unwrapDataKey(candidates, header.wrappedKey)
+	} else {
+		var secrets [][]byte
+		if secrets, err = secretsOf(candidates); err == nil {
+			gcm, chunks, err = selectKey(br, secrets, header, raw)
 		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		// Encrypt and write
-		ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
-		if _, err := pw.Write(ciphertext); err != nil {
+	pr, pw := io.Pipe()
+	go func() {
+		if err := decryptStream(pw, chunks, gcm, header, raw); err != nil {
 			pw.CloseWithError(err)
 			return
 		}
-
 		pw.Close()
 	}()
 
 	return pr, nil
 }
 
-func (e *AESEncryptor) Extension() string {
-	return ".enc"
+// unwrapDataKey returns the cipher for the data key wrapped, unwrapping it
+// with whichever of wrappers wrapped it
+func unwrapDataKey(wrappers []KeyWrapper, wrapped []byte) (cipher.AEAD, error) {
+	for _, wrapper := range wrappers {
+		dataKey, err := wrapper.Unwrap(wrapped)
+		if err != nil {
+			if len(wrappers) == 1 {
+				return nil, err
+			}
+			continue
+		}
+		if len(dataKey) != KeySize {
+			return nil, fmt.Errorf("unwrapped data key is %d bytes, expected %d", len(dataKey), KeySize)
+		}
+		return newGCM(dataKey)
+	}
+	return nil, fmt.Errorf("none of the %d keys decrypts this backup", len(wrappers))
 }
 
-// Decrypt decrypts data encrypted with Encrypt
-func (e *AESEncryptor) Decrypt(r io.Reader) (io.ReadCloser, error) {
-	block, err := aes.NewCipher(e.key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+// secretsOf returns the master keys of wrappers, which streams written
+// before envelope encryption were encrypted with directly
+func secretsOf(wrappers []KeyWrapper) ([][]byte, error) {
+	secrets := make([][]byte, 0, len(wrappers))
+	for _, wrapper := range wrappers {
+		local, ok := wrapper.(interface{ secret() []byte })
+		if !ok {
+			return nil, fmt.Errorf("backup predates envelope encryption and needs key %q itself, not a wrapper", wrapper.KeyID())
+		}
+		secrets = append(secrets, local.secret())
 	}
+	return secrets, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// selectKey returns the cipher for whichever of keys sealed the stream's
+// first chunk, and the chunks to decrypt with it. A single key is returned
+// as is, so a wrong key fails while decrypting like any other damage.
+func selectKey(r *bufio.Reader, keys [][]byte, h *streamHeader, header []byte) (cipher.AEAD, *bufio.Reader, error) {
+	if len(keys) == 1 {
+		gcm, err := newGCM(keys[0])
+		return gcm, r, err
+	}
+
+	first := make([]byte, int(h.chunkSize)+TagSize)
+	n, final, err := readChunk(r, first)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, nil, err
+	}
+	first = first[:n]
+	chunks := bufio.NewReader(io.MultiReader(bytes.NewReader(first), r))
+
+	for _, key := range keys {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := gcm.Open(nil, h.nonce(0, final), first, header); err == nil {
+			return gcm, chunks, nil
+		}
 	}
+	return nil, nil, fmt.Errorf("none of the %d keys decrypts this backup", len(keys))
+}
 
+// decryptLegacy decrypts the original whole-file format, which has to be
+// read completely before the authentication tag can be checked
+func decryptLegacy(r io.Reader, keys [][]byte) (io.ReadCloser, error) {
 	// Read nonce first
-	nonce := make([]byte, gcm.NonceSize())
+	nonce := make([]byte, NonceSize)
 	if _, err := io.ReadFull(r, nonce); err != nil {
 		return nil, fmt.Errorf("failed to read nonce: %w", err)
 	}
@@ -97,17 +253,33 @@ func (e *AESEncryptor) Decrypt(r io.Reader) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("failed to read ciphertext: %w", err)
 	}
 
-	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	// Decrypt with whichever key authenticates it
+	for _, key := range keys {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+		if err == nil {
+			return io.NopCloser(bytes.NewReader(plaintext)), nil
+		}
+		if len(keys) == 1 {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("none of the %d keys decrypts this backup", len(keys))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
-	pr, pw := io.Pipe()
-	go func() {
-		pw.Write(plaintext)
-		pw.Close()
-	}()
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
 
-	return pr, nil
+	return gcm, nil
 }
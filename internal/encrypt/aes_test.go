@@ -2,6 +2,8 @@ package encrypt
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"io"
 	"strings"
@@ -37,7 +39,7 @@ func TestNewAESEncryptor_ValidKey(t *testing.T) {
 
 	require.NoError(t, err)
 	require.NotNil(t, encryptor)
-	assert.Equal(t, key, encryptor.key)
+	assert.Equal(t, Fingerprint(key), encryptor.KeyID())
 }
 
 func TestNewAESEncryptor_InvalidKeySize(t *testing.T) {
@@ -78,6 +80,19 @@ func TestAESEncryptor_Extension(t *testing.T) {
 	assert.Equal(t, ".enc", encryptor.Extension())
 }
 
+func TestAESEncryptor_KeyID(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+	other, err := NewAESEncryptor(make([]byte, KeySize))
+	require.NoError(t, err)
+
+	assert.Len(t, encryptor.KeyID(), 16)
+	assert.Equal(t, encryptor.KeyID(), encryptor.KeyID())
+	assert.NotEqual(t, encryptor.KeyID(), other.KeyID())
+}
+
 func TestAESEncryptor_EncryptDecrypt_SmallData(t *testing.T) {
 	t.Parallel()
 
@@ -542,3 +557,238 @@ func BenchmarkAESEncryptor_EncryptDecrypt_LargeData(b *testing.B) {
 		decReader.Close()
 	}
 }
+
+// encryptAll encrypts data and returns the full ciphertext
+func encryptAll(t *testing.T, encryptor Encryptor, data []byte) []byte {
+	t.Helper()
+	encryptedReader, err := encryptor.Encrypt(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer encryptedReader.Close()
+
+	encryptedData, err := io.ReadAll(encryptedReader)
+	require.NoError(t, err)
+	return encryptedData
+}
+
+// encryptDirect encrypts data with key itself rather than a data key, as
+// streams were before envelope encryption: version 1, or version 2 when
+// keyID is set
+func encryptDirect(t *testing.T, key []byte, keyID string, data []byte) []byte {
+	t.Helper()
+	gcm, err := newGCM(key)
+	require.NoError(t, err)
+	header, err := newStreamHeader(keyID)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, encryptStream(&buf, bytes.NewReader(data), gcm, header))
+	return buf.Bytes()
+}
+
+// headerLen returns the length of the stream header data starts with
+func headerLen(t *testing.T, data []byte) int {
+	t.Helper()
+	r := bytes.NewReader(data)
+	_, _, err := readStreamHeader(r)
+	require.NoError(t, err)
+	return len(data) - r.Len()
+}
+
+// decrypter is an AESEncryptor, a Keyring or AgeIdentities
+type decrypter interface {
+	Decrypt(r io.Reader) (io.ReadCloser, error)
+}
+
+// decryptAll decrypts data, returning an error from either Decrypt or reading
+func decryptAll(encryptor decrypter, data []byte) ([]byte, error) {
+	decryptedReader, err := encryptor.Decrypt(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer decryptedReader.Close()
+	return io.ReadAll(decryptedReader)
+}
+
+// Tests for the chunked stream format
+func TestAESEncryptor_StreamFormat_Header(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	encryptedData := encryptAll(t, encryptor, []byte("hello"))
+
+	require.GreaterOrEqual(t, len(encryptedData), streamHeaderLen)
+	assert.Equal(t, streamMagic, string(encryptedData[:4]))
+	assert.Equal(t, streamVersion3, encryptedData[4])
+
+	// The header names the master key and carries the data key it wrapped
+	header, _, err := readStreamHeader(bytes.NewReader(encryptedData))
+	require.NoError(t, err)
+	assert.Equal(t, encryptor.KeyID(), header.keyID)
+	assert.Len(t, header.wrappedKey, NonceSize+KeySize+TagSize)
+
+	// Header + one final chunk (plaintext + GCM tag)
+	assert.Len(t, encryptedData, headerLen(t, encryptedData)+len("hello")+16)
+}
+
+func TestAESEncryptor_DataKeyPerStream(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	first, _, err := readStreamHeader(bytes.NewReader(encryptAll(t, encryptor, []byte("data"))))
+	require.NoError(t, err)
+	second, _, err := readStreamHeader(bytes.NewReader(encryptAll(t, encryptor, []byte("data"))))
+	require.NoError(t, err)
+
+	dataKey1, err := encryptor.wrapper.Unwrap(first.wrappedKey)
+	require.NoError(t, err)
+	dataKey2, err := encryptor.wrapper.Unwrap(second.wrappedKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, dataKey1, dataKey2)
+	assert.NotEqual(t, generateValidKey(), dataKey1, "The master key must not encrypt data")
+}
+
+func TestAESEncryptor_DecryptsDirectlyEncryptedStreams(t *testing.T) {
+	t.Parallel()
+
+	key := generateValidKey()
+	encryptor, err := NewAESEncryptor(key)
+	require.NoError(t, err)
+
+	for _, keyID := range []string{"", "named"} {
+		data := bytes.Repeat([]byte("before envelopes "), DefaultChunkSize/8)
+		decrypted, err := decryptAll(encryptor, encryptDirect(t, key, keyID, data))
+		require.NoError(t, err, "key ID %q", keyID)
+		assert.Equal(t, data, decrypted)
+	}
+}
+
+func TestAESEncryptor_StreamFormat_ChunkBoundaries(t *testing.T) {
+	t.Parallel()
+
+	sizes := []int{
+		0,
+		1,
+		DefaultChunkSize - 1,
+		DefaultChunkSize,
+		DefaultChunkSize + 1,
+		3 * DefaultChunkSize,
+		3*DefaultChunkSize + 17,
+	}
+
+	encryptor, err := NewAESEncryptor(generateRandomKey(t))
+	require.NoError(t, err)
+
+	for _, size := range sizes {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		encryptedData := encryptAll(t, encryptor, data)
+		decrypted, err := decryptAll(encryptor, encryptedData)
+
+		require.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(data, decrypted), "size %d should round-trip", size)
+	}
+}
+
+func TestAESEncryptor_StreamFormat_TruncatedAtChunkBoundary(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("a"), 2*DefaultChunkSize+100)
+	encryptedData := encryptAll(t, encryptor, data)
+
+	// Drop the final chunk entirely, leaving only complete non-final chunks
+	n := headerLen(t, encryptedData)
+	truncated := encryptedData[:n+2*(DefaultChunkSize+16)]
+
+	_, err = decryptAll(encryptor, truncated)
+	assert.Error(t, err, "A stream missing its final chunk should fail")
+
+	// Drop everything after the header
+	_, err = decryptAll(encryptor, encryptedData[:n])
+	assert.Error(t, err, "A stream with no chunks should fail")
+}
+
+func TestAESEncryptor_StreamFormat_ReorderedChunks(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	data := append(bytes.Repeat([]byte("a"), DefaultChunkSize), bytes.Repeat([]byte("b"), DefaultChunkSize)...)
+	data = append(data, []byte("tail")...)
+	encryptedData := encryptAll(t, encryptor, data)
+
+	chunkLen := DefaultChunkSize + 16
+	n := headerLen(t, encryptedData)
+	first := encryptedData[n : n+chunkLen]
+	second := encryptedData[n+chunkLen : n+2*chunkLen]
+
+	swapped := append([]byte{}, encryptedData[:n]...)
+	swapped = append(swapped, second...)
+	swapped = append(swapped, first...)
+	swapped = append(swapped, encryptedData[n+2*chunkLen:]...)
+
+	_, err = decryptAll(encryptor, swapped)
+	assert.Error(t, err, "Reordered chunks should fail to authenticate")
+}
+
+func TestAESEncryptor_StreamFormat_TamperedHeader(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	encryptedData := encryptAll(t, encryptor, []byte("header is authenticated"))
+	encryptedData[streamHeaderLen-1] ^= 0x01 // flip a bit in the nonce prefix
+
+	_, err = decryptAll(encryptor, encryptedData)
+	assert.Error(t, err)
+}
+
+func TestAESEncryptor_StreamFormat_UnsupportedChunkSize(t *testing.T) {
+	t.Parallel()
+
+	encryptor, err := NewAESEncryptor(generateValidKey())
+	require.NoError(t, err)
+
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+	// Claim a chunk size larger than the decoder accepts
+	encryptedData[5], encryptedData[6], encryptedData[7], encryptedData[8] = 0xff, 0xff, 0xff, 0xff
+
+	_, err = decryptAll(encryptor, encryptedData)
+	assert.ErrorContains(t, err, "invalid chunk size")
+}
+
+func TestAESEncryptor_DecryptLegacyFormat(t *testing.T) {
+	t.Parallel()
+
+	key := generateValidKey()
+	encryptor, err := NewAESEncryptor(key)
+	require.NoError(t, err)
+
+	// Produce the original nonce + single GCM ciphertext format
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	nonce := make([]byte, NonceSize)
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+
+	originalData := []byte("backup written before the chunked format existed")
+	legacy := append(nonce, gcm.Seal(nil, nonce, originalData, nil)...)
+
+	decrypted, err := decryptAll(encryptor, legacy)
+
+	require.NoError(t, err)
+	assert.Equal(t, originalData, decrypted)
+}
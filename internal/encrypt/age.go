@@ -0,0 +1,109 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	// AgeExtension is appended to the names of backups encrypted to age
+	// recipients
+	AgeExtension = ".age"
+
+	// AgeAlgorithm names age recipient encryption in backup manifests
+	AgeAlgorithm = "age-X25519"
+)
+
+// AgeEncryptor encrypts backups to one or more X25519 public keys in the age
+// format, so whoever writes backups needs no key that can read them. Any of
+// the recipients' private keys decrypts, e.g. with `age -d -i key.txt`.
+type AgeEncryptor struct {
+	recipients []age.Recipient
+	keys       []string
+}
+
+// NewAgeEncryptor returns an encryptor for the age public keys in
+// recipients, e.g. "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+func NewAgeEncryptor(recipients []string) (*AgeEncryptor, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients")
+	}
+
+	e := &AgeEncryptor{}
+	for _, key := range recipients {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", key, err)
+		}
+		e.recipients = append(e.recipients, recipient)
+		e.keys = append(e.keys, recipient.String())
+	}
+	return e, nil
+}
+
+// Encrypt encrypts r to every recipient. age seals the data in 64 KiB
+// chunks, so like the AES format it streams in constant memory and
+// detects truncation.
+func (e *AgeEncryptor) Encrypt(r io.Reader) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		// age writes its header straight away, so this has to wait for the
+		// reader too
+		w, err := age.Encrypt(pw, e.recipients...)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to start age encryption: %w", err))
+			return
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+
+	return pr, nil
+}
+
+func (e *AgeEncryptor) Extension() string {
+	return AgeExtension
+}
+
+func (e *AgeEncryptor) Algorithm() string {
+	return AgeAlgorithm
+}
+
+// KeyID returns the recipients' public keys, which are safe to record
+func (e *AgeEncryptor) KeyID() string {
+	return strings.Join(e.keys, ",")
+}
+
+// AgeIdentities are the age private keys that decrypt backups encrypted to
+// their public keys
+type AgeIdentities struct {
+	identities []age.Identity
+}
+
+// ParseAgeIdentities reads private keys in the format of an age identity
+// file: one AGE-SECRET-KEY-1... per line, with # comments
+func ParseAgeIdentities(r io.Reader) (*AgeIdentities, error) {
+	identities, err := age.ParseIdentities(r)
+	if err != nil {
+		// The parse error may quote the line, which holds a private key
+		return nil, fmt.Errorf("invalid age identity: expected AGE-SECRET-KEY-1... lines")
+	}
+	return &AgeIdentities{identities: identities}, nil
+}
+
+// Decrypt decrypts an age file encrypted to any of the identities. Each
+// chunk is authenticated before it is returned.
+func (a *AgeIdentities) Decrypt(r io.Reader) (io.ReadCloser, error) {
+	decrypted, err := age.Decrypt(r, a.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return io.NopCloser(decrypted), nil
+}
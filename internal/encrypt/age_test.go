@@ -0,0 +1,157 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAgeKey returns a fresh age identity for testing
+func newAgeKey(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	return identity
+}
+
+func parseIdentities(t *testing.T, identities ...*age.X25519Identity) *AgeIdentities {
+	t.Helper()
+	var lines []string
+	for _, identity := range identities {
+		lines = append(lines, identity.String())
+	}
+	parsed, err := ParseAgeIdentities(strings.NewReader("# test keys\n" + strings.Join(lines, "\n")))
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestAgeEncryptor_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	identity := newAgeKey(t)
+	encryptor, err := NewAgeEncryptor([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+	assert.Equal(t, AgeExtension, encryptor.Extension())
+	assert.Equal(t, AgeAlgorithm, encryptor.Algorithm())
+	assert.Equal(t, identity.Recipient().String(), encryptor.KeyID())
+
+	for _, size := range []int{0, 10, 64 * 1024, 3*64*1024 + 7} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		encryptedData := encryptAll(t, encryptor, data)
+		assert.True(t, bytes.HasPrefix(encryptedData, []byte("age-encryption.org/v1\n")), "size %d should be an age file", size)
+
+		decrypted, err := decryptAll(parseIdentities(t, identity), encryptedData)
+		require.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(data, decrypted), "size %d should round-trip", size)
+	}
+}
+
+func TestAgeEncryptor_AnyRecipientDecrypts(t *testing.T) {
+	t.Parallel()
+
+	first, second := newAgeKey(t), newAgeKey(t)
+	encryptor, err := NewAgeEncryptor([]string{first.Recipient().String(), second.Recipient().String()})
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+
+	for _, identity := range []*age.X25519Identity{first, second} {
+		decrypted, err := decryptAll(parseIdentities(t, identity), encryptedData)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("data"), decrypted)
+	}
+
+	_, err = decryptAll(parseIdentities(t, newAgeKey(t)), encryptedData)
+	assert.Error(t, err, "Someone else's key should not decrypt")
+}
+
+func TestAgeEncryptor_Tampered(t *testing.T) {
+	t.Parallel()
+
+	identity := newAgeKey(t)
+	encryptor, err := NewAgeEncryptor([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, bytes.Repeat([]byte("x"), 1000))
+
+	tampered := bytes.Clone(encryptedData)
+	tampered[len(tampered)-20] ^= 0xff
+	_, err = decryptAll(parseIdentities(t, identity), tampered)
+	assert.Error(t, err)
+
+	// Truncation is detected too
+	_, err = decryptAll(parseIdentities(t, identity), encryptedData[:len(encryptedData)-10])
+	assert.Error(t, err)
+}
+
+func TestNewAgeEncryptor_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewAgeEncryptor(nil)
+	assert.ErrorContains(t, err, "no age recipients")
+
+	_, err = NewAgeEncryptor([]string{"age1notakey"})
+	assert.ErrorContains(t, err, `invalid age recipient "age1notakey"`)
+}
+
+func TestParseAgeIdentities_DoesNotEchoKeys(t *testing.T) {
+	t.Parallel()
+
+	secret := "AGE-SECRET-KEY-1NOTQUITEAKEY"
+	_, err := ParseAgeIdentities(strings.NewReader(secret))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), secret)
+}
+
+func TestKeys_Decrypt(t *testing.T) {
+	t.Parallel()
+
+	identity := newAgeKey(t)
+	encryptor, err := NewAgeEncryptor([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+
+	keys := Keys{AgeIdentities: parseIdentities(t, identity)}
+	assert.True(t, keys.CanDecrypt(AgeAlgorithm))
+	assert.False(t, keys.CanDecrypt(Algorithm))
+
+	decrypted, err := keys.Decrypt(bytes.NewReader(encryptedData), AgeAlgorithm)
+	require.NoError(t, err)
+	defer decrypted.Close()
+
+	_, err = keys.Decrypt(bytes.NewReader(encryptedData), Algorithm)
+	assert.ErrorContains(t, err, "no encryption key is configured")
+	_, err = Keys{}.Decrypt(bytes.NewReader(encryptedData), AgeAlgorithm)
+	assert.ErrorContains(t, err, "no age identity is configured")
+	_, err = keys.Decrypt(bytes.NewReader(encryptedData), "ROT13")
+	assert.ErrorContains(t, err, `unsupported encryption "ROT13"`)
+}
+
+func TestByExtension(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		algorithm string
+		ext       string
+	}{
+		{"mysql-app-20240115-140532.sql.gz.enc", Algorithm, Extension},
+		{"mysql-app-20240115-140532.sql.gz.age", AgeAlgorithm, AgeExtension},
+		{"mysql-app-20240115-140532.sql.gz", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			algorithm, ext := ByExtension(tt.name)
+			assert.Equal(t, tt.algorithm, algorithm)
+			assert.Equal(t, tt.ext, ext)
+		})
+	}
+}
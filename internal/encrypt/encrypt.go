@@ -0,0 +1,96 @@
+package encrypt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Encryptor encrypts backups in one of the supported formats
+type Encryptor interface {
+	Encrypt(r io.Reader) (io.ReadCloser, error)
+	// Extension is appended to the names of encrypted backups
+	Extension() string
+	// Algorithm names the format in backup manifests
+	Algorithm() string
+	// KeyID identifies the key without revealing it
+	KeyID() string
+}
+
+// ByExtension returns the encryption algorithm a file name's extension
+// stands for and the extension itself, or empty strings if the name has no
+// encryption extension
+func ByExtension(name string) (algorithm, ext string) {
+	switch {
+	case strings.HasSuffix(name, Extension):
+		return Algorithm, Extension
+	case strings.HasSuffix(name, AgeExtension):
+		return AgeAlgorithm, AgeExtension
+	default:
+		return "", ""
+	}
+}
+
+// Keys holds what decrypts backups, per format. Any may be nil.
+type Keys struct {
+	Keyring       *Keyring           // AES-256-GCM backups
+	Passphrase    *PassphraseWrapper // AES-256-GCM backups whose key was derived from a passphrase
+	AgeIdentities *AgeIdentities     // age backups
+}
+
+// Decrypt returns a reader that decrypts r, encrypted with the named
+// algorithm
+func (k Keys) Decrypt(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case Algorithm:
+		if k.Keyring == nil && k.Passphrase == nil {
+			return nil, fmt.Errorf("backup is encrypted but no encryption key is configured")
+		}
+		return decrypt(r, k.aesWrappers)
+	case AgeAlgorithm:
+		if k.AgeIdentities == nil {
+			return nil, fmt.Errorf("backup is encrypted to age recipients but no age identity is configured")
+		}
+		return k.AgeIdentities.Decrypt(r)
+	default:
+		return nil, fmt.Errorf("backup uses unsupported encryption %q", algorithm)
+	}
+}
+
+// CanDecrypt reports whether k holds keys for the named algorithm
+func (k Keys) CanDecrypt(algorithm string) bool {
+	switch algorithm {
+	case Algorithm:
+		return k.Keyring != nil || k.Passphrase != nil
+	case AgeAlgorithm:
+		return k.AgeIdentities != nil
+	default:
+		return false
+	}
+}
+
+// Rewrap returns the AES stream in r with its data key rewrapped by to,
+// whichever of k's keys wrapped it before. Like Keyring.Rewrap, it returns
+// ErrNotEnvelope for streams whose data can only be re-encrypted.
+func (k Keys) Rewrap(r *bufio.Reader, to KeyWrapper) (io.Reader, error) {
+	if k.Keyring == nil && k.Passphrase == nil {
+		return nil, fmt.Errorf("backup is encrypted but no encryption key is configured")
+	}
+	return rewrap(r, k.aesWrappers, to)
+}
+
+// aesWrappers is the keySource for AES backups: the passphrase for backups
+// that name it, and the keyring for the rest
+func (k Keys) aesWrappers(keyID string) ([]KeyWrapper, error) {
+	switch {
+	case keyID == PassphraseKeyID && k.Passphrase == nil:
+		return nil, fmt.Errorf("backup was encrypted with a passphrase, but no passphrase is configured")
+	case keyID == PassphraseKeyID:
+		return []KeyWrapper{k.Passphrase}, nil
+	case k.Keyring != nil:
+		return k.Keyring.wrappers(keyID)
+	default:
+		return nil, fmt.Errorf("backup was encrypted with key %q, but only a passphrase is configured", keyID)
+	}
+}
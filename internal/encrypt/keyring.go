@@ -0,0 +1,234 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotEnvelope is returned by Rewrap for streams written before envelope
+// encryption, whose data can only be re-encrypted
+var ErrNotEnvelope = stderrors.New("backup was not envelope encrypted")
+
+// Key is an encryption key and the ID that backups encrypted with it record
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds every key backups may have been encrypted with. New backups
+// are encrypted with the active key; any of the keys decrypts.
+type Keyring struct {
+	keys   []Key
+	active int
+}
+
+// NewKeyring returns a keyring of keys with the key named active as the
+// active one. active may be empty when there is only one key.
+func NewKeyring(keys []Key, active string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring has no keys")
+	}
+
+	k := &Keyring{keys: keys, active: -1}
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("key %d has no ID", i+1)
+		}
+		if len(key.ID) > MaxKeyIDLen {
+			return nil, fmt.Errorf("key ID %q is longer than %d bytes", key.ID, MaxKeyIDLen)
+		}
+		if key.ID == PassphraseKeyID {
+			return nil, fmt.Errorf("key ID %q is reserved for passphrase-encrypted backups", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("key ID %q is used more than once", key.ID)
+		}
+		seen[key.ID] = true
+		if len(key.Secret) != KeySize {
+			return nil, fmt.Errorf("key %q must be exactly %d bytes, got %d", key.ID, KeySize, len(key.Secret))
+		}
+		if key.ID == active {
+			k.active = i
+		}
+	}
+
+	switch {
+	case active == "" && len(keys) == 1:
+		k.active = 0
+	case active == "":
+		return nil, fmt.Errorf("the active key must be named when there are %d keys", len(keys))
+	case k.active < 0:
+		return nil, fmt.Errorf("active key %q is not in the keyring", active)
+	}
+
+	return k, nil
+}
+
+// Active returns the key new backups are encrypted with
+func (k *Keyring) Active() Key {
+	return k.keys[k.active]
+}
+
+// Keys returns every key, active or not
+func (k *Keyring) Keys() []Key {
+	return k.keys
+}
+
+// WithActive returns a copy of the keyring with key added as the active key,
+// replacing any key with the same ID
+func (k *Keyring) WithActive(key Key) *Keyring {
+	keys := []Key{key}
+	for _, existing := range k.keys {
+		if existing.ID != key.ID {
+			keys = append(keys, existing)
+		}
+	}
+	return &Keyring{keys: keys, active: 0}
+}
+
+// IsActive reports whether a backup whose header names keyID was encrypted
+// with the active key
+func (k *Keyring) IsActive(keyID string) bool {
+	key, ok := k.find(keyID)
+	return ok && key.ID == k.Active().ID
+}
+
+// Encryptor returns an encryptor whose data keys are wrapped by the active
+// key, which writes its ID to every backup it encrypts
+func (k *Keyring) Encryptor() (*AESEncryptor, error) {
+	wrapper, err := wrapperOf(k.Active())
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelopeEncryptor(wrapper), nil
+}
+
+// Decrypt decrypts r with the key its header names. Backups that name no
+// key, written before key IDs existed, are decrypted with whichever key
+// authenticates them.
+func (k *Keyring) Decrypt(r io.Reader) (io.ReadCloser, error) {
+	return decrypt(r, k.wrappers)
+}
+
+// wrappers is the keySource of the keyring
+func (k *Keyring) wrappers(keyID string) ([]KeyWrapper, error) {
+	if keyID == "" {
+		wrappers := make([]KeyWrapper, len(k.keys))
+		for i, key := range k.keys {
+			wrapper, err := wrapperOf(key)
+			if err != nil {
+				return nil, err
+			}
+			wrappers[i] = wrapper
+		}
+		return wrappers, nil
+	}
+
+	wrapper, err := k.wrapperFor(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return []KeyWrapper{wrapper}, nil
+}
+
+// Rewrap returns the stream in r with its data key rewrapped by the active
+// key, leaving the encrypted data as it is, so rotating a key rewrites a
+// header rather than every byte of the backup. It returns ErrNotEnvelope,
+// having consumed nothing, for streams whose data the old key encrypted
+// directly.
+func (k *Keyring) Rewrap(r *bufio.Reader) (io.Reader, error) {
+	active, err := wrapperOf(k.Active())
+	if err != nil {
+		return nil, err
+	}
+	return rewrap(r, k.wrappers, active)
+}
+
+// rewrap returns the stream in r with its data key, unwrapped by whichever
+// key from keys wrapped it, wrapped by to instead
+func rewrap(r *bufio.Reader, keys keySource, to KeyWrapper) (io.Reader, error) {
+	prefix, err := r.Peek(streamHeaderLen)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !isStreamFormat(prefix) || prefix[len(streamMagic)] != streamVersion3 {
+		return nil, ErrNotEnvelope
+	}
+
+	header, _, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	wrappers, err := keys(header.keyID)
+	if err != nil {
+		return nil, err
+	}
+	var dataKey []byte
+	for _, wrapper := range wrappers {
+		if dataKey, err = wrapper.Unwrap(header.wrappedKey); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if header.wrappedKey, err = to.Wrap(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	header.keyID = to.KeyID()
+
+	return io.MultiReader(bytes.NewReader(header.marshal()), r), nil
+}
+
+// wrapperFor returns the wrapper for the key named keyID
+func (k *Keyring) wrapperFor(keyID string) (*LocalKeyWrapper, error) {
+	key, ok := k.find(keyID)
+	if !ok {
+		return nil, fmt.Errorf("backup was encrypted with key %q, which is not in the keyring", keyID)
+	}
+	return wrapperOf(key)
+}
+
+func wrapperOf(key Key) (*LocalKeyWrapper, error) {
+	return NewLocalKeyWrapper(key.ID, key.Secret)
+}
+
+// find returns the key named keyID, matching its fingerprint too so that
+// backups keep decrypting after a key is given a different ID
+func (k *Keyring) find(keyID string) (Key, bool) {
+	for _, key := range k.keys {
+		if key.ID == keyID {
+			return key, true
+		}
+	}
+	for _, key := range k.keys {
+		if Fingerprint(key.Secret) == keyID {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// HeaderKeyID returns the key ID in the header of an encrypted stream
+// without consuming it, or "" if the stream names no key
+func HeaderKeyID(r *bufio.Reader) (string, error) {
+	prefix, err := r.Peek(streamHeaderLen + 1)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read header: %w", err)
+	}
+	if !isStreamFormat(prefix) || prefix[len(streamMagic)] == streamVersion1 || len(prefix) <= streamHeaderLen {
+		return "", nil
+	}
+
+	length := int(prefix[streamHeaderLen])
+	header, err := r.Peek(streamHeaderLen + 1 + length)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %w", err)
+	}
+	return string(header[streamHeaderLen+1:]), nil
+}
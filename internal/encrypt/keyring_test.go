@@ -0,0 +1,247 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyring(t *testing.T, active string, keys ...Key) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(keys, active)
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestNewKeyring_Invalid(t *testing.T) {
+	t.Parallel()
+
+	key := generateValidKey()
+	tests := []struct {
+		name     string
+		keys     []Key
+		active   string
+		expected string
+	}{
+		{"no keys", nil, "", "keyring has no keys"},
+		{"missing ID", []Key{{Secret: key}}, "", "key 1 has no ID"},
+		{"duplicate ID", []Key{{ID: "a", Secret: key}, {ID: "a", Secret: key}}, "a", `key ID "a" is used more than once`},
+		{"short key", []Key{{ID: "a", Secret: key[:16]}}, "", `key "a" must be exactly 32 bytes`},
+		{"unnamed active", []Key{{ID: "a", Secret: key}, {ID: "b", Secret: key}}, "", "the active key must be named"},
+		{"unknown active", []Key{{ID: "a", Secret: key}}, "b", `active key "b" is not in the keyring`},
+		{"reserved ID", []Key{{ID: PassphraseKeyID, Secret: key}}, "", `key ID "passphrase" is reserved for passphrase-encrypted backups`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewKeyring(tt.keys, tt.active)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestKeyring_EncryptWritesActiveKeyID(t *testing.T) {
+	t.Parallel()
+
+	keyring := newTestKeyring(t, "2025", Key{ID: "2024", Secret: generateRandomKey(t)}, Key{ID: "2025", Secret: generateRandomKey(t)})
+	encryptor, err := keyring.Encryptor()
+	require.NoError(t, err)
+	assert.Equal(t, "2025", encryptor.KeyID())
+
+	encryptedData := encryptAll(t, encryptor, []byte("hello"))
+	assert.Equal(t, streamVersion3, encryptedData[len(streamMagic)])
+
+	keyID, err := HeaderKeyID(bufio.NewReader(bytes.NewReader(encryptedData)))
+	require.NoError(t, err)
+	assert.Equal(t, "2025", keyID)
+	assert.True(t, keyring.IsActive(keyID))
+	assert.False(t, keyring.IsActive("2024"))
+}
+
+func TestKeyring_DecryptsWithTheNamedKey(t *testing.T) {
+	t.Parallel()
+
+	old := Key{ID: "old", Secret: generateRandomKey(t)}
+	current := Key{ID: "new", Secret: generateRandomKey(t)}
+	data := bytes.Repeat([]byte("rotated "), DefaultChunkSize)
+
+	before := newTestKeyring(t, "", old)
+	encryptor, err := before.Encryptor()
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, data)
+
+	// After rotating, the old backup still decrypts with the key it names
+	after := newTestKeyring(t, "new", current, old)
+	decrypted, err := decryptAll(after, encryptedData)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	// A keyring without that key says which key is missing
+	_, err = decryptAll(newTestKeyring(t, "", current), encryptedData)
+	assert.ErrorContains(t, err, `encrypted with key "old", which is not in the keyring`)
+}
+
+func TestKeyring_DecryptsBackupsWithoutKeyID(t *testing.T) {
+	t.Parallel()
+
+	old := generateRandomKey(t)
+	keyring := newTestKeyring(t, "new", Key{ID: "new", Secret: generateRandomKey(t)}, Key{ID: "old", Secret: old})
+
+	for _, size := range []int{0, 10, DefaultChunkSize, 2*DefaultChunkSize + 5} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		// Version 1 streams, written before key IDs existed
+		decrypted, err := decryptAll(keyring, encryptDirect(t, old, "", data))
+		require.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(data, decrypted), "size %d should round-trip", size)
+	}
+
+	// The legacy whole-file format
+	block, err := aes.NewCipher(old)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, NonceSize)
+	legacy := append(nonce, gcm.Seal(nil, nonce, []byte("legacy"), nil)...)
+
+	decrypted, err := decryptAll(keyring, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("legacy"), decrypted)
+
+	// No key fits
+	other := newTestKeyring(t, "a", Key{ID: "a", Secret: generateRandomKey(t)}, Key{ID: "b", Secret: generateRandomKey(t)})
+	_, err = decryptAll(other, legacy)
+	assert.ErrorContains(t, err, "none of the 2 keys decrypts this backup")
+}
+
+func TestKeyring_MatchesKeysByFingerprint(t *testing.T) {
+	t.Parallel()
+
+	secret := generateRandomKey(t)
+	unnamed := newTestKeyring(t, "", Key{ID: Fingerprint(secret), Secret: secret})
+	encryptor, err := unnamed.Encryptor()
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+
+	// The same key under a chosen ID still decrypts, and counts as active
+	named := newTestKeyring(t, "primary", Key{ID: "primary", Secret: secret})
+	decrypted, err := decryptAll(named, encryptedData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+	assert.True(t, named.IsActive(Fingerprint(secret)))
+}
+
+func TestKeyring_WithActive(t *testing.T) {
+	t.Parallel()
+
+	shared := newTestKeyring(t, "", Key{ID: "shared", Secret: generateRandomKey(t)})
+	own := Key{ID: "own", Secret: generateRandomKey(t)}
+
+	keyring := shared.WithActive(own)
+	assert.Equal(t, "own", keyring.Active().ID)
+	assert.Len(t, keyring.Keys(), 2)
+	assert.Equal(t, "shared", shared.Active().ID, "The original keyring is left alone")
+}
+
+func TestHeaderKeyID_NoKeyID(t *testing.T) {
+	t.Parallel()
+
+	keyID, err := HeaderKeyID(bufio.NewReader(bytes.NewReader(encryptDirect(t, generateValidKey(), "", []byte("data")))))
+	require.NoError(t, err)
+	assert.Empty(t, keyID)
+}
+
+func TestKeyring_DecryptsDirectlyEncryptedStreams(t *testing.T) {
+	t.Parallel()
+
+	// Version 2 streams, encrypted with the named key before envelopes
+	old := Key{ID: "old", Secret: generateRandomKey(t)}
+	keyring := newTestKeyring(t, "new", Key{ID: "new", Secret: generateRandomKey(t)}, old)
+
+	decrypted, err := decryptAll(keyring, encryptDirect(t, old.Secret, "old", []byte("data")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+}
+
+func TestAESEncryptor_StreamFormat_TamperedKeyID(t *testing.T) {
+	t.Parallel()
+
+	keyring := newTestKeyring(t, "", Key{ID: "ab", Secret: generateValidKey()})
+	encryptor, err := keyring.Encryptor()
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+
+	// A renamed key isn't found
+	renamed := bytes.Clone(encryptedData)
+	renamed[streamHeaderLen+2] = 'c'
+	_, err = decryptAll(keyring, renamed)
+	assert.ErrorContains(t, err, `encrypted with key "ac", which is not in the keyring`)
+
+	// A damaged data key doesn't unwrap
+	damaged := bytes.Clone(encryptedData)
+	damaged[headerLen(t, damaged)-1] ^= 0x01
+	_, err = decryptAll(keyring, damaged)
+	assert.ErrorContains(t, err, "failed to unwrap data key")
+}
+
+func TestKeyring_Rewrap(t *testing.T) {
+	t.Parallel()
+
+	old := Key{ID: "old", Secret: generateRandomKey(t)}
+	current := Key{ID: "new", Secret: generateRandomKey(t)}
+	data := bytes.Repeat([]byte("rewrapped "), DefaultChunkSize)
+
+	encryptor, err := newTestKeyring(t, "", old).Encryptor()
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, data)
+
+	rewrapped, err := newTestKeyring(t, "new", current, old).Rewrap(bufio.NewReader(bytes.NewReader(encryptedData)))
+	require.NoError(t, err)
+	rewrappedData, err := io.ReadAll(rewrapped)
+	require.NoError(t, err)
+
+	// Only the header changed
+	n := headerLen(t, encryptedData)
+	assert.Equal(t, encryptedData[n:], rewrappedData[headerLen(t, rewrappedData):])
+	keyID, err := HeaderKeyID(bufio.NewReader(bytes.NewReader(rewrappedData)))
+	require.NoError(t, err)
+	assert.Equal(t, "new", keyID)
+
+	// The old key is no longer needed
+	decrypted, err := decryptAll(newTestKeyring(t, "", current), rewrappedData)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+}
+
+func TestKeyring_Rewrap_NotEnvelope(t *testing.T) {
+	t.Parallel()
+
+	old := generateRandomKey(t)
+	keyring := newTestKeyring(t, "new", Key{ID: "new", Secret: generateRandomKey(t)}, Key{ID: "old", Secret: old})
+
+	r := bufio.NewReader(bytes.NewReader(encryptDirect(t, old, "old", []byte("data"))))
+	_, err := keyring.Rewrap(r)
+	assert.ErrorIs(t, err, ErrNotEnvelope)
+
+	// Nothing was consumed, so the stream can still be re-encrypted
+	decrypted, err := decryptAll(keyring, mustReadAll(t, r))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+}
+
+func mustReadAll(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return data
+}
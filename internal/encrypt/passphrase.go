@@ -0,0 +1,231 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// PassphraseKeyID names the key of passphrase-encrypted backups in their
+	// headers and manifests. A fingerprint would let anyone holding a backup
+	// test guesses without the memory-hard KDF, so there is none.
+	PassphraseKeyID = "passphrase"
+
+	// KDFArgon2id and KDFScrypt name the supported key derivation functions
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+
+	saltSize = 16
+
+	kdfIDArgon2id byte = 1
+	kdfIDScrypt   byte = 2
+
+	// Limits on the parameters accepted from a header, so a corrupt or
+	// hostile backup can't make decryption run out of memory: the memory a
+	// KDF needs is capped, and so are the factors it is computed from
+	maxKDFMemory  = 1 << 30 // bytes
+	maxArgon2Time = 64
+	maxScryptLogN = 24
+	maxScryptR    = 32
+	maxScryptP    = 16
+)
+
+// KDFParams are the settings a key is derived from a passphrase with
+type KDFParams struct {
+	Algorithm string // KDFArgon2id or KDFScrypt
+
+	// Argon2id: passes over memory, memory in KiB and parallelism
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	// scrypt: CPU/memory cost N = 2^LogN, block size R and parallelism P
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// DefaultKDFParams returns the recommended settings for algorithm: Argon2id
+// with 3 passes over 64 MiB (RFC 9106), or scrypt with N=2^17, r=8, p=1
+// (128 MiB)
+func DefaultKDFParams(algorithm string) (KDFParams, error) {
+	switch algorithm {
+	case KDFArgon2id:
+		return KDFParams{Algorithm: KDFArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	case KDFScrypt:
+		return KDFParams{Algorithm: KDFScrypt, LogN: 17, R: 8, P: 1}, nil
+	default:
+		return KDFParams{}, fmt.Errorf("unknown key derivation function %q (expected %s or %s)", algorithm, KDFArgon2id, KDFScrypt)
+	}
+}
+
+func (p KDFParams) validate() error {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Time == 0 || p.Time > maxArgon2Time || p.Memory < 8*uint32(p.Threads) || p.Threads == 0 {
+			return fmt.Errorf("invalid argon2id parameters: t=%d m=%d p=%d", p.Time, p.Memory, p.Threads)
+		}
+	case KDFScrypt:
+		if p.LogN < 1 || p.LogN > maxScryptLogN || p.R == 0 || p.P == 0 || p.R > maxScryptR || p.P > maxScryptP {
+			return fmt.Errorf("invalid scrypt parameters: N=2^%d r=%d p=%d", p.LogN, p.R, p.P)
+		}
+	default:
+		return fmt.Errorf("unknown key derivation function %q", p.Algorithm)
+	}
+	if memory := p.memory(); memory > maxKDFMemory {
+		return fmt.Errorf("invalid %s parameters: deriving a key would need %d MiB, more than the %d MiB allowed", p.Algorithm, memory>>20, maxKDFMemory>>20)
+	}
+	return nil
+}
+
+// memory returns roughly how many bytes deriving a key allocates: m KiB for
+// Argon2id, 128·r·N for scrypt's table plus 128·r·p for its blocks
+func (p KDFParams) memory() uint64 {
+	if p.Algorithm == KDFScrypt {
+		return 128 * uint64(p.R) * (uint64(1)<<p.LogN + uint64(p.P))
+	}
+	return uint64(p.Memory) * 1024
+}
+
+// derive returns the key derived from passphrase and salt
+func (p KDFParams) derive(passphrase, salt []byte) ([]byte, error) {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		return argon2.IDKey(passphrase, salt, p.Time, p.Memory, p.Threads, KeySize), nil
+	case KDFScrypt:
+		key, err := scrypt.Key(passphrase, salt, 1<<p.LogN, int(p.R), int(p.P), KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown key derivation function %q", p.Algorithm)
+	}
+}
+
+// marshal encodes the parameters for the wrapped key:
+//
+//	argon2id: 1 | time (uint32 BE) | memory (uint32 BE) | threads (1 byte)
+//	scrypt:   2 | log2 N (1 byte) | r (uint32 BE) | p (uint32 BE)
+func (p KDFParams) marshal() []byte {
+	if p.Algorithm == KDFScrypt {
+		buf := []byte{kdfIDScrypt, p.LogN}
+		buf = binary.BigEndian.AppendUint32(buf, p.R)
+		return binary.BigEndian.AppendUint32(buf, p.P)
+	}
+	buf := []byte{kdfIDArgon2id}
+	buf = binary.BigEndian.AppendUint32(buf, p.Time)
+	buf = binary.BigEndian.AppendUint32(buf, p.Memory)
+	return append(buf, p.Threads)
+}
+
+// parseKDFParams decodes parameters encoded by marshal from the start of
+// data, returning them and the rest of data
+func parseKDFParams(data []byte) (KDFParams, []byte, error) {
+	const encodedLen = 1 + 4 + 4 + 1
+	if len(data) < encodedLen {
+		return KDFParams{}, nil, fmt.Errorf("wrapped data key is too short")
+	}
+
+	var p KDFParams
+	switch data[0] {
+	case kdfIDArgon2id:
+		p = KDFParams{
+			Algorithm: KDFArgon2id,
+			Time:      binary.BigEndian.Uint32(data[1:]),
+			Memory:    binary.BigEndian.Uint32(data[5:]),
+			Threads:   data[9],
+		}
+	case kdfIDScrypt:
+		p = KDFParams{
+			Algorithm: KDFScrypt,
+			LogN:      data[1],
+			R:         binary.BigEndian.Uint32(data[2:]),
+			P:         binary.BigEndian.Uint32(data[6:]),
+		}
+	default:
+		return KDFParams{}, nil, fmt.Errorf("unknown key derivation function %d", data[0])
+	}
+	if err := p.validate(); err != nil {
+		return KDFParams{}, nil, err
+	}
+	return p, data[encodedLen:], nil
+}
+
+// PassphraseWrapper wraps data keys with a key derived from a passphrase.
+// Every wrapped key carries the KDF parameters and a random salt, so a
+// backup decrypts with the passphrase alone, even after the defaults change.
+type PassphraseWrapper struct {
+	passphrase []byte
+	params     KDFParams
+}
+
+// NewPassphraseWrapper returns a wrapper that derives keys from passphrase
+// with params
+func NewPassphraseWrapper(passphrase string, params KDFParams) (*PassphraseWrapper, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return &PassphraseWrapper{passphrase: []byte(passphrase), params: params}, nil
+}
+
+func (w *PassphraseWrapper) KeyID() string {
+	return PassphraseKeyID
+}
+
+// Wrap derives a key under a new salt and seals dataKey with it:
+//
+//	KDF parameters | salt (16 bytes) | nonce (12 bytes) | sealed data key
+func (w *PassphraseWrapper) Wrap(dataKey []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	derived, err := w.params.derive(w.passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	local, err := NewLocalKeyWrapper(PassphraseKeyID, derived)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := local.Wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := append(w.params.marshal(), salt...)
+	return append(wrapped, sealed...), nil
+}
+
+// Unwrap derives the key with the parameters and salt stored in wrapped
+func (w *PassphraseWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	params, rest, err := parseKDFParams(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < saltSize {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+	derived, err := params.derive(w.passphrase, rest[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	local, err := NewLocalKeyWrapper(PassphraseKeyID, derived)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := local.Unwrap(rest[saltSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: wrong passphrase or damaged header")
+	}
+	return dataKey, nil
+}
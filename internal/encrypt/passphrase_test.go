@@ -0,0 +1,180 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Cheap parameters, so the tests don't spend seconds deriving keys
+var (
+	testArgon2Params = KDFParams{Algorithm: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+	testScryptParams = KDFParams{Algorithm: KDFScrypt, LogN: 10, R: 8, P: 1}
+)
+
+func newTestPassphrase(t *testing.T, passphrase string, params KDFParams) *PassphraseWrapper {
+	t.Helper()
+	wrapper, err := NewPassphraseWrapper(passphrase, params)
+	require.NoError(t, err)
+	return wrapper
+}
+
+func TestPassphraseWrapper_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, params := range []KDFParams{testArgon2Params, testScryptParams} {
+		t.Run(params.Algorithm, func(t *testing.T) {
+			t.Parallel()
+
+			encryptor := NewEnvelopeEncryptor(newTestPassphrase(t, "correct horse battery staple", params))
+			assert.Equal(t, PassphraseKeyID, encryptor.KeyID())
+
+			data := bytes.Repeat([]byte("derived "), DefaultChunkSize)
+			encryptedData := encryptAll(t, encryptor, data)
+
+			// Only the passphrase is needed: the parameters and salt are in
+			// the header, so other settings don't matter
+			other := KDFParams{Algorithm: KDFArgon2id, Time: 2, Memory: 128, Threads: 2}
+			decrypted, err := decryptAll(NewEnvelopeEncryptor(newTestPassphrase(t, "correct horse battery staple", other)), encryptedData)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+
+			_, err = decryptAll(NewEnvelopeEncryptor(newTestPassphrase(t, "wrong horse battery staple", params)), encryptedData)
+			assert.ErrorContains(t, err, "wrong passphrase")
+		})
+	}
+}
+
+func TestPassphraseWrapper_SaltPerBackup(t *testing.T) {
+	t.Parallel()
+
+	wrapper := newTestPassphrase(t, "correct horse battery staple", testArgon2Params)
+	dataKey := generateRandomKey(t)
+
+	first, err := wrapper.Wrap(dataKey)
+	require.NoError(t, err)
+	second, err := wrapper.Wrap(dataKey)
+	require.NoError(t, err)
+
+	_, rest1, err := parseKDFParams(first)
+	require.NoError(t, err)
+	_, rest2, err := parseKDFParams(second)
+	require.NoError(t, err)
+	assert.NotEqual(t, rest1[:saltSize], rest2[:saltSize])
+}
+
+func TestPassphraseWrapper_RejectsHostileParameters(t *testing.T) {
+	t.Parallel()
+
+	wrapper := newTestPassphrase(t, "correct horse battery staple", testArgon2Params)
+	tests := []struct {
+		name   string
+		params KDFParams
+	}{
+		{"argon2id memory", KDFParams{Algorithm: KDFArgon2id, Time: 1, Memory: 1 << 30, Threads: 1}},
+		{"argon2id 2 GiB", KDFParams{Algorithm: KDFArgon2id, Time: 1, Memory: 2 << 20, Threads: 1}},
+		{"argon2id passes", KDFParams{Algorithm: KDFArgon2id, Time: 1 << 20, Memory: 64, Threads: 1}},
+		{"scrypt cost", KDFParams{Algorithm: KDFScrypt, LogN: 40, R: 8, P: 1}},
+		{"scrypt 16 GiB", KDFParams{Algorithm: KDFScrypt, LogN: 24, R: 8, P: 1}},
+		{"scrypt r", KDFParams{Algorithm: KDFScrypt, LogN: 10, R: 1 << 20, P: 1}},
+		{"scrypt p", KDFParams{Algorithm: KDFScrypt, LogN: 10, R: 8, P: 1 << 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Rejected from the header alone: deriving a key with these
+			// would take minutes or gigabytes
+			wrapped := append(tt.params.marshal(), make([]byte, saltSize+NonceSize+KeySize+TagSize)...)
+			_, err := wrapper.Unwrap(wrapped)
+			assert.ErrorContains(t, err, "invalid")
+		})
+	}
+
+	// Up to the memory limit is still accepted
+	for _, params := range []KDFParams{
+		{Algorithm: KDFArgon2id, Time: 1, Memory: 1 << 20, Threads: 4},
+		{Algorithm: KDFScrypt, LogN: 19, R: 8, P: 1},
+	} {
+		assert.LessOrEqual(t, params.memory(), uint64(maxKDFMemory))
+		assert.NoError(t, params.validate())
+	}
+}
+
+func TestEnvelope_RejectsOversizedKDFHeader(t *testing.T) {
+	t.Parallel()
+
+	encryptor := NewEnvelopeEncryptor(newTestPassphrase(t, "correct horse battery staple", testScryptParams))
+	encryptedData := encryptAll(t, encryptor, []byte("data"))
+
+	// Raise N in the stored parameters to 2^24, for 16 GiB
+	i := bytes.Index(encryptedData, testScryptParams.marshal())
+	require.Positive(t, i)
+	encryptedData[i+1] = 24
+
+	_, err := decryptAll(encryptor, encryptedData)
+	assert.ErrorContains(t, err, "would need 16384 MiB")
+}
+
+func TestDefaultKDFParams(t *testing.T) {
+	t.Parallel()
+
+	for _, algorithm := range []string{KDFArgon2id, KDFScrypt} {
+		params, err := DefaultKDFParams(algorithm)
+		require.NoError(t, err)
+		assert.NoError(t, params.validate())
+	}
+
+	_, err := DefaultKDFParams("pbkdf2")
+	assert.ErrorContains(t, err, `unknown key derivation function "pbkdf2"`)
+}
+
+func TestKeys_RewrapKeyringToPassphrase(t *testing.T) {
+	t.Parallel()
+
+	passphrase := newTestPassphrase(t, "correct horse battery staple", testArgon2Params)
+	keyring := newTestKeyring(t, "", Key{ID: "k1", Secret: generateRandomKey(t)})
+	encryptor, err := keyring.Encryptor()
+	require.NoError(t, err)
+	encryptedData := encryptAll(t, encryptor, []byte("migrated"))
+
+	rewrapped, err := Keys{Keyring: keyring, Passphrase: passphrase}.Rewrap(bufio.NewReader(bytes.NewReader(encryptedData)), passphrase)
+	require.NoError(t, err)
+	rewrappedData := mustReadAll(t, rewrapped)
+
+	// The passphrase alone decrypts it now
+	decrypted, err := Keys{Passphrase: passphrase}.Decrypt(bytes.NewReader(rewrappedData), Algorithm)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("migrated"), mustReadAll(t, decrypted))
+
+	_, err = Keys{}.Rewrap(bufio.NewReader(bytes.NewReader(encryptedData)), passphrase)
+	assert.ErrorContains(t, err, "no encryption key is configured")
+}
+
+func TestKeys_DecryptPassphraseAndKeyring(t *testing.T) {
+	t.Parallel()
+
+	passphrase := newTestPassphrase(t, "correct horse battery staple", testArgon2Params)
+	keyring := newTestKeyring(t, "", Key{ID: "k1", Secret: generateRandomKey(t)})
+	keyringEncryptor, err := keyring.Encryptor()
+	require.NoError(t, err)
+
+	fromPassphrase := encryptAll(t, NewEnvelopeEncryptor(passphrase), []byte("passphrase"))
+	fromKeyring := encryptAll(t, keyringEncryptor, []byte("keyring"))
+
+	both := Keys{Keyring: keyring, Passphrase: passphrase}
+	decrypted, err := both.Decrypt(bytes.NewReader(fromPassphrase), Algorithm)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("passphrase"), mustReadAll(t, decrypted))
+	decrypted, err = both.Decrypt(bytes.NewReader(fromKeyring), Algorithm)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keyring"), mustReadAll(t, decrypted))
+
+	_, err = Keys{Keyring: keyring}.Decrypt(bytes.NewReader(fromPassphrase), Algorithm)
+	assert.ErrorContains(t, err, "encrypted with a passphrase, but no passphrase is configured")
+	_, err = Keys{Passphrase: passphrase}.Decrypt(bytes.NewReader(fromKeyring), Algorithm)
+	assert.ErrorContains(t, err, `encrypted with key "k1", but only a passphrase is configured`)
+}
@@ -0,0 +1,312 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Chunked stream format
+//
+// Encrypt writes a header followed by a sequence of independently sealed
+// AES-256-GCM chunks, so neither side needs to hold more than one chunk in
+// memory:
+//
+//	header:  magic "ADBE" | version (1 byte) | chunk size (uint32 BE) | nonce prefix (7 bytes)
+//	         versions 2 and 3: key ID length (1 byte) | key ID
+//	         version 3 only: wrapped data key length (uint16 BE) | wrapped data key
+//	chunk i: GCM seal of up to chunk size plaintext bytes
+//
+// Version 3 is envelope encryption: the chunks are sealed with a random data
+// key generated for the stream, stored wrapped by the master key the key ID
+// names, so the long-lived master key only ever seals data keys. Version 2
+// seals the chunks with the named key itself, and version 1 streams name no
+// key.
+//
+// Every chunk except the last carries exactly chunk size bytes of plaintext.
+// The nonce for chunk i is nonce prefix | i (uint32 BE) | final flag, where the
+// final flag is 1 only for the last chunk. Decryption therefore detects
+// reordered, dropped and truncated chunks: a stream that ends without a chunk
+// sealed as final fails to authenticate. The header is passed as additional
+// data to every chunk so it can't be altered either. In version 3 that is
+// only the fixed-size part: the key ID and wrapped data key can be replaced
+// to rewrap the data key without touching the chunks, and any other change
+// to them leaves a data key that fails to unwrap or to open the chunks.
+const (
+	streamMagic          = "ADBE"
+	streamVersion1  byte = 1
+	streamVersion2  byte = 2
+	streamVersion3  byte = 3
+	streamHeaderLen      = len(streamMagic) + 1 + 4 + noncePrefixSize // without the key ID
+	noncePrefixSize      = 7
+
+	// MaxKeyIDLen is the longest key ID the header can carry
+	MaxKeyIDLen = 255
+	// maxWrappedKeyLen is the longest wrapped data key the header can carry
+	maxWrappedKeyLen = math.MaxUint16
+
+	// DefaultChunkSize is the amount of plaintext sealed per chunk
+	DefaultChunkSize = 64 * 1024
+	// maxChunkSize guards against allocating huge buffers for a corrupt header
+	maxChunkSize = 16 * 1024 * 1024
+)
+
+type streamHeader struct {
+	version     byte
+	chunkSize   uint32
+	noncePrefix [noncePrefixSize]byte
+	keyID       string // empty in version 1
+	wrappedKey  []byte // version 3 only
+}
+
+// newStreamHeader returns a header for a new stream, naming keyID unless it
+// is empty
+func newStreamHeader(keyID string) (*streamHeader, error) {
+	if len(keyID) > MaxKeyIDLen {
+		return nil, fmt.Errorf("key ID is longer than %d bytes", MaxKeyIDLen)
+	}
+	h := &streamHeader{
+		version:   streamVersion1,
+		chunkSize: DefaultChunkSize,
+		keyID:     keyID,
+	}
+	if keyID != "" {
+		h.version = streamVersion2
+	}
+	if _, err := io.ReadFull(rand.Reader, h.noncePrefix[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+	return h, nil
+}
+
+// newEnvelopeHeader returns a version 3 header for a new stream whose data
+// key, wrapped by the key named keyID, is wrappedKey
+func newEnvelopeHeader(keyID string, wrappedKey []byte) (*streamHeader, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("envelope encryption needs a key ID")
+	}
+	if len(wrappedKey) == 0 || len(wrappedKey) > maxWrappedKeyLen {
+		return nil, fmt.Errorf("wrapped data key must be 1 to %d bytes, got %d", maxWrappedKeyLen, len(wrappedKey))
+	}
+	h, err := newStreamHeader(keyID)
+	if err != nil {
+		return nil, err
+	}
+	h.version = streamVersion3
+	h.wrappedKey = wrappedKey
+	return h, nil
+}
+
+func (h *streamHeader) marshal() []byte {
+	buf := make([]byte, 0, streamHeaderLen+1+len(h.keyID)+2+len(h.wrappedKey))
+	buf = append(buf, streamMagic...)
+	buf = append(buf, h.version)
+	buf = binary.BigEndian.AppendUint32(buf, h.chunkSize)
+	buf = append(buf, h.noncePrefix[:]...)
+	if h.version != streamVersion1 {
+		buf = append(buf, byte(len(h.keyID)))
+		buf = append(buf, h.keyID...)
+	}
+	if h.version == streamVersion3 {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.wrappedKey)))
+		buf = append(buf, h.wrappedKey...)
+	}
+	return buf
+}
+
+// authenticatedData returns the part of the header every chunk is
+// authenticated with
+func (h *streamHeader) authenticatedData() []byte {
+	if h.version == streamVersion3 {
+		return h.marshal()[:streamHeaderLen]
+	}
+	return h.marshal()
+}
+
+// readStreamHeader reads the header from r, returning it parsed and the
+// bytes of it every chunk is authenticated with
+func readStreamHeader(r io.Reader) (*streamHeader, []byte, error) {
+	raw := make([]byte, streamHeaderLen)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	h, err := parseStreamHeader(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.version == streamVersion1 {
+		return h, raw, nil
+	}
+
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	keyID := make([]byte, length[0])
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if len(keyID) == 0 {
+		return nil, nil, fmt.Errorf("invalid stream header: empty key ID")
+	}
+	h.keyID = string(keyID)
+
+	if h.version == streamVersion3 {
+		wrappedLen := make([]byte, 2)
+		if _, err := io.ReadFull(r, wrappedLen); err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		h.wrappedKey = make([]byte, binary.BigEndian.Uint16(wrappedLen))
+		if _, err := io.ReadFull(r, h.wrappedKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		if len(h.wrappedKey) == 0 {
+			return nil, nil, fmt.Errorf("invalid stream header: empty wrapped data key")
+		}
+	}
+
+	return h, h.authenticatedData(), nil
+}
+
+// parseStreamHeader parses the fixed-size part of a header
+func parseStreamHeader(raw []byte) (*streamHeader, error) {
+	if len(raw) != streamHeaderLen || !bytes.HasPrefix(raw, []byte(streamMagic)) {
+		return nil, fmt.Errorf("invalid stream header")
+	}
+
+	h := &streamHeader{version: raw[len(streamMagic)]}
+	if !isStreamVersion(h.version) {
+		return nil, fmt.Errorf("unsupported encryption format version: %d", h.version)
+	}
+
+	h.chunkSize = binary.BigEndian.Uint32(raw[len(streamMagic)+1:])
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size in header: %d", h.chunkSize)
+	}
+	copy(h.noncePrefix[:], raw[len(streamMagic)+5:])
+
+	return h, nil
+}
+
+// isStreamFormat reports whether data starts with the chunked format magic.
+// Legacy files start with a random 12-byte nonce, so a false positive has a
+// probability of 2^-39.
+func isStreamFormat(prefix []byte) bool {
+	return len(prefix) > len(streamMagic) &&
+		bytes.HasPrefix(prefix, []byte(streamMagic)) &&
+		isStreamVersion(prefix[len(streamMagic)])
+}
+
+func isStreamVersion(version byte) bool {
+	return version == streamVersion1 || version == streamVersion2 || version == streamVersion3
+}
+
+func (h *streamHeader) nonce(counter uint32, final bool) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, h.noncePrefix[:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if final {
+		nonce[NonceSize-1] = 1
+	}
+	return nonce
+}
+
+// encryptStream seals r chunk by chunk and writes the result to w
+func encryptStream(w io.Writer, r io.Reader, gcm cipher.AEAD, h *streamHeader) error {
+	if _, err := w.Write(h.marshal()); err != nil {
+		return err
+	}
+	header := h.authenticatedData()
+
+	br := bufio.NewReader(r)
+	plaintext := make([]byte, h.chunkSize)
+	ciphertext := make([]byte, 0, int(h.chunkSize)+gcm.Overhead())
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, plaintext)
+		final := false
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			final = true
+		case err != nil:
+			return fmt.Errorf("failed to read plaintext: %w", err)
+		default:
+			// A full chunk is only the last one if nothing follows it
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				final = true
+			} else if peekErr != nil {
+				return fmt.Errorf("failed to read plaintext: %w", peekErr)
+			}
+		}
+
+		if !final && counter == math.MaxUint32 {
+			return fmt.Errorf("input too large for chunked encryption")
+		}
+
+		ciphertext = gcm.Seal(ciphertext[:0], h.nonce(counter, final), plaintext[:n], header)
+		if _, err := w.Write(ciphertext); err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptStream authenticates and decrypts the chunks following the header
+// and writes the plaintext to w. Nothing from a chunk is written until that
+// chunk has been authenticated.
+func decryptStream(w io.Writer, r *bufio.Reader, gcm cipher.AEAD, h *streamHeader, header []byte) error {
+	ciphertext := make([]byte, int(h.chunkSize)+gcm.Overhead())
+	plaintext := make([]byte, 0, h.chunkSize)
+
+	for counter := uint32(0); ; counter++ {
+		n, final, err := readChunk(r, ciphertext)
+		if err != nil {
+			return err
+		}
+
+		plaintext, err = gcm.Open(plaintext[:0], h.nonce(counter, final), ciphertext[:n], header)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt chunk %d: %w", counter, err)
+		}
+
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("encrypted stream has too many chunks")
+		}
+	}
+}
+
+// readChunk reads the next sealed chunk into buf, which holds a full chunk,
+// and reports whether it is the final one
+func readChunk(r *bufio.Reader, buf []byte) (n int, final bool, err error) {
+	n, err = io.ReadFull(r, buf)
+	switch {
+	case err == io.EOF:
+		return 0, false, fmt.Errorf("encrypted stream is truncated: missing final chunk")
+	case err == io.ErrUnexpectedEOF:
+		return n, true, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+
+	if _, err := r.Peek(1); err == io.EOF {
+		return n, true, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	return n, false, nil
+}
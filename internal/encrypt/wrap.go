@@ -0,0 +1,106 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// wrapContext is the additional data data keys are wrapped with, so a
+// wrapped key can't be passed off as any other ciphertext under the same
+// master key
+var wrapContext = []byte("auto-db-backups data key")
+
+// KeyWrapper protects the data keys backups are encrypted with. Every backup
+// gets a fresh data key, stored in its header wrapped by the wrapper's
+// master key; the master key itself never encrypts backup data. A wrapper
+// backed by a KMS can keep the master key out of the process entirely.
+type KeyWrapper interface {
+	// KeyID names the master key in backup headers and manifests
+	KeyID() string
+	Wrap(dataKey []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyWrapper wraps data keys with an AES-256 master key held in memory
+type LocalKeyWrapper struct {
+	id  string
+	key []byte
+}
+
+// NewLocalKeyWrapper returns a wrapper for key, identified in headers by id,
+// or by the key's fingerprint if id is empty
+func NewLocalKeyWrapper(id string, key []byte) (*LocalKeyWrapper, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be exactly %d bytes, got %d", KeySize, len(key))
+	}
+	if id == "" {
+		id = Fingerprint(key)
+	}
+	return &LocalKeyWrapper{id: id, key: key}, nil
+}
+
+// LoadKeyFile returns a wrapper for the base64-encoded master key in the
+// file at path, e.g. one written by `openssl rand -base64 32 > master.key`
+func LoadKeyFile(path string) (*LocalKeyWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s must hold a base64-encoded key", path)
+	}
+	return NewLocalKeyWrapper("", key)
+}
+
+func (w *LocalKeyWrapper) KeyID() string {
+	return w.id
+}
+
+// Wrap seals dataKey with the master key under a random nonce, which is
+// stored in front of the result
+func (w *LocalKeyWrapper) Wrap(dataKey []byte) ([]byte, error) {
+	gcm, err := newGCM(w.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, dataKey, wrapContext), nil
+}
+
+func (w *LocalKeyWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	gcm, err := newGCM(w.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < NonceSize+TagSize {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+	dataKey, err := gcm.Open(nil, wrapped[:NonceSize], wrapped[NonceSize:], wrapContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with key %q: %w", w.id, err)
+	}
+	return dataKey, nil
+}
+
+// secret returns the master key, which decrypts streams written before
+// envelope encryption
+func (w *LocalKeyWrapper) secret() []byte {
+	return w.key
+}
+
+// newDataKey returns a random key for encrypting one stream
+func newDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,103 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remoteWrapper stands in for a KMS: it wraps with a key it never hands out
+type remoteWrapper struct {
+	local *LocalKeyWrapper
+	calls int
+}
+
+func (w *remoteWrapper) KeyID() string { return "kms:test" }
+
+func (w *remoteWrapper) Wrap(dataKey []byte) ([]byte, error) {
+	w.calls++
+	return w.local.Wrap(dataKey)
+}
+
+func (w *remoteWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	w.calls++
+	return w.local.Unwrap(wrapped)
+}
+
+func TestLocalKeyWrapper_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	wrapper, err := NewLocalKeyWrapper("", generateValidKey())
+	require.NoError(t, err)
+	assert.Equal(t, Fingerprint(generateValidKey()), wrapper.KeyID())
+
+	dataKey := generateRandomKey(t)
+	wrapped, err := wrapper.Wrap(dataKey)
+	require.NoError(t, err)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := wrapper.Unwrap(wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	other, err := NewLocalKeyWrapper("other", generateRandomKey(t))
+	require.NoError(t, err)
+	_, err = other.Unwrap(wrapped)
+	assert.ErrorContains(t, err, `failed to unwrap data key with key "other"`)
+
+	_, err = wrapper.Unwrap(wrapped[:10])
+	assert.ErrorContains(t, err, "too short")
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	t.Parallel()
+
+	key := generateRandomKey(t)
+	path := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600))
+
+	wrapper, err := LoadKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, Fingerprint(key), wrapper.KeyID())
+
+	// Backups it encrypts decrypt with the key itself
+	encryptedData := encryptAll(t, NewEnvelopeEncryptor(wrapper), []byte("data"))
+	encryptor, err := NewAESEncryptor(key)
+	require.NoError(t, err)
+	decrypted, err := decryptAll(encryptor, encryptedData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+
+	require.NoError(t, os.WriteFile(path, []byte("not base64!"), 0o600))
+	_, err = LoadKeyFile(path)
+	assert.ErrorContains(t, err, "must hold a base64-encoded key")
+
+	_, err = LoadKeyFile(filepath.Join(t.TempDir(), "missing.key"))
+	assert.ErrorContains(t, err, "failed to read key file")
+}
+
+func TestNewEnvelopeEncryptor_PluggableWrapper(t *testing.T) {
+	t.Parallel()
+
+	local, err := NewLocalKeyWrapper("", generateRandomKey(t))
+	require.NoError(t, err)
+	wrapper := &remoteWrapper{local: local}
+	encryptor := NewEnvelopeEncryptor(wrapper)
+	assert.Equal(t, "kms:test", encryptor.KeyID())
+
+	data := bytes.Repeat([]byte("wrapped remotely "), DefaultChunkSize/4)
+	encryptedData := encryptAll(t, encryptor, data)
+	decrypted, err := decryptAll(encryptor, encryptedData)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+	assert.Equal(t, 2, wrapper.calls, "One wrap and one unwrap per backup, whatever its size")
+
+	// Streams the master key encrypted directly need the key itself
+	_, err = decryptAll(encryptor, encryptDirect(t, generateValidKey(), "", []byte("data")))
+	assert.ErrorContains(t, err, "predates envelope encryption")
+}
@@ -13,6 +13,7 @@ var (
 	ErrConnectionFailed   = errors.New("database connection failed")
 	ErrRetentionFailed    = errors.New("retention cleanup failed")
 	ErrNotificationFailed = errors.New("notification failed")
+	ErrObjectNotFound     = errors.New("object not found")
 )
 
 type BackupError struct {
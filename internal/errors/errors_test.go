@@ -1,7 +1,12 @@
 package errors
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -217,6 +222,7 @@ func TestSentinelErrors(t *testing.T) {
 		ErrConnectionFailed,
 		ErrRetentionFailed,
 		ErrNotificationFailed,
+		ErrObjectNotFound,
 	}
 
 	// Check they are all non-nil
@@ -267,3 +273,76 @@ func TestErrorWrapping(t *testing.T) {
 		assert.Equal(t, "field", target.Field)
 	})
 }
+
+// statusError mimics the AWS SDK's response errors
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("https response error StatusCode: %d", e.code)
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"nil", nil, false},
+		{"unknown error", errors.New("something odd happened"), false},
+		{"context canceled", fmt.Errorf("upload: %w", context.Canceled), false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"connection reset", fmt.Errorf("failed to upload backup: %w", syscall.ECONNRESET), true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"net error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, true},
+		{"http 500", fmt.Errorf("upload: %w", &statusError{code: 500}), true},
+		{"http 503", &statusError{code: 503}, true},
+		{"http 429", &statusError{code: 429}, true},
+		{"http 403", &statusError{code: 403}, false},
+		{"http 404", &statusError{code: 404}, false},
+		{
+			"pg_dump server closed connection",
+			NewBackupError("postgres", "app", errors.New("exit status 1: pg_dump: error: server closed the connection unexpectedly")),
+			true,
+		},
+		{
+			"mysqldump lost connection",
+			NewBackupError("mysql", "app", errors.New("exit status 2: mysqldump: Error 2013: Lost connection to MySQL server during query")),
+			true,
+		},
+		{
+			"pg_dump bad password",
+			NewBackupError("postgres", "app", errors.New(`exit status 1: pg_dump: error: connection to server at "db" failed: FATAL:  password authentication failed for user "app"`)),
+			false,
+		},
+		{
+			"pg_dump missing database",
+			NewBackupError("postgres", "app", errors.New(`exit status 1: pg_dump: error: connection to server failed: FATAL:  database "app" does not exist`)),
+			false,
+		},
+		{
+			"mysqldump access denied",
+			NewBackupError("mysql", "app", errors.New("exit status 2: mysqldump: Got error: 1045: Access denied for user 'app'@'host'")),
+			false,
+		},
+		{
+			"mysqldump unknown database",
+			NewBackupError("mysql", "app", errors.New("exit status 2: mysqldump: Got error: 1049: Unknown database 'app'")),
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.retryable, IsRetryable(tt.err))
+		})
+	}
+}
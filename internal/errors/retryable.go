@@ -0,0 +1,95 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// HTTPStatusError is implemented by errors carrying an HTTP response status,
+// such as the AWS SDK's response errors
+type HTTPStatusError interface {
+	HTTPStatusCode() int
+}
+
+// permanentMessages mark failures that retrying won't fix: bad credentials,
+// missing databases or buckets, and missing permissions. They take
+// precedence over transientMessages since tools often report them as a
+// failed connection.
+var permanentMessages = []string{
+	"authentication failed",
+	"access denied",
+	"permission denied",
+	"does not exist",
+	"unknown database",
+	"no pg_hba.conf entry",
+	"invalidaccesskeyid",
+	"signaturedoesnotmatch",
+	"nosuchbucket",
+}
+
+// transientMessages mark network and server hiccups reported by the dump
+// tools on stderr, where no typed error is available
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"server closed the connection unexpectedly",
+	"could not connect to server",
+	"lost connection to mysql server",
+	"can't connect to mysql server",
+	"ssl syscall error",
+	"i/o timeout",
+	"timed out",
+	"temporary failure in name resolution",
+	"too many connections",
+	"the database system is starting up",
+	"the database system is shutting down",
+	"server selection timeout",
+}
+
+// IsRetryable reports whether err is likely transient, such as a dropped
+// connection or a 5xx response, so the failed operation is worth retrying.
+// Unknown errors and cancellations are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range permanentMessages {
+		if strings.Contains(msg, m) {
+			return false
+		}
+	}
+
+	var statusErr HTTPStatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.HTTPStatusCode()
+		return code >= 500 || code == 429 || code == 408
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+
+	return false
+}
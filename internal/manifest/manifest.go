@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+// Suffix is appended to a backup's key to name its manifest
+const Suffix = ".manifest.json"
+
+// Version is the manifest schema version written by this tool
+const Version = 1
+
+// Manifest records the facts about one backup, stored as a JSON sidecar
+// next to the backup object
+type Manifest struct {
+	Version      int    `json:"version"`
+	Key          string `json:"key"`
+	DatabaseName string `json:"database_name"`
+	DatabaseType string `json:"database_type"`
+	ToolVersion  string `json:"tool_version,omitempty"` // e.g. "pg_dump (PostgreSQL) 17.2"
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	UncompressedSize int64  `json:"uncompressed_size"` // bytes of the raw dump
+	StoredSize       int64  `json:"stored_size"`       // bytes of the stored object
+	SHA256           string `json:"sha256"`            // hex digest of the stored object
+
+	Compression     string      `json:"compression,omitempty"`      // e.g. "gzip"; empty if uncompressed
+	DumpCompression string      `json:"dump_compression,omitempty"` // applied by the dump tool itself, e.g. "gzip" for pg_dump's custom format
+	Encryption      *Encryption `json:"encryption,omitempty"`       // nil if unencrypted
+
+	Repository string `json:"repository,omitempty"`
+	RunID      string `json:"run_id,omitempty"`
+	RunURL     string `json:"run_url,omitempty"`
+
+	Signature *Signature `json:"signature,omitempty"` // nil if unsigned
+}
+
+// Encryption describes how a backup was encrypted
+type Encryption struct {
+	Algorithm string `json:"algorithm"`        // e.g. "AES-256-GCM"
+	KeyID     string `json:"key_id,omitempty"` // identifies the key, never the key itself
+}
+
+// Signature is a signature over a manifest's SignedPayload
+type Signature struct {
+	Algorithm string `json:"algorithm"` // e.g. "Ed25519"
+	KeyID     string `json:"key_id"`    // fingerprint of the public key
+	Value     string `json:"value"`     // base64
+}
+
+// signaturePrefix sets manifest signatures apart from anything else the same
+// key might sign
+const signaturePrefix = "auto-db-backups manifest signature v1\n"
+
+// SignedPayload returns the bytes a signature covers: the backup's key,
+// database, timestamps and the size and digest of the stored object. Those
+// fields alone tie the signature to the exact bytes in storage; the rest of
+// the manifest can change, e.g. across tool versions, without invalidating
+// it.
+func (m *Manifest) SignedPayload() []byte {
+	fields := struct {
+		Key          string    `json:"key"`
+		DatabaseName string    `json:"database_name"`
+		DatabaseType string    `json:"database_type"`
+		StartedAt    time.Time `json:"started_at"`
+		FinishedAt   time.Time `json:"finished_at"`
+		StoredSize   int64     `json:"stored_size"`
+		SHA256       string    `json:"sha256"`
+	}{m.Key, m.DatabaseName, m.DatabaseType, m.StartedAt.UTC(), m.FinishedAt.UTC(), m.StoredSize, m.SHA256}
+
+	// Marshaling a struct of strings, times and integers can't fail
+	body, _ := json.Marshal(fields)
+	return append([]byte(signaturePrefix), body...)
+}
+
+// Key returns the key of the manifest for the backup at backupKey
+func Key(backupKey string) string {
+	return backupKey + Suffix
+}
+
+// IsKey reports whether key names a manifest rather than a backup
+func IsKey(key string) bool {
+	return strings.HasSuffix(key, Suffix)
+}
+
+// Encode writes m as indented JSON
+func (m *Manifest) Encode(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
+
+// Decode reads a manifest, rejecting versions newer than this tool knows
+func Decode(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version < 1 || m.Version > Version {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Downloader is the part of storage.Backend needed to fetch a manifest
+type Downloader interface {
+	Download(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Fetch downloads and decodes the manifest of the backup at backupKey. It
+// returns nil without an error if the backup has no manifest, as for backups
+// made before manifests existed.
+func Fetch(ctx context.Context, d Downloader, backupKey string) (*Manifest, error) {
+	body, err := d.Download(ctx, Key(backupKey))
+	if stderrors.Is(err, errors.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download manifest: %w", err)
+	}
+	defer body.Close()
+
+	return Decode(body)
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+// memDownloader serves objects from a map
+type memDownloader map[string]string
+
+func (d memDownloader) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, ok := d[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errors.ErrObjectNotFound, key)
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	key := Key("backups/app/postgres-app-20240115-140532.dump.gz.enc")
+	assert.Equal(t, "backups/app/postgres-app-20240115-140532.dump.gz.enc.manifest.json", key)
+	assert.True(t, IsKey(key))
+	assert.False(t, IsKey("backups/app/postgres-app-20240115-140532.dump.gz.enc"))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2024, 1, 15, 14, 5, 32, 0, time.UTC)
+	m := &Manifest{
+		Version:          Version,
+		Key:              "backups/app/postgres-app-20240115-140532.dump.gz.enc",
+		DatabaseName:     "app",
+		DatabaseType:     "postgres",
+		ToolVersion:      "pg_dump (PostgreSQL) 17.2",
+		StartedAt:        started,
+		FinishedAt:       started.Add(time.Minute),
+		UncompressedSize: 4096,
+		StoredSize:       1024,
+		SHA256:           strings.Repeat("ab", 32),
+		Compression:      "gzip",
+		Encryption:       &Encryption{Algorithm: "AES-256-GCM", KeyID: "0123456789abcdef"},
+		RunID:            "42",
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Encode(&buf))
+	assert.Contains(t, buf.String(), `"sha256": "abab`)
+
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, m, decoded)
+}
+
+func TestDecode_UnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, body := range []string{`{"version": 0}`, `{"version": 99}`, `{}`} {
+		_, err := Decode(strings.NewReader(body))
+		assert.Error(t, err, body)
+	}
+
+	_, err := Decode(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	d := memDownloader{
+		"backups/a.dump.manifest.json": `{"version": 1, "key": "backups/a.dump"}`,
+		"backups/b.dump.manifest.json": `{"version": 1`,
+	}
+
+	m, err := Fetch(context.Background(), d, "backups/a.dump")
+	require.NoError(t, err)
+	assert.Equal(t, "backups/a.dump", m.Key)
+
+	// Backups made before manifests existed have none
+	m, err = Fetch(context.Background(), d, "backups/old.dump")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	_, err = Fetch(context.Background(), d, "backups/b.dump")
+	assert.Error(t, err)
+}
+
+func TestSignedPayload(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2024, 1, 15, 14, 5, 32, 0, time.UTC)
+	m := &Manifest{
+		Key:          "backups/app/postgres-app-20240115-140532.dump.gz",
+		DatabaseName: "app",
+		DatabaseType: "postgres",
+		StartedAt:    started,
+		FinishedAt:   started.Add(time.Minute),
+		StoredSize:   1024,
+		SHA256:       strings.Repeat("ab", 32),
+	}
+	payload := m.SignedPayload()
+	assert.True(t, bytes.HasPrefix(payload, []byte(signaturePrefix)))
+	assert.Contains(t, string(payload), `"sha256":"abab`)
+
+	// Only the signed fields matter, and not the time zone they were read in
+	other := *m
+	other.StartedAt = started.In(time.FixedZone("CET", 3600))
+	other.ToolVersion = "pg_dump (PostgreSQL) 17.2"
+	other.RunID = "42"
+	assert.Equal(t, payload, other.SignedPayload())
+
+	other.StoredSize++
+	assert.NotEqual(t, payload, other.SignedPayload())
+}
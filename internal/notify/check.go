@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CheckStatus is the outcome of a single check
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "passed"
+	CheckFailed  CheckStatus = "failed"
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// CheckResult is one named check performed against a backup
+type CheckResult struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// CheckSummary reports the checks run against an existing backup, such as
+// verifying that it can be restored. Kind names the operation ("verify" or
+// "drill").
+type CheckSummary struct {
+	Kind         string
+	DatabaseType string
+	DatabaseName string
+	BackupKey    string
+	Checks       []CheckResult
+	Duration     time.Duration
+	Success      bool
+	Error        error
+}
+
+type CheckWebhookPayload struct {
+	Kind         string        `json:"kind"`
+	Status       string        `json:"status"`
+	DatabaseType string        `json:"database_type"`
+	DatabaseName string        `json:"database_name"`
+	BackupKey    string        `json:"backup_key,omitempty"`
+	Checks       []CheckResult `json:"checks"`
+	Duration     string        `json:"duration"`
+	Error        string        `json:"error,omitempty"`
+	Timestamp    time.Time     `json:"timestamp"`
+	Repository   string        `json:"repository,omitempty"`
+	RunID        string        `json:"run_id,omitempty"`
+	RunURL       string        `json:"run_url,omitempty"`
+}
+
+func WriteGitHubCheckSummary(summary *CheckSummary) error {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil // Not running in GitHub Actions
+	}
+
+	return appendToFile(summaryFile, buildCheckSummaryMarkdown(summary), "summary")
+}
+
+func buildCheckSummaryMarkdown(summary *CheckSummary) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("## Database Backup %s\n\n", checkKindTitle(summary.Kind)))
+
+	if summary.Success {
+		sb.WriteString("**Status:** :white_check_mark: Passed\n\n")
+	} else {
+		sb.WriteString("**Status:** :x: Failed\n\n")
+	}
+
+	sb.WriteString("| Property | Value |\n")
+	sb.WriteString("|----------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Database Type | %s |\n", summary.DatabaseType))
+	sb.WriteString(fmt.Sprintf("| Database Name | %s |\n", summary.DatabaseName))
+	if summary.BackupKey != "" {
+		sb.WriteString(fmt.Sprintf("| Backup Key | `%s` |\n", summary.BackupKey))
+	}
+	sb.WriteString(fmt.Sprintf("| Duration | %s |\n", summary.Duration.Round(time.Millisecond)))
+	if summary.Error != nil {
+		sb.WriteString(fmt.Sprintf("| Error | %s |\n", summary.Error.Error()))
+	}
+
+	if len(summary.Checks) > 0 {
+		sb.WriteString("\n| Check | Status | Detail |\n")
+		sb.WriteString("|-------|--------|--------|\n")
+		for _, check := range summary.Checks {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", check.Name, checkStatusEmoji(check.Status), check.Detail))
+		}
+	}
+
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func checkKindTitle(kind string) string {
+	switch kind {
+	case "verify":
+		return "Verification"
+	case "drill":
+		return "Restore Drill"
+	case "":
+		return "Check"
+	default:
+		return strings.ToUpper(kind[:1]) + kind[1:]
+	}
+}
+
+func checkStatusEmoji(status CheckStatus) string {
+	switch status {
+	case CheckPassed:
+		return ":white_check_mark:"
+	case CheckSkipped:
+		return ":heavy_minus_sign:"
+	default:
+		return ":x:"
+	}
+}
+
+// NotifyCheck sends the result of a check run to the webhook
+func (n *WebhookNotifier) NotifyCheck(ctx context.Context, summary *CheckSummary) error {
+	if n.url == "" {
+		return nil
+	}
+
+	return n.send(ctx, buildCheckWebhookPayload(summary))
+}
+
+func buildCheckWebhookPayload(summary *CheckSummary) *CheckWebhookPayload {
+	payload := &CheckWebhookPayload{
+		Kind:         summary.Kind,
+		DatabaseType: summary.DatabaseType,
+		DatabaseName: summary.DatabaseName,
+		BackupKey:    summary.BackupKey,
+		Checks:       summary.Checks,
+		Duration:     summary.Duration.String(),
+		Timestamp:    time.Now().UTC(),
+	}
+
+	if summary.Success {
+		payload.Status = "success"
+	} else {
+		payload.Status = "failure"
+		if summary.Error != nil {
+			payload.Error = summary.Error.Error()
+		}
+	}
+
+	if payload.Checks == nil {
+		payload.Checks = []CheckResult{}
+	}
+
+	payload.Repository, payload.RunID, payload.RunURL = GitHubRunContext()
+
+	return payload
+}
@@ -45,7 +45,7 @@ func TestBackupSummary_Fields(t *testing.T) {
 	assert.Equal(t, 3, summary.DeletedBackups)
 }
 
-// Tests for formatBytes
+// Tests for FormatBytes
 func TestFormatBytes(t *testing.T) {
 	t.Parallel()
 
@@ -68,7 +68,7 @@ func TestFormatBytes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			result := formatBytes(tt.bytes)
+			result := FormatBytes(tt.bytes)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -150,6 +150,69 @@ func TestBuildSummaryMarkdown_NoDeletedBackups(t *testing.T) {
 	assert.NotContains(t, markdown, "Old Backups Deleted")
 }
 
+func TestBuildSummaryMarkdown_RetentionDryRun(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType:    "postgres",
+		DatabaseName:    "test",
+		BackupKey:       "test.dump.gz",
+		Success:         true,
+		DeletedBackups:  4,
+		RetentionDryRun: true,
+		ReclaimedBytes:  3 * 1024 * 1024,
+	}
+
+	markdown := buildSummaryMarkdown(summary)
+
+	assert.Contains(t, markdown, "| Old Backups To Delete (dry run) | 4 |")
+	assert.Contains(t, markdown, "| Space Reclaimed | 3.0 MB |")
+	assert.NotContains(t, markdown, "Old Backups Deleted")
+}
+
+func TestBuildSummaryMarkdown_RetentionSkipped(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType:     "postgres",
+		DatabaseName:     "test",
+		BackupKey:        "test.dump.gz",
+		Success:          true,
+		RetentionSkipped: "new backup failed verification: checksum mismatch",
+	}
+
+	markdown := buildSummaryMarkdown(summary)
+	assert.Contains(t, markdown, "| Retention | :warning: Skipped: new backup failed verification: checksum mismatch |")
+
+	payload := buildWebhookPayload(summary)
+	assert.Equal(t, summary.RetentionSkipped, payload.RetentionSkipped)
+}
+
+func TestBuildBudgetSummaryMarkdown(t *testing.T) {
+	t.Parallel()
+
+	summary := &BudgetSummary{
+		Destination:    "r2:account/bucket",
+		Budget:         10 * 1024 * 1024 * 1024,
+		DeletedBackups: 2,
+		ReclaimedBytes: 1536,
+	}
+
+	markdown := buildBudgetSummaryMarkdown(summary)
+	assert.Contains(t, markdown, "## Storage Budget")
+	assert.Contains(t, markdown, ":white_check_mark: Success")
+	assert.Contains(t, markdown, "| Destination | `r2:account/bucket` |")
+	assert.Contains(t, markdown, "| Budget | 10.0 GB |")
+	assert.Contains(t, markdown, "| Old Backups Deleted | 2 |")
+	assert.Contains(t, markdown, "| Space Reclaimed | 1.5 KB |")
+
+	summary.Error = errors.New("access denied")
+	markdown = buildBudgetSummaryMarkdown(summary)
+	assert.Contains(t, markdown, ":x: Failed")
+	assert.Contains(t, markdown, "| Error | access denied |")
+	assert.NotContains(t, markdown, "Space Reclaimed")
+}
+
 func TestBuildSummaryMarkdown_NoCompressionOrEncryption(t *testing.T) {
 	t.Parallel()
 
@@ -648,7 +711,7 @@ func TestFormatBytes_NegativeValue(t *testing.T) {
 	t.Parallel()
 
 	// This tests boundary condition - negative values are unusual but shouldn't crash
-	result := formatBytes(-1)
+	result := FormatBytes(-1)
 	// The function doesn't handle negative values specially, but it shouldn't panic
 	assert.NotEmpty(t, result)
 }
@@ -709,3 +772,204 @@ func TestSetGitHubOutput_InvalidPath(t *testing.T) {
 	err := SetGitHubOutput("key", "value")
 	assert.Error(t, err)
 }
+
+// Tests for CheckSummary
+func TestBuildCheckSummaryMarkdown_Passed(t *testing.T) {
+	t.Parallel()
+
+	summary := &CheckSummary{
+		Kind:         "verify",
+		DatabaseType: "postgres",
+		DatabaseName: "proddb",
+		BackupKey:    "backups/prod/postgres-proddb-20240115-140532.dump.gz.enc",
+		Checks: []CheckResult{
+			{Name: "download", Status: CheckPassed, Detail: "1024 bytes read"},
+			{Name: "decompression", Status: CheckSkipped, Detail: "backup is not compressed"},
+		},
+		Duration: 2 * time.Second,
+		Success:  true,
+	}
+
+	markdown := buildCheckSummaryMarkdown(summary)
+
+	assert.Contains(t, markdown, "## Database Backup Verification")
+	assert.Contains(t, markdown, ":white_check_mark: Passed")
+	assert.Contains(t, markdown, "| Backup Key | `backups/prod/postgres-proddb-20240115-140532.dump.gz.enc` |")
+	assert.Contains(t, markdown, "| download | :white_check_mark: | 1024 bytes read |")
+	assert.Contains(t, markdown, "| decompression | :heavy_minus_sign: | backup is not compressed |")
+	assert.NotContains(t, markdown, "| Error |")
+}
+
+func TestBuildCheckSummaryMarkdown_Failed(t *testing.T) {
+	t.Parallel()
+
+	summary := &CheckSummary{
+		Kind:         "verify",
+		DatabaseType: "mysql",
+		DatabaseName: "users",
+		Checks: []CheckResult{
+			{Name: "decryption", Status: CheckFailed, Detail: "failed to decrypt chunk 3"},
+		},
+		Success: false,
+		Error:   errors.New("decryption check failed"),
+	}
+
+	markdown := buildCheckSummaryMarkdown(summary)
+
+	assert.Contains(t, markdown, ":x: Failed")
+	assert.Contains(t, markdown, "| Error | decryption check failed |")
+	assert.Contains(t, markdown, "| decryption | :x: | failed to decrypt chunk 3 |")
+	assert.NotContains(t, markdown, "| Backup Key |")
+}
+
+func TestWriteGitHubCheckSummary_InGitHubActions(t *testing.T) {
+	summaryFile := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryFile)
+
+	err := WriteGitHubCheckSummary(&CheckSummary{Kind: "verify", DatabaseName: "testdb", Success: true})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Database Backup Verification")
+	assert.Contains(t, string(content), "testdb")
+}
+
+func TestBuildCheckWebhookPayload(t *testing.T) {
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_RUN_ID", "12345")
+	t.Setenv("GITHUB_SERVER_URL", "https://github.com")
+
+	summary := &CheckSummary{
+		Kind:         "verify",
+		DatabaseType: "mongodb",
+		DatabaseName: "events",
+		BackupKey:    "backups/events/mongodb-events-20240115-140532.tar.gz",
+		Duration:     time.Minute,
+		Success:      false,
+		Error:        errors.New("payload check failed"),
+	}
+
+	payload := buildCheckWebhookPayload(summary)
+
+	assert.Equal(t, "verify", payload.Kind)
+	assert.Equal(t, "failure", payload.Status)
+	assert.Equal(t, "events", payload.DatabaseName)
+	assert.Equal(t, "payload check failed", payload.Error)
+	assert.NotNil(t, payload.Checks)
+	assert.Equal(t, "1m0s", payload.Duration)
+	assert.Equal(t, "https://github.com/owner/repo/actions/runs/12345", payload.RunURL)
+}
+
+func TestWebhookNotifier_NotifyCheck(t *testing.T) {
+	t.Parallel()
+
+	var receivedPayload CheckWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := json.NewDecoder(r.Body).Decode(&receivedPayload)
+		assert.NoError(t, err)
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL)
+	summary := &CheckSummary{
+		Kind:         "verify",
+		DatabaseType: "postgres",
+		DatabaseName: "testdb",
+		BackupKey:    "test.dump.gz",
+		Checks:       []CheckResult{{Name: "payload", Status: CheckPassed}},
+		Success:      true,
+	}
+
+	err := notifier.NotifyCheck(context.Background(), summary)
+	require.NoError(t, err)
+
+	assert.Equal(t, "verify", receivedPayload.Kind)
+	assert.Equal(t, "success", receivedPayload.Status)
+	assert.Equal(t, "test.dump.gz", receivedPayload.BackupKey)
+	require.Len(t, receivedPayload.Checks, 1)
+	assert.Equal(t, CheckPassed, receivedPayload.Checks[0].Status)
+}
+
+func TestBuildSummaryMarkdown_Attempts(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType: "postgres",
+		DatabaseName: "proddb",
+		Success:      true,
+		Attempts:     1,
+	}
+	assert.NotContains(t, buildSummaryMarkdown(summary), "Attempts", "A first-try success needs no attempts row")
+
+	summary.Attempts = 3
+	assert.Contains(t, buildSummaryMarkdown(summary), "| Attempts | 3 |")
+
+	summary.Success = false
+	summary.Error = errors.New("connection reset by peer")
+	assert.Contains(t, buildSummaryMarkdown(summary), "| Attempts | 3 |")
+}
+
+func TestBuildWebhookPayload_Attempts(t *testing.T) {
+	t.Parallel()
+
+	payload := buildWebhookPayload(&BackupSummary{Success: false, Error: errors.New("boom"), Attempts: 2})
+	assert.Equal(t, 2, payload.Attempts)
+}
+
+func TestBuildSummaryMarkdown_DumpCompression(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType: "postgres",
+		DatabaseName: "proddb",
+		Success:      true,
+	}
+	assert.NotContains(t, buildSummaryMarkdown(summary), "Dump Compression")
+
+	summary.DumpCompression = "gzip"
+	assert.Contains(t, buildSummaryMarkdown(summary), "| Dump Compression | gzip |")
+	assert.Equal(t, "gzip", buildWebhookPayload(summary).DumpCompression)
+}
+
+func TestBuildSummaryMarkdown_Destinations(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType: "postgres",
+		DatabaseName: "proddb",
+		Success:      true,
+	}
+	assert.NotContains(t, buildSummaryMarkdown(summary), "Destination")
+
+	summary.Destinations = []DestinationResult{
+		{Name: "r2", Success: true},
+		{Name: "s3", Success: false, Error: "access denied"},
+	}
+	markdown := buildSummaryMarkdown(summary)
+	assert.Contains(t, markdown, "| Destination r2 | :white_check_mark: |")
+	assert.Contains(t, markdown, "| Destination s3 | :x: access denied |")
+	assert.Equal(t, summary.Destinations, buildWebhookPayload(summary).Destinations)
+}
+
+func TestBuildSummaryMarkdown_Signature(t *testing.T) {
+	t.Parallel()
+
+	summary := &BackupSummary{
+		DatabaseType: "postgres",
+		DatabaseName: "proddb",
+		Success:      true,
+	}
+	assert.Contains(t, buildSummaryMarkdown(summary), "| Signed | :x: |")
+	payload := buildWebhookPayload(summary)
+	assert.False(t, payload.Signed)
+	assert.Empty(t, payload.SignatureKeyID)
+
+	summary.SignatureKeyID = "0123456789abcdef"
+	assert.Contains(t, buildSummaryMarkdown(summary), "| Signed | :white_check_mark: key `0123456789abcdef` |")
+	payload = buildWebhookPayload(summary)
+	assert.True(t, payload.Signed)
+	assert.Equal(t, "0123456789abcdef", payload.SignatureKeyID)
+}
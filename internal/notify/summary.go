@@ -4,20 +4,54 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 type BackupSummary struct {
-	DatabaseType   string
-	DatabaseName   string
-	BackupKey      string
-	BackupSize     int64
-	Compressed     bool
-	Encrypted      bool
-	Duration       time.Duration
-	Success        bool
-	Error          error
+	DatabaseType    string
+	DatabaseName    string
+	BackupKey       string
+	BackupSize      int64
+	Compressed      bool
+	DumpCompression string // compression applied by the dump tool itself
+	Encrypted       bool
+	SignatureKeyID  string // key the manifest was signed with, empty if unsigned
+	Duration        time.Duration
+	Success         bool
+	Error           error
+	DeletedBackups  int
+	Attempts        int // export and upload attempts, including retries
+
+	RetentionDryRun  bool   // DeletedBackups were only reported, not deleted
+	RetentionSkipped string // why retention didn't run, if it was enabled
+	ReclaimedBytes   int64  // storage freed by deleting old backups
+
+	// RetentionDeletedKeys lists the backups retention deleted, or with a
+	// dry run would have, by storage destination
+	RetentionDeletedKeys map[string][]string
+
+	// Where the backup was uploaded, primary first; only listed when it is
+	// replicated to more than one destination
+	Destinations []DestinationResult
+}
+
+// DestinationResult is the outcome of uploading a backup to one destination
+type DestinationResult struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BudgetSummary reports a pass of the storage budget shared by every
+// database in a bucket
+type BudgetSummary struct {
+	Destination    string
+	Budget         int64
 	DeletedBackups int
+	ReclaimedBytes int64
+	DryRun         bool
+	Error          error
 }
 
 func WriteGitHubSummary(summary *BackupSummary) error {
@@ -26,19 +60,7 @@ func WriteGitHubSummary(summary *BackupSummary) error {
 		return nil // Not running in GitHub Actions
 	}
 
-	content := buildSummaryMarkdown(summary)
-
-	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open summary file: %w", err)
-	}
-	defer f.Close()
-
-	if _, err := f.WriteString(content); err != nil {
-		return fmt.Errorf("failed to write summary: %w", err)
-	}
-
-	return nil
+	return appendToFile(summaryFile, buildSummaryMarkdown(summary), "summary")
 }
 
 func buildSummaryMarkdown(summary *BackupSummary) string {
@@ -59,16 +81,85 @@ func buildSummaryMarkdown(summary *BackupSummary) string {
 
 	if summary.Success {
 		sb.WriteString(fmt.Sprintf("| Backup Key | `%s` |\n", summary.BackupKey))
-		sb.WriteString(fmt.Sprintf("| Backup Size | %s |\n", formatBytes(summary.BackupSize)))
+		sb.WriteString(fmt.Sprintf("| Backup Size | %s |\n", FormatBytes(summary.BackupSize)))
 		sb.WriteString(fmt.Sprintf("| Compressed | %s |\n", boolToEmoji(summary.Compressed)))
+		if summary.DumpCompression != "" {
+			sb.WriteString(fmt.Sprintf("| Dump Compression | %s |\n", summary.DumpCompression))
+		}
 		sb.WriteString(fmt.Sprintf("| Encrypted | %s |\n", boolToEmoji(summary.Encrypted)))
+		if summary.SignatureKeyID != "" {
+			sb.WriteString(fmt.Sprintf("| Signed | :white_check_mark: key `%s` |\n", summary.SignatureKeyID))
+		} else {
+			sb.WriteString("| Signed | :x: |\n")
+		}
 		sb.WriteString(fmt.Sprintf("| Duration | %s |\n", summary.Duration.Round(time.Millisecond)))
 
 		if summary.DeletedBackups > 0 {
-			sb.WriteString(fmt.Sprintf("| Old Backups Deleted | %d |\n", summary.DeletedBackups))
+			label := "Old Backups Deleted"
+			if summary.RetentionDryRun {
+				label = "Old Backups To Delete (dry run)"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %d |\n", label, summary.DeletedBackups))
+			sb.WriteString(fmt.Sprintf("| Space Reclaimed | %s |\n", FormatBytes(summary.ReclaimedBytes)))
+		}
+		if summary.RetentionSkipped != "" {
+			sb.WriteString(fmt.Sprintf("| Retention | :warning: Skipped: %s |\n", summary.RetentionSkipped))
+		}
+	} else {
+		sb.WriteString(fmt.Sprintf("| Error | %s |\n", summary.Error.Error()))
+	}
+
+	if summary.Attempts > 1 {
+		sb.WriteString(fmt.Sprintf("| Attempts | %d |\n", summary.Attempts))
+	}
+
+	for _, destination := range summary.Destinations {
+		status := boolToEmoji(destination.Success)
+		if destination.Error != "" {
+			status += " " + destination.Error
 		}
+		sb.WriteString(fmt.Sprintf("| Destination %s | %s |\n", destination.Name, status))
+	}
+
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func WriteGitHubBudgetSummary(summary *BudgetSummary) error {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil // Not running in GitHub Actions
+	}
+
+	return appendToFile(summaryFile, buildBudgetSummaryMarkdown(summary), "summary")
+}
+
+func buildBudgetSummaryMarkdown(summary *BudgetSummary) string {
+	var sb strings.Builder
+
+	sb.WriteString("## Storage Budget\n\n")
+
+	if summary.Error != nil {
+		sb.WriteString("**Status:** :x: Failed\n\n")
 	} else {
+		sb.WriteString("**Status:** :white_check_mark: Success\n\n")
+	}
+
+	sb.WriteString("| Property | Value |\n")
+	sb.WriteString("|----------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Destination | `%s` |\n", summary.Destination))
+	sb.WriteString(fmt.Sprintf("| Budget | %s |\n", FormatBytes(summary.Budget)))
+
+	if summary.Error != nil {
 		sb.WriteString(fmt.Sprintf("| Error | %s |\n", summary.Error.Error()))
+	} else {
+		label := "Old Backups Deleted"
+		if summary.DryRun {
+			label = "Old Backups To Delete (dry run)"
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %d |\n", label, summary.DeletedBackups))
+		sb.WriteString(fmt.Sprintf("| Space Reclaimed | %s |\n", FormatBytes(summary.ReclaimedBytes)))
 	}
 
 	sb.WriteString("\n")
@@ -76,7 +167,8 @@ func buildSummaryMarkdown(summary *BackupSummary) string {
 	return sb.String()
 }
 
-func formatBytes(bytes int64) string {
+// FormatBytes renders a byte count in human-readable binary units (e.g. "1.5 MB")
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -102,14 +194,26 @@ func SetGitHubOutput(name, value string) error {
 		return nil
 	}
 
-	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return appendToFile(outputFile, fmt.Sprintf("%s=%s\n", name, value), "output")
+}
+
+// appendMu serializes appends from databases backed up in parallel
+var appendMu sync.Mutex
+
+// appendToFile appends content to one of the files GitHub Actions provides
+// for step summaries and outputs; kind names the file in error messages
+func appendToFile(path, content, kind string) error {
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
+		return fmt.Errorf("failed to open %s file: %w", kind, err)
 	}
 	defer f.Close()
 
-	if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
+	if _, err := f.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", kind, err)
 	}
 
 	return nil
@@ -11,19 +11,25 @@ import (
 )
 
 type WebhookPayload struct {
-	Status       string    `json:"status"`
-	DatabaseType string    `json:"database_type"`
-	DatabaseName string    `json:"database_name"`
-	BackupKey    string    `json:"backup_key,omitempty"`
-	BackupSize   int64     `json:"backup_size,omitempty"`
-	Compressed   bool      `json:"compressed"`
-	Encrypted    bool      `json:"encrypted"`
-	Duration     string    `json:"duration"`
-	Error        string    `json:"error,omitempty"`
-	Timestamp    time.Time `json:"timestamp"`
-	Repository   string    `json:"repository,omitempty"`
-	RunID        string    `json:"run_id,omitempty"`
-	RunURL       string    `json:"run_url,omitempty"`
+	Status           string              `json:"status"`
+	DatabaseType     string              `json:"database_type"`
+	DatabaseName     string              `json:"database_name"`
+	BackupKey        string              `json:"backup_key,omitempty"`
+	BackupSize       int64               `json:"backup_size,omitempty"`
+	Compressed       bool                `json:"compressed"`
+	DumpCompression  string              `json:"dump_compression,omitempty"`
+	Encrypted        bool                `json:"encrypted"`
+	Signed           bool                `json:"signed"`
+	SignatureKeyID   string              `json:"signature_key_id,omitempty"`
+	Duration         string              `json:"duration"`
+	Error            string              `json:"error,omitempty"`
+	Attempts         int                 `json:"attempts,omitempty"`
+	RetentionSkipped string              `json:"retention_skipped,omitempty"`
+	Destinations     []DestinationResult `json:"destinations,omitempty"`
+	Timestamp        time.Time           `json:"timestamp"`
+	Repository       string              `json:"repository,omitempty"`
+	RunID            string              `json:"run_id,omitempty"`
+	RunURL           string              `json:"run_url,omitempty"`
 }
 
 type WebhookNotifier struct {
@@ -45,8 +51,11 @@ func (n *WebhookNotifier) Notify(ctx context.Context, summary *BackupSummary) er
 		return nil
 	}
 
-	payload := buildWebhookPayload(summary)
+	return n.send(ctx, buildWebhookPayload(summary))
+}
 
+// send posts payload to the webhook URL as JSON
+func (n *WebhookNotifier) send(ctx context.Context, payload any) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
@@ -75,18 +84,24 @@ func (n *WebhookNotifier) Notify(ctx context.Context, summary *BackupSummary) er
 
 func buildWebhookPayload(summary *BackupSummary) *WebhookPayload {
 	payload := &WebhookPayload{
-		DatabaseType: summary.DatabaseType,
-		DatabaseName: summary.DatabaseName,
-		Compressed:   summary.Compressed,
-		Encrypted:    summary.Encrypted,
-		Duration:     summary.Duration.String(),
-		Timestamp:    time.Now().UTC(),
+		DatabaseType:    summary.DatabaseType,
+		DatabaseName:    summary.DatabaseName,
+		Compressed:      summary.Compressed,
+		DumpCompression: summary.DumpCompression,
+		Encrypted:       summary.Encrypted,
+		Duration:        summary.Duration.String(),
+		Attempts:        summary.Attempts,
+		Destinations:    summary.Destinations,
+		Timestamp:       time.Now().UTC(),
 	}
 
 	if summary.Success {
 		payload.Status = "success"
 		payload.BackupKey = summary.BackupKey
 		payload.BackupSize = summary.BackupSize
+		payload.RetentionSkipped = summary.RetentionSkipped
+		payload.Signed = summary.SignatureKeyID != ""
+		payload.SignatureKeyID = summary.SignatureKeyID
 	} else {
 		payload.Status = "failure"
 		if summary.Error != nil {
@@ -95,17 +110,20 @@ func buildWebhookPayload(summary *BackupSummary) *WebhookPayload {
 	}
 
 	// Add GitHub context if available
-	if repo := os.Getenv("GITHUB_REPOSITORY"); repo != "" {
-		payload.Repository = repo
-	}
-	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
-		payload.RunID = runID
-		if serverURL := os.Getenv("GITHUB_SERVER_URL"); serverURL != "" {
-			if repo := os.Getenv("GITHUB_REPOSITORY"); repo != "" {
-				payload.RunURL = fmt.Sprintf("%s/%s/actions/runs/%s", serverURL, repo, runID)
-			}
-		}
-	}
+	payload.Repository, payload.RunID, payload.RunURL = GitHubRunContext()
 
 	return payload
 }
+
+// GitHubRunContext returns the repository, run ID and run URL of the current
+// GitHub Actions run, or empty strings outside of GitHub Actions
+func GitHubRunContext() (repository, runID, runURL string) {
+	repository = os.Getenv("GITHUB_REPOSITORY")
+	runID = os.Getenv("GITHUB_RUN_ID")
+	if runID != "" {
+		if serverURL := os.Getenv("GITHUB_SERVER_URL"); serverURL != "" && repository != "" {
+			runURL = fmt.Sprintf("%s/%s/actions/runs/%s", serverURL, repository, runID)
+		}
+	}
+	return repository, runID, runURL
+}
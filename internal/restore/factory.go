@@ -0,0 +1,20 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+func NewImporter(target *config.DatabaseConfig) (Importer, error) {
+	switch target.Type {
+	case config.DatabaseTypePostgres:
+		return NewPostgresImporter(target), nil
+	case config.DatabaseTypeMySQL:
+		return NewMySQLImporter(target), nil
+	case config.DatabaseTypeMongoDB:
+		return NewMongoDBImporter(target), nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", target.Type)
+	}
+}
@@ -0,0 +1,14 @@
+package restore
+
+import (
+	"context"
+	"io"
+)
+
+// Importer loads a raw dump, as produced by the matching backup.Exporter,
+// into a target database
+type Importer interface {
+	Import(ctx context.Context, r io.Reader) error
+	DatabaseName() string
+	DatabaseType() string
+}
@@ -0,0 +1,113 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type MongoDBImporter struct {
+	target *config.DatabaseConfig
+}
+
+func NewMongoDBImporter(target *config.DatabaseConfig) *MongoDBImporter {
+	return &MongoDBImporter{target: target}
+}
+
+// Import unpacks the tar archive of the mongodump output directory and runs
+// mongorestore against it
+func (i *MongoDBImporter) Import(ctx context.Context, r io.Reader) error {
+	tempDir, err := os.MkdirTemp("", "mongorestore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Extract archive using tar
+	extractCmd := exec.CommandContext(ctx, "tar", "-xf", "-", "-C", tempDir)
+	extractCmd.Stdin = r
+	if output, err := extractCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extract archive: %w: %s", err, string(output))
+	}
+
+	dumpDir := filepath.Join(tempDir, "dump")
+	sourceDB, err := singleDatabaseDir(dumpDir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "mongorestore", i.buildArgs(dumpDir, sourceDB)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mongorestore failed: %w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+func (i *MongoDBImporter) DatabaseName() string {
+	return i.target.Name
+}
+
+func (i *MongoDBImporter) DatabaseType() string {
+	return "mongodb"
+}
+
+func (i *MongoDBImporter) buildArgs(dumpDir, sourceDB string) []string {
+	args := []string{"--drop"}
+
+	// If connection string is provided, use it
+	if i.target.ConnectionString != "" {
+		args = append(args, "--uri="+i.target.ConnectionString)
+	} else {
+		args = append(args,
+			fmt.Sprintf("--host=%s", i.target.Host),
+			fmt.Sprintf("--port=%d", i.target.Port),
+		)
+		if i.target.User != "" {
+			args = append(args, fmt.Sprintf("--username=%s", i.target.User))
+		}
+		if i.target.Password != "" {
+			args = append(args, fmt.Sprintf("--password=%s", i.target.Password))
+		}
+	}
+
+	// Restore into a differently named database if the target asks for one
+	if sourceDB != "" && i.target.Name != "" && i.target.Name != sourceDB {
+		args = append(args,
+			fmt.Sprintf("--nsFrom=%s.*", sourceDB),
+			fmt.Sprintf("--nsTo=%s.*", i.target.Name),
+		)
+	}
+
+	return append(args, "--dir="+dumpDir)
+}
+
+// singleDatabaseDir returns the database directory name if the dump contains
+// exactly one database, or "" otherwise
+func singleDatabaseDir(dumpDir string) (string, error) {
+	entries, err := os.ReadDir(dumpDir)
+	if err != nil {
+		return "", fmt.Errorf("archive does not contain a mongodump directory: %w", err)
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	if len(dirs) == 1 {
+		return dirs[0], nil
+	}
+	return "", nil
+}
@@ -0,0 +1,62 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type MySQLImporter struct {
+	target *config.DatabaseConfig
+}
+
+func NewMySQLImporter(target *config.DatabaseConfig) *MySQLImporter {
+	return &MySQLImporter{target: target}
+}
+
+// Import pipes a mysqldump SQL script into the mysql client
+func (i *MySQLImporter) Import(ctx context.Context, r io.Reader) error {
+	cmd := exec.CommandContext(ctx, "mysql", i.buildArgs()...)
+	cmd.Stdin = r
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mysql failed: %w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+func (i *MySQLImporter) DatabaseName() string {
+	return i.target.Name
+}
+
+func (i *MySQLImporter) DatabaseType() string {
+	return "mysql"
+}
+
+func (i *MySQLImporter) buildArgs() []string {
+	// mysql doesn't accept connection URLs, so always pass components
+	args := []string{
+		fmt.Sprintf("--host=%s", i.target.Host),
+		fmt.Sprintf("--port=%d", i.target.Port),
+	}
+
+	if i.target.User != "" {
+		args = append(args, fmt.Sprintf("--user=%s", i.target.User))
+	}
+
+	if i.target.Password != "" {
+		args = append(args, fmt.Sprintf("--password=%s", i.target.Password))
+	}
+
+	args = append(args, i.target.Name)
+
+	return args
+}
@@ -0,0 +1,132 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+// Format describes the stages a backup's dump went through before it was
+// stored
+type Format struct {
+	Compression string // e.g. "zstd"; empty if uncompressed
+	Encryption  string // e.g. "AES-256-GCM" or "age-X25519"; empty if unencrypted
+}
+
+// FormatOf returns the format of the backup at key, taken from its manifest
+// m when it has one and otherwise from the extensions appended to the key
+func FormatOf(m *manifest.Manifest, key string) Format {
+	if m != nil {
+		f := Format{Compression: m.Compression}
+		if m.Encryption != nil {
+			f.Encryption = m.Encryption.Algorithm
+		}
+		return f
+	}
+
+	var f Format
+	name := key
+	if algorithm, ext := encrypt.ByExtension(name); algorithm != "" {
+		f.Encryption = algorithm
+		name = strings.TrimSuffix(name, ext)
+	}
+	f.Compression, _ = compress.ByExtension(name)
+	return f
+}
+
+// Open downloads a backup and reverses the pipeline that produced it:
+// encrypted backups are decrypted first, then compressed backups are
+// decompressed. The compression is detected from the decrypted stream's
+// magic bytes, falling back to the backup's format. The returned reader
+// yields the raw dump.
+func Open(ctx context.Context, backend storage.Backend, key string, keys encrypt.Keys) (io.ReadCloser, error) {
+	m, err := manifest.Fetch(ctx, backend, key)
+	if err != nil {
+		return nil, err
+	}
+	format := FormatOf(m, key)
+
+	body, err := backend.Download(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	chain := &readerChain{Reader: body, closers: []io.Closer{body}}
+
+	if format.Encryption != "" {
+		decrypted, err := Decrypt(chain.Reader, format.Encryption, keys)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+		chain.push(decrypted)
+	}
+
+	compression, r := compress.Detect(chain.Reader)
+	chain.Reader = r
+	if compression == "" {
+		compression = format.Compression
+	}
+
+	if compression != "" && compression != compress.NoneName {
+		decompressed, err := Decompress(chain.Reader, compression)
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+		chain.push(decompressed)
+	}
+
+	return chain, nil
+}
+
+// Decrypt returns a reader that decrypts r with the named algorithm, using
+// whichever of keys the backup was encrypted with
+func Decrypt(r io.Reader, algorithm string, keys encrypt.Keys) (io.ReadCloser, error) {
+	decrypted, err := keys.Decrypt(r, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	return decrypted, nil
+}
+
+// Decompress returns a reader that decompresses r with the named compression
+func Decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	compressor, err := compress.New(compression, 0)
+	if err != nil {
+		return nil, fmt.Errorf("backup uses unsupported compression %q", compression)
+	}
+	decompressed, err := compressor.Decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	return decompressed, nil
+}
+
+// readerChain reads from the last stage of a pipeline and closes every stage
+type readerChain struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *readerChain) push(rc io.ReadCloser) {
+	c.Reader = rc
+	c.closers = append(c.closers, rc)
+}
+
+// Close closes the stages in reverse order and returns the first error
+func (c *readerChain) Close() error {
+	var firstErr error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
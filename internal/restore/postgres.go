@@ -0,0 +1,83 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+type PostgresImporter struct {
+	target *config.DatabaseConfig
+}
+
+func NewPostgresImporter(target *config.DatabaseConfig) *PostgresImporter {
+	return &PostgresImporter{target: target}
+}
+
+// Import feeds a custom-format dump to pg_restore on stdin
+func (i *PostgresImporter) Import(ctx context.Context, r io.Reader) error {
+	cmd := exec.CommandContext(ctx, "pg_restore", i.buildArgs()...)
+	cmd.Env = i.buildEnv()
+	cmd.Stdin = r
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+func (i *PostgresImporter) DatabaseName() string {
+	return i.target.Name
+}
+
+func (i *PostgresImporter) DatabaseType() string {
+	return "postgres"
+}
+
+func (i *PostgresImporter) buildArgs() []string {
+	// Replace existing objects and skip ownership/grants, which rarely match
+	// between the source and the restore target
+	args := []string{
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--no-privileges",
+	}
+
+	// If connection string is provided, use it directly
+	if i.target.ConnectionString != "" {
+		return append(args, "--dbname="+i.target.ConnectionString)
+	}
+
+	args = append(args,
+		"--no-password",
+		fmt.Sprintf("--host=%s", i.target.Host),
+		fmt.Sprintf("--port=%d", i.target.Port),
+		fmt.Sprintf("--dbname=%s", i.target.Name),
+	)
+
+	if i.target.User != "" {
+		args = append(args, fmt.Sprintf("--username=%s", i.target.User))
+	}
+
+	return args
+}
+
+func (i *PostgresImporter) buildEnv() []string {
+	env := os.Environ()
+
+	if i.target.Password != "" {
+		env = append(env, fmt.Sprintf("PGPASSWORD=%s", i.target.Password))
+	}
+
+	return env
+}
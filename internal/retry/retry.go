@@ -0,0 +1,69 @@
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+// Policy controls how often and how patiently an operation is retried
+type Policy struct {
+	MaxAttempts int           // total attempts, including the first
+	BaseDelay   time.Duration // upper bound of the delay before the second attempt
+	MaxDelay    time.Duration // cap on the delay's upper bound
+}
+
+// Do calls fn until it succeeds, returns an error that isn't retryable
+// (see errors.IsRetryable), or the policy's attempts are used up. Between
+// attempts it sleeps for a random delay up to an exponentially growing
+// bound ("full jitter"), calling onRetry first if it is set. It returns the
+// number of attempts made and fn's last error.
+func Do(ctx context.Context, policy Policy, fn func(attempt int) error, onRetry func(attempt int, delay time.Duration, err error)) (int, error) {
+	maxAttempts := max(policy.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt >= maxAttempts || !errors.IsRetryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		delay := policy.delay(attempt)
+		if onRetry != nil {
+			onRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the jittered delay after the given failed attempt
+func (p Policy) delay(attempt int) time.Duration {
+	bound := p.backoff(attempt)
+	if bound <= 0 {
+		return 0
+	}
+	return rand.N(bound) + 1
+}
+
+// backoff returns BaseDelay * 2^(attempt-1), capped at MaxDelay
+func (p Policy) backoff(attempt int) time.Duration {
+	bound := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		bound *= 2
+		if p.MaxDelay > 0 && bound >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && bound > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return bound
+}
@@ -0,0 +1,122 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errTransient = syscall.ECONNRESET
+	errPermanent = errors.New("password authentication failed for user")
+)
+
+func fastPolicy(attempts int) Policy {
+	return Policy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+}
+
+func TestDo_SucceedsFirstTime(t *testing.T) {
+	t.Parallel()
+
+	attempts, err := Do(context.Background(), fastPolicy(3), func(int) error { return nil }, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDo_RetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	var retried []int
+	attempts, err := Do(context.Background(), fastPolicy(5), func(attempt int) error {
+		if attempt < 3 {
+			return errTransient
+		}
+		return nil
+	}, func(attempt int, delay time.Duration, err error) {
+		retried = append(retried, attempt)
+		assert.ErrorIs(t, err, errTransient)
+		assert.LessOrEqual(t, delay, 5*time.Millisecond)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int{1, 2}, retried)
+}
+
+func TestDo_GivesUpAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	attempts, err := Do(context.Background(), fastPolicy(3), func(int) error {
+		calls++
+		return errTransient
+	}, nil)
+
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDo_DoesNotRetryPermanentErrors(t *testing.T) {
+	t.Parallel()
+
+	attempts, err := Do(context.Background(), fastPolicy(3), func(int) error { return errPermanent }, nil)
+
+	assert.ErrorIs(t, err, errPermanent)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDo_ZeroAttemptsRunsOnce(t *testing.T) {
+	t.Parallel()
+
+	attempts, err := Do(context.Background(), Policy{}, func(int) error { return errTransient }, nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDo_StopsWaitingOnCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	start := time.Now()
+	attempts, err := Do(ctx, policy, func(int) error { return errTransient }, func(int, time.Duration, error) {
+		cancel()
+	})
+
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	t.Parallel()
+
+	policy := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	assert.Equal(t, time.Second, policy.backoff(1))
+	assert.Equal(t, 2*time.Second, policy.backoff(2))
+	assert.Equal(t, 4*time.Second, policy.backoff(3))
+	assert.Equal(t, 8*time.Second, policy.backoff(4))
+	assert.Equal(t, 10*time.Second, policy.backoff(5))
+	assert.Equal(t, 10*time.Second, policy.backoff(50))
+}
+
+func TestPolicy_DelayIsJittered(t *testing.T) {
+	t.Parallel()
+
+	policy := Policy{BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	for range 100 {
+		d := policy.delay(3)
+		assert.Greater(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, 4*time.Second)
+	}
+}
@@ -0,0 +1,133 @@
+// Package signing signs backup manifests with Ed25519, so anyone holding only
+// the public key can check a backup came from the pipeline and wasn't
+// replaced in storage.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+)
+
+// Algorithm names the signature algorithm in manifests
+const Algorithm = "Ed25519"
+
+// KeyID returns a short, stable fingerprint of a public key for manifests
+// and logs
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Signer signs manifests with an Ed25519 private key
+type Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+// NewSigner returns a signer for the 32-byte Ed25519 seed
+func NewSigner(seed []byte) (*Signer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be exactly %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	return &Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}, nil
+}
+
+// ParseSigner returns a signer for a base64-encoded 32-byte seed, e.g. one
+// written by `openssl rand -base64 32`
+func ParseSigner(encoded string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("signing key must be base64-encoded: %w", err)
+	}
+	return NewSigner(seed)
+}
+
+// PublicKey returns the public key signatures are checked with
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the fingerprint of the signer's public key
+func (s *Signer) KeyID() string {
+	return s.id
+}
+
+// Sign sets m's signature over its signed payload. Fields outside the payload
+// can be changed afterwards without invalidating it.
+func (s *Signer) Sign(m *manifest.Manifest) {
+	m.Signature = &manifest.Signature{
+		Algorithm: Algorithm,
+		KeyID:     s.id,
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, m.SignedPayload())),
+	}
+}
+
+// Verifier checks manifest signatures against a set of trusted public keys
+type Verifier struct {
+	keys map[string]ed25519.PublicKey // by KeyID
+}
+
+// NewVerifier returns a verifier trusting pubs
+func NewVerifier(pubs ...ed25519.PublicKey) (*Verifier, error) {
+	if len(pubs) == 0 {
+		return nil, fmt.Errorf("no public keys")
+	}
+	keys := make(map[string]ed25519.PublicKey, len(pubs))
+	for _, pub := range pubs {
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("public key must be exactly %d bytes, got %d", ed25519.PublicKeySize, len(pub))
+		}
+		keys[KeyID(pub)] = pub
+	}
+	return &Verifier{keys: keys}, nil
+}
+
+// ParseVerifier returns a verifier trusting a comma-separated list of
+// base64-encoded public keys. Listing several lets signatures made before a
+// key rotation keep verifying.
+func ParseVerifier(encoded string) (*Verifier, error) {
+	var pubs []ed25519.PublicKey
+	for _, field := range strings.Split(encoded, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("public key must be base64-encoded: %w", err)
+		}
+		pubs = append(pubs, pub)
+	}
+	return NewVerifier(pubs...)
+}
+
+// Verify returns an error unless m carries a valid signature by one of the
+// trusted keys
+func (v *Verifier) Verify(m *manifest.Manifest) error {
+	sig := m.Signature
+	if sig == nil {
+		return fmt.Errorf("manifest is not signed")
+	}
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	pub, ok := v.keys[sig.KeyID]
+	if !ok {
+		return fmt.Errorf("manifest is signed by untrusted key %q", sig.KeyID)
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("signature is not valid base64: %w", err)
+	}
+	if !ed25519.Verify(pub, m.SignedPayload(), value) {
+		return fmt.Errorf("signature by key %q does not match the manifest", sig.KeyID)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	seed := make([]byte, ed25519.SeedSize)
+	_, err := rand.Read(seed)
+	require.NoError(t, err)
+	signer, err := NewSigner(seed)
+	require.NoError(t, err)
+	return signer
+}
+
+func newTestManifest() *manifest.Manifest {
+	started := time.Date(2024, 1, 15, 14, 5, 32, 0, time.UTC)
+	return &manifest.Manifest{
+		Version:      manifest.Version,
+		Key:          "backups/app/postgres-app-20240115-140532.dump.gz",
+		DatabaseName: "app",
+		DatabaseType: "postgres",
+		StartedAt:    started,
+		FinishedAt:   started.Add(time.Minute),
+		StoredSize:   1024,
+		SHA256:       strings.Repeat("ab", 32),
+		Compression:  "gzip",
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t)
+	verifier, err := NewVerifier(signer.PublicKey())
+	require.NoError(t, err)
+
+	m := newTestManifest()
+	signer.Sign(m)
+	require.NotNil(t, m.Signature)
+	assert.Equal(t, Algorithm, m.Signature.Algorithm)
+	assert.Equal(t, KeyID(signer.PublicKey()), m.Signature.KeyID)
+	require.NoError(t, verifier.Verify(m))
+
+	// The signature survives an encode/decode round trip
+	var buf bytes.Buffer
+	require.NoError(t, m.Encode(&buf))
+	decoded, err := manifest.Decode(&buf)
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(decoded))
+
+	// Fields outside the signed payload can change
+	m.RunURL = "https://example.com/run"
+	assert.NoError(t, verifier.Verify(m))
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t)
+	verifier, err := NewVerifier(signer.PublicKey())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		tamper  func(m *manifest.Manifest)
+		wantErr string
+	}{
+		{"unsigned", func(m *manifest.Manifest) { m.Signature = nil }, "manifest is not signed"},
+		{"replaced object", func(m *manifest.Manifest) { m.SHA256 = strings.Repeat("cd", 32) }, "does not match the manifest"},
+		{"resized object", func(m *manifest.Manifest) { m.StoredSize++ }, "does not match the manifest"},
+		{"other database", func(m *manifest.Manifest) { m.DatabaseName = "billing" }, "does not match the manifest"},
+		{"moved", func(m *manifest.Manifest) { m.Key = "backups/app/other.dump.gz" }, "does not match the manifest"},
+		{"backdated", func(m *manifest.Manifest) { m.StartedAt = m.StartedAt.Add(-time.Hour) }, "does not match the manifest"},
+		{"untrusted key", func(m *manifest.Manifest) { newTestSigner(t).Sign(m) }, "untrusted key"},
+		{"algorithm", func(m *manifest.Manifest) { m.Signature.Algorithm = "RSA" }, `unsupported signature algorithm "RSA"`},
+		{"garbage", func(m *manifest.Manifest) { m.Signature.Value = "not base64!" }, "not valid base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := newTestManifest()
+			signer.Sign(m)
+			tt.tamper(m)
+			assert.ErrorContains(t, verifier.Verify(m), tt.wantErr)
+		})
+	}
+}
+
+func TestParseVerifier_Rotation(t *testing.T) {
+	t.Parallel()
+
+	old, current := newTestSigner(t), newTestSigner(t)
+	verifier, err := ParseVerifier(base64.StdEncoding.EncodeToString(current.PublicKey()) + ", " + base64.StdEncoding.EncodeToString(old.PublicKey()))
+	require.NoError(t, err)
+
+	for _, signer := range []*Signer{old, current} {
+		m := newTestManifest()
+		signer.Sign(m)
+		assert.NoError(t, verifier.Verify(m))
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseSigner("not base64!")
+	assert.ErrorContains(t, err, "must be base64-encoded")
+	_, err = ParseSigner(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "must be exactly 32 bytes, got 5")
+
+	_, err = ParseVerifier("")
+	assert.ErrorContains(t, err, "no public keys")
+	_, err = ParseVerifier(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "must be exactly 32 bytes, got 5")
+}
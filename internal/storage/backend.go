@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	appcfg "github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+// Backend stores backup objects under a key prefix.
+//
+// Upload takes a key relative to the backend's prefix; every other method
+// takes the full key, as returned in BackupObject.Key by List.
+type Backend interface {
+	Upload(ctx context.Context, key string, body io.Reader) error
+	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*BackupObject, error)
+	// List returns every object under the prefix, newest first
+	List(ctx context.Context) ([]BackupObject, error)
+	Delete(ctx context.Context, key string) error
+	Prefix() string
+}
+
+type BackupObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// NewBackend creates the storage backend selected in the configuration,
+// scoped to the given prefix
+func NewBackend(ctx context.Context, cfg *appcfg.Config, prefix string) (Backend, error) {
+	switch cfg.StorageBackend {
+	case appcfg.StorageBackendR2, "":
+		return NewR2Client(ctx, cfg, prefix)
+	case appcfg.StorageBackendS3:
+		return NewS3Client(ctx, cfg, prefix)
+	case appcfg.StorageBackendLocal:
+		return NewLocalBackend(cfg.LocalStoragePath, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.StorageBackend)
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+// LocalBackend stores backups as files in a directory, using the object key
+// (with "/" separators) as the path relative to the root
+type LocalBackend struct {
+	root   string
+	prefix string
+}
+
+func NewLocalBackend(root, prefix string) (*LocalBackend, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local storage path is required")
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+	return &LocalBackend{root: root, prefix: prefix}, nil
+}
+
+// Upload writes body to a temporary file and renames it into place, so a
+// failed or partial upload never leaves a truncated backup behind
+func (b *LocalBackend) Upload(ctx context.Context, key string, body io.Reader) error {
+	fullKey := b.prefix + key
+	file, err := b.filePath(fullKey)
+	if err != nil {
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := io.Copy(tmp, &contextReader{ctx: ctx, r: body}); err != nil {
+		tmp.Close()
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return errors.NewStorageError("upload", b.root, fullKey, err)
+	}
+
+	return nil
+}
+
+func (b *LocalBackend) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := b.filePath(key)
+	if err != nil {
+		return nil, errors.NewStorageError("download", b.root, key, err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.NewStorageError("download", b.root, key, wrapNotExist(err))
+	}
+	return f, nil
+}
+
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*BackupObject, error) {
+	file, err := b.filePath(key)
+	if err != nil {
+		return nil, errors.NewStorageError("stat", b.root, key, err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.NewStorageError("stat", b.root, key, wrapNotExist(err))
+	}
+
+	return &BackupObject{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (b *LocalBackend) List(ctx context.Context) ([]BackupObject, error) {
+	var backups []BackupObject
+
+	// Only walk the directory the prefix lives in
+	start := filepath.Join(b.root, filepath.FromSlash(path.Dir(b.prefix+"x")))
+	if _, err := os.Stat(start); stderrors.Is(err, fs.ErrNotExist) {
+		return backups, nil
+	}
+
+	err := filepath.WalkDir(start, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, b.prefix) || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		backups = append(backups, BackupObject{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewStorageError("list", b.root, b.prefix, err)
+	}
+
+	// Sort by last modified (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].LastModified.After(backups[j].LastModified)
+	})
+
+	return backups, nil
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	file, err := b.filePath(key)
+	if err != nil {
+		return errors.NewStorageError("delete", b.root, key, err)
+	}
+
+	if err := os.Remove(file); err != nil {
+		return errors.NewStorageError("delete", b.root, key, wrapNotExist(err))
+	}
+	return nil
+}
+
+func (b *LocalBackend) Root() string {
+	return b.root
+}
+
+func (b *LocalBackend) Prefix() string {
+	return b.prefix
+}
+
+// filePath resolves a key to a file path, refusing keys that would escape the root
+func (b *LocalBackend) filePath(key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(b.root, rel), nil
+}
+
+// wrapNotExist maps missing files onto errors.ErrObjectNotFound
+func wrapNotExist(err error) error {
+	if stderrors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", errors.ErrObjectNotFound, err)
+	}
+	return err
+}
+
+// contextReader stops a copy once ctx is canceled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
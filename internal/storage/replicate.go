@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultReplicaBufferSize is how far an optional destination's upload may
+// fall behind the stream before it is dropped: eight upload parts of the S3
+// and R2 backends, so a replica that is only slower than the primary keeps up
+const DefaultReplicaBufferSize = 8 * uploadPartSize
+
+// errUploadStopped unblocks the stream to a destination whose upload
+// returned before reading all of it
+var errUploadStopped = stderrors.New("upload stopped reading")
+
+// Destination is a backend a backup is uploaded to, with a name for
+// reporting, e.g. "r2"
+type Destination struct {
+	Name    string
+	Backend Backend
+
+	// Required destinations decide the outcome of the backup: the stream
+	// waits for them, and the first one to fail stops every upload. The
+	// others are dropped when they fail or fall behind.
+	Required bool
+}
+
+// UploadResult is the outcome of uploading to one destination
+type UploadResult struct {
+	Destination string
+	Err         error
+}
+
+// UploadAll uploads body to every destination at once, reading it only
+// once: the stream is teed to each upload rather than buffered or re-read.
+// Required destinations are fed directly, so the stream goes at the pace of
+// the slowest of them; each optional one reads from a buffer of bufferSize
+// bytes (DefaultReplicaBufferSize if 0) and is dropped, like any optional
+// destination that fails, once the buffer is full. The results, in the order
+// of destinations, may then mix successes and failures. If reading body
+// fails, or a required destination fails, every upload fails with it.
+func UploadAll(ctx context.Context, destinations []Destination, key string, body io.Reader, bufferSize int64) []UploadResult {
+	if bufferSize <= 0 {
+		bufferSize = DefaultReplicaBufferSize
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make([]UploadResult, len(destinations))
+	tee := &teeWriter{ctx: ctx, streams: make([]*stream, len(destinations))}
+
+	var wg sync.WaitGroup
+	for i, destination := range destinations {
+		uploadCtx, cancelUpload := context.WithCancelCause(ctx)
+		s := &stream{required: destination.Required, cancel: cancelUpload}
+		var reader streamReader
+		if destination.Required {
+			reader, s.w = io.Pipe()
+		} else {
+			buf := newReplicaBuffer(bufferSize)
+			reader, s.w = &replicaReader{buf}, buf
+		}
+		tee.streams[i] = s
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancelUpload(nil)
+			err := destination.Backend.Upload(uploadCtx, key, reader)
+			if err != nil {
+				// Report why the upload was aborted rather than how
+				if cause := context.Cause(uploadCtx); cause != nil {
+					err = cause
+				}
+			}
+			results[i] = UploadResult{Destination: destination.Name, Err: err}
+			if err != nil && destination.Required {
+				// No point streaming the rest anywhere
+				cancel(fmt.Errorf("upload to %s failed: %w", destination.Name, err))
+			}
+			reader.CloseWithError(errUploadStopped)
+		}()
+	}
+
+	_, err := io.Copy(tee, body)
+	for _, s := range tee.streams {
+		// A nil error ends each upload's stream with EOF
+		s.w.CloseWithError(err)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// streamReader and streamWriter are the ends of a destination's stream:
+// the upload reads from one, and the tee writes to the other. Closing
+// either with an error fails the other's next call.
+type streamReader interface {
+	io.Reader
+	CloseWithError(err error) error
+}
+
+type streamWriter interface {
+	io.Writer
+	CloseWithError(err error) error
+}
+
+// stream is the tee's end of one destination's upload
+type stream struct {
+	w        streamWriter
+	required bool
+	dropped  bool
+	cancel   context.CancelCauseFunc
+}
+
+// teeWriter writes to every destination whose upload is still reading,
+// dropping the optional ones that fail and stopping when a required one
+// does or ctx is canceled
+type teeWriter struct {
+	ctx     context.Context
+	streams []*stream
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if err := context.Cause(t.ctx); err != nil {
+		return 0, err
+	}
+
+	live := 0
+	for _, s := range t.streams {
+		if s.dropped {
+			continue
+		}
+		if _, err := s.w.Write(p); err != nil {
+			if s.required {
+				if cause := context.Cause(t.ctx); cause != nil {
+					err = cause
+				}
+				return 0, err
+			}
+			// Abort the upload too, in case it is stuck on the network
+			s.dropped = true
+			s.w.CloseWithError(err)
+			s.cancel(err)
+			continue
+		}
+		live++
+	}
+	if live == 0 {
+		return 0, errUploadStopped
+	}
+	return len(p), nil
+}
+
+// replicaBuffer is a pipe with a bounded buffer: writes never block, and
+// fail once the reader has fallen more than the buffer's size behind
+type replicaBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	size   int64
+	limit  int64
+
+	closed  bool  // the writer is done
+	err     error // why the writer closed, nil for a clean end
+	readErr error // why the reader stopped, if it did
+}
+
+func newReplicaBuffer(limit int64) *replicaBuffer {
+	b := &replicaBuffer{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *replicaBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.readErr != nil:
+		return 0, b.readErr
+	case b.closed:
+		return 0, io.ErrClosedPipe
+	case b.size+int64(len(p)) > b.limit:
+		return 0, fmt.Errorf("fell more than %d bytes behind the backup stream", b.limit)
+	}
+	b.chunks = append(b.chunks, append([]byte(nil), p...))
+	b.size += int64(len(p))
+	b.cond.Signal()
+	return len(p), nil
+}
+
+// CloseWithError ends the stream. With a nil error the reader gets what is
+// buffered, then EOF; otherwise it gets err straight away.
+func (b *replicaBuffer) CloseWithError(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed, b.err = true, err
+		if err != nil {
+			b.chunks, b.size = nil, 0
+		}
+		b.cond.Broadcast()
+	}
+	return nil
+}
+
+// replicaReader is the upload's end of a replicaBuffer
+type replicaReader struct {
+	b *replicaBuffer
+}
+
+func (r *replicaReader) Read(p []byte) (int, error) {
+	b := r.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.chunks) == 0 && !b.closed && b.readErr == nil {
+		b.cond.Wait()
+	}
+	switch {
+	case b.readErr != nil:
+		return 0, io.ErrClosedPipe
+	case len(b.chunks) == 0 && b.err != nil:
+		return 0, b.err
+	case len(b.chunks) == 0:
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.chunks[0])
+	if n == len(b.chunks[0]) {
+		b.chunks[0] = nil
+		b.chunks = b.chunks[1:]
+	} else {
+		b.chunks[0] = b.chunks[0][n:]
+	}
+	b.size -= int64(n)
+	return n, nil
+}
+
+// CloseWithError stops further writes, which then fail with err
+func (r *replicaReader) CloseWithError(err error) error {
+	b := r.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readErr == nil {
+		b.readErr = err
+		b.chunks, b.size = nil, 0
+		b.cond.Broadcast()
+	}
+	return nil
+}
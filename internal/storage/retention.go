@@ -4,54 +4,277 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	appcfg "github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
 )
 
 type RetentionPolicy struct {
 	Days  int
 	Count int
+
+	// Grandfather-father-son buckets: how many calendar days, ISO weeks,
+	// months and years to keep the newest backup of. A negative count keeps
+	// one from every such period.
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+
+	// MaxSize is a budget in bytes for the database's backups, manifests
+	// included: the oldest are deleted until the rest fit, whatever the
+	// rules above say. The newest backup is never deleted to fit.
+	MaxSize int64
+
+	// MinKeep is a floor on the backups left afterwards, whatever the rules
+	// above say
+	MinKeep int
+
+	// DryRun only reports what would be deleted
+	DryRun bool
 }
 
+// RetentionResult describes what retention deleted, or with DryRun what it
+// would have deleted
 type RetentionResult struct {
-	DeletedCount int
-	DeletedKeys  []string
-	Errors       []error
+	DryRun         bool
+	DeletedCount   int
+	DeletedKeys    []string
+	ReclaimedBytes int64 // size of the deleted backups and their manifests
+	Errors         []error
 }
 
 func (p *RetentionPolicy) IsEnabled() bool {
-	return p.Days > 0 || p.Count > 0
+	return p.Days > 0 || p.Count > 0 || p.hasGFS() || p.MaxSize > 0
+}
+
+func (p *RetentionPolicy) hasGFS() bool {
+	return p.Daily != 0 || p.Weekly != 0 || p.Monthly != 0 || p.Yearly != 0
 }
 
-func ApplyRetention(ctx context.Context, client *R2Client, policy RetentionPolicy) (*RetentionResult, error) {
+// ApplyRetention deletes the backups of db that policy no longer keeps.
+// Only objects this tool created for db count: keys following its backup
+// naming, or backups whose manifest names db. A backup and its manifest are
+// deleted together, and manifests left behind by a backup that is already
+// gone are cleaned up.
+func ApplyRetention(ctx context.Context, client Backend, db *appcfg.DatabaseConfig, policy RetentionPolicy) (*RetentionResult, error) {
 	if !policy.IsEnabled() {
 		return &RetentionResult{}, nil
 	}
 
-	backups, err := client.ListBackups(ctx)
+	objects, err := client.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list backups: %w", err)
 	}
 
+	manifests := manifestSizes(objects)
+	backups := backupsOf(ctx, client, db, objects, manifests)
 	toDelete := determineBackupsToDelete(backups, policy)
 
-	result := &RetentionResult{
-		DeletedKeys: make([]string, 0, len(toDelete)),
+	result := deleteBackups(ctx, client, toDelete, manifests, policy.DryRun)
+	if policy.DryRun {
+		return result, nil
 	}
 
-	for _, backup := range toDelete {
-		if err := client.Delete(ctx, backup.Key); err != nil {
+	for _, key := range orphanedManifests(db, objects, manifests) {
+		if err := client.Delete(ctx, key); err != nil {
 			result.Errors = append(result.Errors, err)
-			log.Printf("Failed to delete backup %s: %v", backup.Key, err)
-		} else {
-			result.DeletedCount++
-			result.DeletedKeys = append(result.DeletedKeys, backup.Key)
-			log.Printf("Deleted old backup: %s", backup.Key)
+			log.Printf("Failed to delete manifest %s: %v", key, err)
 		}
 	}
 
 	return result, nil
 }
 
+// BudgetMember is a database whose backups a bucket budget may delete
+type BudgetMember struct {
+	Database *appcfg.DatabaseConfig
+	MinKeep  int // backups of the database always left behind
+
+	// Deleted lists backups of the database that retention already deleted,
+	// or with a dry run would have. They and their manifests don't count
+	// towards the budget.
+	Deleted []string
+}
+
+// ApplyBucketBudget deletes the oldest backups of members, across all of
+// them, until everything client lists totals at most budget bytes. client
+// should be scoped to the whole bucket, so objects this tool didn't create
+// count towards the budget too, though only members' backups are deleted.
+// Each member keeps its MinKeep backups, and always its newest, counting only
+// backups under its own prefix.
+func ApplyBucketBudget(ctx context.Context, client Backend, members []BudgetMember, budget int64, dryRun bool) (*RetentionResult, error) {
+	listed, err := client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	deleted := make(map[string]bool)
+	for _, member := range members {
+		for _, key := range member.Deleted {
+			deleted[key], deleted[manifest.Key(key)] = true, true
+		}
+	}
+	var objects []BackupObject
+	var total int64
+	for _, obj := range listed {
+		if !deleted[obj.Key] {
+			objects = append(objects, obj)
+			total += obj.Size
+		}
+	}
+
+	manifests := manifestSizes(objects)
+	var candidates []BackupObject
+	for _, member := range members {
+		// Backup names don't include the prefix, so a same-named database
+		// under another prefix, e.g. another deployment's, would match too
+		var own []BackupObject
+		for _, obj := range objects {
+			if strings.HasPrefix(obj.Key, member.Database.BackupPrefix) {
+				own = append(own, obj)
+			}
+		}
+		backups := backupsOf(ctx, client, member.Database, own, manifests)
+		// backups are newest first, so these are all but the protected newest
+		candidates = append(candidates, backups[min(max(member.MinKeep, 1), len(backups)):]...)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastModified.Before(candidates[j].LastModified)
+	})
+
+	var toDelete []BackupObject
+	for _, obj := range candidates {
+		if total <= budget {
+			break
+		}
+		toDelete = append(toDelete, obj)
+		total -= obj.Size
+	}
+
+	return deleteBackups(ctx, client, toDelete, manifests, dryRun), nil
+}
+
+// deleteBackups deletes each backup along with its manifest, or with dryRun
+// only reports them. A manifest is only deleted once its backup is gone, so
+// a backup that fails to delete stays restorable.
+func deleteBackups(ctx context.Context, client Backend, backups []BackupObject, manifests map[string]int64, dryRun bool) *RetentionResult {
+	result := &RetentionResult{
+		DryRun:      dryRun,
+		DeletedKeys: make([]string, 0, len(backups)),
+	}
+
+	for _, obj := range backups {
+		reclaimed := obj.Size
+		if dryRun {
+			log.Printf("Would delete old backup: %s", obj.Key)
+		} else {
+			if err := client.Delete(ctx, obj.Key); err != nil {
+				result.Errors = append(result.Errors, err)
+				log.Printf("Failed to delete backup %s: %v", obj.Key, err)
+				continue
+			}
+			log.Printf("Deleted old backup: %s", obj.Key)
+
+			manifestKey := manifest.Key(obj.Key)
+			if size, ok := manifests[manifestKey]; ok {
+				if err := client.Delete(ctx, manifestKey); err != nil {
+					result.Errors = append(result.Errors, err)
+					log.Printf("Failed to delete manifest %s: %v", manifestKey, err)
+					reclaimed -= size
+				}
+			}
+		}
+
+		result.DeletedCount++
+		result.DeletedKeys = append(result.DeletedKeys, obj.Key)
+		result.ReclaimedBytes += reclaimed
+	}
+
+	return result
+}
+
+// manifestSizes returns the size of each manifest among objects, by key
+func manifestSizes(objects []BackupObject) map[string]int64 {
+	manifests := make(map[string]int64)
+	for _, obj := range objects {
+		if manifest.IsKey(obj.Key) {
+			manifests[obj.Key] = obj.Size
+		}
+	}
+	return manifests
+}
+
+// backupsOf picks db's backups out of the listed objects, newest first.
+// Each backup's LastModified is replaced by the time the backup was taken,
+// as embedded in its name or recorded in its manifest, so copying or
+// touching objects doesn't change their age. Its Size includes the
+// manifest's, since the two are kept and deleted together.
+func backupsOf(ctx context.Context, client Backend, db *appcfg.DatabaseConfig, objects []BackupObject, manifests map[string]int64) []BackupObject {
+	var backups []BackupObject
+	for _, obj := range objects {
+		if manifest.IsKey(obj.Key) {
+			continue
+		}
+		manifestSize, hasManifest := manifests[manifest.Key(obj.Key)]
+
+		if info, err := backup.ParseKey(obj.Key); err == nil {
+			if !info.IsBackupOf(db) {
+				continue
+			}
+			obj.LastModified = info.Timestamp
+		} else if hasManifest {
+			// A name this tool doesn't recognize, but the manifest says
+			// whose backup it is
+			m, err := manifest.Fetch(ctx, client, obj.Key)
+			if err != nil {
+				log.Printf("Skipping %s for retention: %v", obj.Key, err)
+				continue
+			}
+			if m.DatabaseName != db.Name || m.DatabaseType != string(db.Type) {
+				continue
+			}
+			obj.LastModified = m.StartedAt
+		} else {
+			continue
+		}
+
+		obj.Size += manifestSize
+		backups = append(backups, obj)
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].LastModified.After(backups[j].LastModified)
+	})
+	return backups
+}
+
+// orphanedManifests returns the keys of db's manifests whose backup no
+// longer exists, e.g. because deleting the manifest failed last time
+func orphanedManifests(db *appcfg.DatabaseConfig, objects []BackupObject, manifests map[string]int64) []string {
+	present := make(map[string]bool)
+	for _, obj := range objects {
+		present[obj.Key] = true
+	}
+
+	var orphans []string
+	for key := range manifests {
+		backupKey := strings.TrimSuffix(key, manifest.Suffix)
+		if present[backupKey] {
+			continue
+		}
+		if info, err := backup.ParseKey(backupKey); err == nil && info.IsBackupOf(db) {
+			orphans = append(orphans, key)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
 func determineBackupsToDelete(backups []BackupObject, policy RetentionPolicy) []BackupObject {
 	var toDelete []BackupObject
 	now := time.Now()
@@ -72,9 +295,17 @@ func determineBackupsToDelete(backups []BackupObject, policy RetentionPolicy) []
 		}
 	}
 
+	// Backups picked by a GFS bucket are kept whatever the other rules say
+	gfs := selectGFS(backups, policy)
+
 	// Check each backup
 	for _, backup := range backups {
-		shouldDelete := false
+		if gfs[backup.Key] {
+			continue
+		}
+
+		// With only GFS buckets set, anything they don't pick goes
+		shouldDelete := policy.hasGFS() && policy.Days <= 0 && policy.Count <= 0
 
 		// Check age policy
 		if policy.Days > 0 {
@@ -97,5 +328,105 @@ func determineBackupsToDelete(backups []BackupObject, policy RetentionPolicy) []
 		}
 	}
 
+	if policy.MaxSize > 0 {
+		toDelete = fitBudget(backups, toDelete, policy.MaxSize)
+	}
+
+	// Spare the newest of the doomed backups until MinKeep are left
+	if spare := policy.MinKeep - (len(backups) - len(toDelete)); spare > 0 {
+		toDelete = toDelete[min(spare, len(toDelete)):]
+	}
+
 	return toDelete
 }
+
+// gfsPeriods names the calendar period of a backup for each GFS bucket
+var gfsPeriods = []struct {
+	count  func(RetentionPolicy) int
+	period func(time.Time) string
+}{
+	{
+		func(p RetentionPolicy) int { return p.Daily },
+		func(t time.Time) string { return t.Format("2006-01-02") },
+	},
+	{
+		func(p RetentionPolicy) int { return p.Weekly },
+		func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		},
+	},
+	{
+		func(p RetentionPolicy) int { return p.Monthly },
+		func(t time.Time) string { return t.Format("2006-01") },
+	},
+	{
+		func(p RetentionPolicy) int { return p.Yearly },
+		func(t time.Time) string { return t.Format("2006") },
+	},
+}
+
+// selectGFS returns the keys of the backups the policy's GFS buckets keep:
+// the newest backup in each of the most recent periods that have one.
+// Periods are calendar days, weeks and so on in UTC.
+func selectGFS(backups []BackupObject, policy RetentionPolicy) map[string]bool {
+	keep := make(map[string]bool)
+	if !policy.hasGFS() {
+		return keep
+	}
+
+	for _, bucket := range gfsPeriods {
+		count := bucket.count(policy)
+		if count == 0 {
+			continue
+		}
+
+		// backups are sorted newest first, so the first seen of each
+		// period is its newest
+		seen := make(map[string]bool)
+		for _, backup := range backups {
+			period := bucket.period(backup.LastModified.UTC())
+			if seen[period] {
+				continue
+			}
+			if count > 0 && len(seen) == count {
+				break
+			}
+			seen[period] = true
+			keep[backup.Key] = true
+		}
+	}
+
+	return keep
+}
+
+// fitBudget adds the oldest of the backups not yet in toDelete until the
+// ones left total at most maxSize bytes. The newest backup is never added.
+// The result is ordered like backups, newest first.
+func fitBudget(backups, toDelete []BackupObject, maxSize int64) []BackupObject {
+	doomed := make(map[string]bool, len(toDelete))
+	for _, b := range toDelete {
+		doomed[b.Key] = true
+	}
+
+	var total int64
+	for _, b := range backups {
+		if !doomed[b.Key] {
+			total += b.Size
+		}
+	}
+	for i := len(backups) - 1; i > 0 && total > maxSize; i-- {
+		if !doomed[backups[i].Key] {
+			doomed[backups[i].Key] = true
+			total -= backups[i].Size
+		}
+	}
+
+	var fitted []BackupObject
+	for _, b := range backups {
+		if doomed[b.Key] {
+			fitted = append(fitted, b)
+		}
+	}
+	return fitted
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	appcfg "github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+)
+
+const (
+	// uploadPartSize bounds the memory used per in-flight part while still
+	// allowing objects up to ~320 GiB within the 10,000 part limit
+	uploadPartSize = 32 * 1024 * 1024
+	// uploadConcurrency is the number of parts uploaded in parallel
+	uploadConcurrency = 3
+	// downloadRangeSize is the amount fetched per ranged GET, keeping each
+	// request well within the HTTP client timeout
+	downloadRangeSize = 64 * 1024 * 1024
+)
+
+// S3Client stores backups in any S3-compatible bucket (AWS S3, MinIO,
+// Cloudflare R2, ...)
+type S3Client struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// s3Options describes how to reach an S3-compatible endpoint
+type s3Options struct {
+	endpoint        string // empty uses the AWS default endpoint for the region
+	region          string
+	accessKeyID     string // empty uses the default AWS credential chain
+	secretAccessKey string
+	bucket          string
+	usePathStyle    bool
+}
+
+// NewS3Client creates a client for the generic S3-compatible backend with the
+// specified prefix
+func NewS3Client(ctx context.Context, cfg *appcfg.Config, prefix string) (*S3Client, error) {
+	return newS3Client(ctx, s3Options{
+		endpoint:        cfg.S3Endpoint,
+		region:          cfg.S3Region,
+		accessKeyID:     cfg.S3AccessKeyID,
+		secretAccessKey: cfg.S3SecretAccessKey,
+		bucket:          cfg.S3BucketName,
+		usePathStyle:    cfg.S3ForcePathStyle,
+	}, prefix)
+}
+
+func newS3Client(ctx context.Context, opts s3Options, prefix string) (*S3Client, error) {
+	// Create custom HTTP client with explicit TLS configuration
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				MaxVersion: tls.VersionTLS13,
+			},
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+		},
+		Timeout: 5 * time.Minute,
+	}
+
+	// Use the standard AWS configuration with custom HTTP client
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(opts.region),
+		config.WithHTTPClient(httpClient),
+	}
+	if opts.accessKeyID != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			opts.accessKeyID,
+			opts.secretAccessKey,
+			"",
+		)))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if opts.endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.endpoint)
+		}
+		o.UsePathStyle = opts.usePathStyle
+	})
+
+	return &S3Client{
+		client: client,
+		bucket: opts.bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// Upload streams body to the bucket as a multipart upload, so the size doesn't
+// need to be known in advance and at most uploadPartSize*uploadConcurrency
+// bytes are held in memory. If reading body fails the multipart upload is
+// aborted and no object is created.
+func (c *S3Client) Upload(ctx context.Context, key string, body io.Reader) error {
+	fullKey := c.prefix + key
+
+	// Use the upload manager for better retry handling and large file support
+	uploader := manager.NewUploader(c.client, func(u *manager.Uploader) {
+		u.PartSize = uploadPartSize
+		u.Concurrency = uploadConcurrency
+		u.LeavePartsOnError = false
+	})
+
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(fullKey),
+		Body:   body,
+	})
+	if err != nil {
+		return errors.NewStorageError("upload", c.bucket, fullKey, err)
+	}
+
+	return nil
+}
+
+// Download streams the object using a sequence of ranged GETs pinned to the
+// object's ETag, so large backups aren't subject to the per-request timeout
+// and a concurrent overwrite is detected rather than silently mixed in.
+func (c *S3Client) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	head, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.NewStorageError("download", c.bucket, key, wrapNotFound(err))
+	}
+
+	return &rangeReader{
+		ctx:    ctx,
+		client: c.client,
+		bucket: c.bucket,
+		key:    key,
+		etag:   aws.ToString(head.ETag),
+		size:   aws.ToInt64(head.ContentLength),
+	}, nil
+}
+
+func (c *S3Client) Stat(ctx context.Context, key string) (*BackupObject, error) {
+	head, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.NewStorageError("stat", c.bucket, key, wrapNotFound(err))
+	}
+
+	return &BackupObject{
+		Key:          key,
+		Size:         aws.ToInt64(head.ContentLength),
+		LastModified: aws.ToTime(head.LastModified),
+	}, nil
+}
+
+func (c *S3Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.NewStorageError("delete", c.bucket, key, err)
+	}
+
+	return nil
+}
+
+func (c *S3Client) List(ctx context.Context) ([]BackupObject, error) {
+	var backups []BackupObject
+
+	paginator := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(c.prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, errors.NewStorageError("list", c.bucket, c.prefix, err)
+		}
+
+		for _, obj := range page.Contents {
+			backups = append(backups, BackupObject{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	// Sort by last modified (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].LastModified.After(backups[j].LastModified)
+	})
+
+	return backups, nil
+}
+
+func (c *S3Client) Bucket() string {
+	return c.bucket
+}
+
+func (c *S3Client) Prefix() string {
+	return c.prefix
+}
+
+// wrapNotFound maps S3's missing-object errors onto errors.ErrObjectNotFound
+func wrapNotFound(err error) error {
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	if stderrors.As(err, &notFound) || stderrors.As(err, &noSuchKey) {
+		return fmt.Errorf("%w: %v", errors.ErrObjectNotFound, err)
+	}
+	return err
+}
+
+// rangeReader reads an object sequentially in downloadRangeSize pieces
+type rangeReader struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	etag   string
+	size   int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+
+		end := min(r.offset+downloadRangeSize, r.size) - 1
+		out, err := r.client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(r.bucket),
+			Key:     aws.String(r.key),
+			Range:   aws.String(fmt.Sprintf("bytes=%d-%d", r.offset, end)),
+			IfMatch: aws.String(r.etag),
+		})
+		if err != nil {
+			return 0, errors.NewStorageError("download", r.bucket, r.key, err)
+		}
+		r.body = out.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == io.EOF {
+		r.body.Close()
+		r.body = nil
+		if r.offset < r.size {
+			// More ranges to fetch
+			err = nil
+		}
+	}
+
+	return n, err
+}
+
+func (r *rangeReader) Close() error {
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
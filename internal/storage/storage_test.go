@@ -1,12 +1,24 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	stderrors "errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	appcfg "github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
 )
 
 // Tests for RetentionPolicy
@@ -36,6 +48,14 @@ func TestRetentionPolicy_IsEnabled(t *testing.T) {
 	}
 }
 
+func TestRetentionPolicy_IsEnabled_GFS(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []RetentionPolicy{{Daily: 7}, {Weekly: 4}, {Monthly: 12}, {Yearly: -1}} {
+		assert.True(t, policy.IsEnabled(), "%+v", policy)
+	}
+}
+
 // Tests for determineBackupsToDelete
 func TestDetermineBackupsToDelete_NoPolicy(t *testing.T) {
 	t.Parallel()
@@ -386,3 +406,801 @@ func TestDetermineBackupsToDelete_LargeBackupCount(t *testing.T) {
 		assert.False(t, toDeleteKeys[key], "backup %s should be kept", key)
 	}
 }
+
+func TestDetermineBackupsToDelete_GFS(t *testing.T) {
+	t.Parallel()
+
+	at := func(value string) time.Time {
+		ts, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return ts
+	}
+
+	tests := []struct {
+		name     string
+		backups  map[string]string // key -> LastModified
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{
+			name: "newest backup of each day",
+			backups: map[string]string{
+				"mar10-late":  "2026-03-10T18:00:00Z",
+				"mar10-early": "2026-03-10T06:00:00Z",
+				"mar09":       "2026-03-09T12:00:00Z",
+				"mar08":       "2026-03-08T12:00:00Z",
+			},
+			policy:   RetentionPolicy{Daily: 2},
+			expected: []string{"mar08", "mar10-early"},
+		},
+		{
+			name: "iso weeks start on monday",
+			backups: map[string]string{
+				"sun-mar08": "2026-03-08T12:00:00Z",
+				"sat-mar07": "2026-03-07T12:00:00Z",
+				"mon-mar02": "2026-03-02T12:00:00Z",
+				"sun-mar01": "2026-03-01T12:00:00Z",
+				"sat-feb28": "2026-02-28T12:00:00Z",
+			},
+			policy:   RetentionPolicy{Weekly: 2},
+			expected: []string{"mon-mar02", "sat-feb28", "sat-mar07"},
+		},
+		{
+			name: "periods without backups don't count",
+			backups: map[string]string{
+				"2026-03": "2026-03-01T00:00:00Z",
+				"2025-11": "2025-11-15T00:00:00Z",
+				"2025-06": "2025-06-15T00:00:00Z",
+			},
+			policy:   RetentionPolicy{Monthly: 2},
+			expected: []string{"2025-06"},
+		},
+		{
+			name: "negative count keeps every period",
+			backups: map[string]string{
+				"2026-late":  "2026-12-31T23:00:00Z",
+				"2026-early": "2026-01-01T01:00:00Z",
+				"2025":       "2025-07-01T00:00:00Z",
+				"2022":       "2022-07-01T00:00:00Z",
+			},
+			policy:   RetentionPolicy{Yearly: -1},
+			expected: []string{"2026-early"},
+		},
+		{
+			name: "buckets overlap",
+			backups: map[string]string{
+				"mar10": "2026-03-10T12:00:00Z",
+				"mar09": "2026-03-09T12:00:00Z",
+				"feb20": "2026-02-20T12:00:00Z",
+				"feb10": "2026-02-10T12:00:00Z",
+				"jan31": "2026-01-31T12:00:00Z",
+			},
+			policy:   RetentionPolicy{Daily: 1, Monthly: 3},
+			expected: []string{"feb10", "mar09"},
+		},
+		{
+			name: "count keeps the newest as well",
+			backups: map[string]string{
+				"mar10": "2026-03-10T12:00:00Z",
+				"mar09": "2026-03-09T12:00:00Z",
+				"mar08": "2026-03-08T12:00:00Z",
+				"feb20": "2026-02-20T12:00:00Z",
+				"feb10": "2026-02-10T12:00:00Z",
+			},
+			policy:   RetentionPolicy{Count: 2, Monthly: 2},
+			expected: []string{"feb10", "mar08"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Backends list newest first
+			var backups []BackupObject
+			for key, modified := range tt.backups {
+				backups = append(backups, BackupObject{Key: key, LastModified: at(modified)})
+			}
+			sort.Slice(backups, func(i, j int) bool {
+				return backups[i].LastModified.After(backups[j].LastModified)
+			})
+
+			var deleted []string
+			for _, b := range determineBackupsToDelete(backups, tt.policy) {
+				deleted = append(deleted, b.Key)
+			}
+			assert.ElementsMatch(t, tt.expected, deleted)
+		})
+	}
+}
+
+func TestDetermineBackupsToDelete_GFSWithDays(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	backups := []BackupObject{
+		{Key: "recent", LastModified: now.Add(-1 * time.Hour)},
+		{Key: "old", LastModified: now.Add(-10 * 24 * time.Hour)},
+		{Key: "older", LastModified: now.Add(-40 * 24 * time.Hour)},
+	}
+
+	// Days keeps the recent backup and the daily bucket the two newest days
+	// that have one, so only the oldest goes
+	toDelete := determineBackupsToDelete(backups, RetentionPolicy{Days: 7, Daily: 2})
+
+	require.Len(t, toDelete, 1)
+	assert.Equal(t, "older", toDelete[0].Key)
+}
+
+func TestDetermineBackupsToDelete_MinKeep(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	backups := []BackupObject{
+		{Key: "fresh", LastModified: now.Add(-1 * time.Hour)},
+		{Key: "old1", LastModified: now.Add(-3 * 24 * time.Hour)},
+		{Key: "old2", LastModified: now.Add(-4 * 24 * time.Hour)},
+		{Key: "old3", LastModified: now.Add(-5 * 24 * time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"floor spares the newest doomed backups", RetentionPolicy{Days: 1, MinKeep: 3}, []string{"old3"}},
+		{"floor above the number of backups", RetentionPolicy{Days: 1, MinKeep: 10}, nil},
+		{"floor already met", RetentionPolicy{Days: 1, MinKeep: 1}, []string{"old1", "old2", "old3"}},
+		{"floor applies to count", RetentionPolicy{Count: 1, MinKeep: 2}, []string{"old2", "old3"}},
+		{"floor applies to gfs", RetentionPolicy{Daily: 1, MinKeep: 2}, []string{"old2", "old3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var deleted []string
+			for _, b := range determineBackupsToDelete(backups, tt.policy) {
+				deleted = append(deleted, b.Key)
+			}
+			assert.Equal(t, tt.expected, deleted)
+		})
+	}
+}
+
+func TestDetermineBackupsToDelete_MaxSize(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	backups := []BackupObject{
+		{Key: "newest", Size: 50, LastModified: now.Add(-1 * time.Hour)},
+		{Key: "day1", Size: 30, LastModified: now.Add(-24 * time.Hour)},
+		{Key: "day2", Size: 20, LastModified: now.Add(-48 * time.Hour)},
+		{Key: "day3", Size: 10, LastModified: now.Add(-72 * time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"within budget", RetentionPolicy{MaxSize: 110}, nil},
+		{"oldest go first", RetentionPolicy{MaxSize: 85}, []string{"day2", "day3"}},
+		{"newest is never deleted", RetentionPolicy{MaxSize: 10}, []string{"day1", "day2", "day3"}},
+		{"rules delete first", RetentionPolicy{Count: 3, MaxSize: 100}, []string{"day3"}},
+		{"budget overrides count", RetentionPolicy{Count: 4, MaxSize: 80}, []string{"day2", "day3"}},
+		{"floor wins over budget", RetentionPolicy{MaxSize: 10, MinKeep: 3}, []string{"day3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var deleted []string
+			for _, b := range determineBackupsToDelete(backups, tt.policy) {
+				deleted = append(deleted, b.Key)
+			}
+			assert.Equal(t, tt.expected, deleted)
+		})
+	}
+}
+
+// Tests for Backend interface compliance
+func TestBackend_InterfaceCompliance(t *testing.T) {
+	t.Parallel()
+
+	var _ Backend = (*S3Client)(nil)
+	var _ Backend = (*R2Client)(nil)
+	var _ Backend = (*LocalBackend)(nil)
+}
+
+func TestNewBackend_Local(t *testing.T) {
+	t.Parallel()
+
+	cfg := &appcfg.Config{
+		StorageBackend:   appcfg.StorageBackendLocal,
+		LocalStoragePath: t.TempDir(),
+	}
+
+	backend, err := NewBackend(context.Background(), cfg, "backups/mydb/")
+	require.NoError(t, err)
+
+	_, ok := backend.(*LocalBackend)
+	assert.True(t, ok, "Should return a LocalBackend")
+	assert.Equal(t, "backups/mydb/", backend.Prefix())
+}
+
+func TestNewBackend_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	cfg := &appcfg.Config{StorageBackend: "ftp"}
+
+	backend, err := NewBackend(context.Background(), cfg, "backups/")
+	assert.Error(t, err)
+	assert.Nil(t, backend)
+	assert.Contains(t, err.Error(), "unsupported storage backend")
+}
+
+// Tests for LocalBackend
+func TestNewLocalBackend_RequiresRoot(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewLocalBackend("", "backups/")
+	assert.Error(t, err)
+}
+
+func TestLocalBackend_UploadDownloadStat(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+
+	err = backend.Upload(ctx, "postgres-mydb-20240101-000000.dump.gz", strings.NewReader("backup data"))
+	require.NoError(t, err)
+
+	// Stored under root/prefix/key
+	content, err := os.ReadFile(filepath.Join(root, "backups", "mydb", "postgres-mydb-20240101-000000.dump.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, "backup data", string(content))
+
+	obj, err := backend.Stat(ctx, "backups/mydb/postgres-mydb-20240101-000000.dump.gz")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("backup data")), obj.Size)
+
+	rc, err := backend.Download(ctx, "backups/mydb/postgres-mydb-20240101-000000.dump.gz")
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "backup data", string(data))
+}
+
+func TestLocalBackend_FailedUploadLeavesNothing(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	body := io.MultiReader(strings.NewReader("partial"), &failingReader{err: stderrors.New("dump failed")})
+	err = backend.Upload(ctx, "broken.dump", body)
+	require.Error(t, err)
+
+	backups, err := backend.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, backups, "A failed upload should not leave a partial file")
+}
+
+func TestLocalBackend_ListScopedToPrefixNewestFirst(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	other, err := NewLocalBackend(root, "backups/other/")
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Upload(ctx, "old.dump", strings.NewReader("old")))
+	require.NoError(t, backend.Upload(ctx, "new.dump", strings.NewReader("new")))
+	require.NoError(t, other.Upload(ctx, "unrelated.dump", strings.NewReader("x")))
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "backups", "mydb", "old.dump"), past, past))
+
+	backups, err := backend.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "backups/mydb/new.dump", backups[0].Key)
+	assert.Equal(t, "backups/mydb/old.dump", backups[1].Key)
+}
+
+func TestLocalBackend_ListMissingPrefix(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewLocalBackend(t.TempDir(), "backups/none/")
+	require.NoError(t, err)
+
+	backups, err := backend.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestLocalBackend_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir(), "backups/")
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Upload(ctx, "a.dump", strings.NewReader("a")))
+	require.NoError(t, backend.Delete(ctx, "backups/a.dump"))
+
+	_, err = backend.Stat(ctx, "backups/a.dump")
+	assert.ErrorIs(t, err, errors.ErrObjectNotFound)
+
+	err = backend.Delete(ctx, "backups/a.dump")
+	assert.ErrorIs(t, err, errors.ErrObjectNotFound)
+}
+
+func TestLocalBackend_RejectsEscapingKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir(), "backups/")
+	require.NoError(t, err)
+
+	_, err = backend.Download(ctx, "../../etc/passwd")
+	assert.Error(t, err)
+
+	err = backend.Delete(ctx, "/etc/passwd")
+	assert.Error(t, err)
+}
+
+// retentionTestDB is the database the ApplyRetention tests back up
+var retentionTestDB = &appcfg.DatabaseConfig{Type: appcfg.DatabaseTypePostgres, Name: "mydb", BackupPrefix: "backups/mydb/"}
+
+// uploadDailyBackups uploads n backups of retentionTestDB, one a day going
+// back from 2024-01-10, each with a manifest if withManifests is set. The
+// files' modification times are deliberately in the opposite order.
+func uploadDailyBackups(t *testing.T, backend *LocalBackend, root string, n int, withManifests bool) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	var names []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("postgres-mydb-202401%02d-020000.dump", 10-i)
+		names = append(names, name)
+		keys := []string{name}
+		if withManifests {
+			keys = append(keys, name+".manifest.json")
+		}
+		for _, key := range keys {
+			require.NoError(t, backend.Upload(ctx, key, strings.NewReader(key)))
+			modTime := time.Now().Add(time.Duration(i) * time.Hour)
+			require.NoError(t, os.Chtimes(filepath.Join(root, "backups", "mydb", key), modTime, modTime))
+		}
+	}
+	return names
+}
+
+func listKeys(t *testing.T, backend Backend) []string {
+	t.Helper()
+	remaining, err := backend.List(context.Background())
+	require.NoError(t, err)
+	var keys []string
+	for _, obj := range remaining {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestApplyRetention_LocalBackend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	names := uploadDailyBackups(t, backend, root, 4, false)
+
+	result, err := ApplyRetention(ctx, backend, retentionTestDB, RetentionPolicy{Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.DeletedCount)
+	// Ordered by the timestamps in the names, not modification time
+	assert.ElementsMatch(t, []string{"backups/mydb/" + names[2], "backups/mydb/" + names[3]}, result.DeletedKeys)
+
+	assert.Len(t, listKeys(t, backend), 2)
+}
+
+func TestApplyRetention_ManifestsFollowTheirBackups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	names := uploadDailyBackups(t, backend, root, 3, true)
+
+	result, err := ApplyRetention(ctx, backend, retentionTestDB, RetentionPolicy{Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DeletedCount, "manifests must not count as backups")
+	assert.Equal(t, []string{"backups/mydb/" + names[2]}, result.DeletedKeys)
+	assert.Empty(t, result.Errors)
+
+	assert.ElementsMatch(t, []string{
+		"backups/mydb/" + names[0], "backups/mydb/" + names[0] + ".manifest.json",
+		"backups/mydb/" + names[1], "backups/mydb/" + names[1] + ".manifest.json",
+	}, listKeys(t, backend))
+}
+
+func TestApplyRetention_OnlyTouchesItsOwnBackups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	uploadDailyBackups(t, backend, root, 2, false)
+
+	for _, key := range []string{
+		"manual-export.sql",                                // someone else's file
+		"postgres-mydb-v2-20240101-020000.dump",            // another database sharing the prefix
+		"mysql-mydb-20240101-020000.sql",                   // same name, other type
+		"postgres-mydb-20240101-020000.dump.manifest.json", // manifest of a deleted backup
+	} {
+		require.NoError(t, backend.Upload(ctx, key, strings.NewReader(key)))
+	}
+
+	// A backup with an unfamiliar name, claimed by its manifest
+	var body bytes.Buffer
+	require.NoError(t, (&manifest.Manifest{
+		Version:      manifest.Version,
+		DatabaseName: "mydb",
+		DatabaseType: "postgres",
+		StartedAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}).Encode(&body))
+	require.NoError(t, backend.Upload(ctx, "renamed.dump", strings.NewReader("x")))
+	require.NoError(t, backend.Upload(ctx, "renamed.dump.manifest.json", &body))
+
+	result, err := ApplyRetention(ctx, backend, retentionTestDB, RetentionPolicy{Count: 1})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"backups/mydb/postgres-mydb-20240109-020000.dump",
+		"backups/mydb/renamed.dump",
+	}, result.DeletedKeys)
+	assert.Empty(t, result.Errors)
+
+	assert.ElementsMatch(t, []string{
+		"backups/mydb/postgres-mydb-20240110-020000.dump",
+		"backups/mydb/manual-export.sql",
+		"backups/mydb/postgres-mydb-v2-20240101-020000.dump",
+		"backups/mydb/mysql-mydb-20240101-020000.sql",
+	}, listKeys(t, backend))
+}
+
+// failingReader always returns err
+type failingReader struct {
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func TestApplyRetention_DryRunDeletesNothing(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	names := uploadDailyBackups(t, backend, root, 3, true)
+
+	result, err := ApplyRetention(ctx, backend, retentionTestDB, RetentionPolicy{Count: 1, DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.DeletedCount)
+	assert.ElementsMatch(t, []string{"backups/mydb/" + names[1], "backups/mydb/" + names[2]}, result.DeletedKeys)
+
+	assert.Len(t, listKeys(t, backend), 6)
+}
+
+func TestApplyRetention_ReclaimedBytesIncludeManifests(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	names := uploadDailyBackups(t, backend, root, 3, true)
+
+	// Each backup holds its own name, and its manifest its own key
+	unit := int64(len(names[0]) + len(names[0]+".manifest.json"))
+
+	result, err := ApplyRetention(ctx, backend, retentionTestDB, RetentionPolicy{MaxSize: 2 * unit})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backups/mydb/" + names[2]}, result.DeletedKeys)
+	assert.Equal(t, unit, result.ReclaimedBytes)
+}
+
+// manifestLockedBackend fails to delete manifests
+type manifestLockedBackend struct {
+	*LocalBackend
+}
+
+func (b *manifestLockedBackend) Delete(ctx context.Context, key string) error {
+	if manifest.IsKey(key) {
+		return stderrors.New("access denied")
+	}
+	return b.LocalBackend.Delete(ctx, key)
+}
+
+func TestApplyRetention_ReclaimedBytesExcludeUndeletedManifests(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root, "backups/mydb/")
+	require.NoError(t, err)
+	names := uploadDailyBackups(t, backend, root, 2, true)
+
+	result, err := ApplyRetention(ctx, &manifestLockedBackend{backend}, retentionTestDB, RetentionPolicy{Count: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backups/mydb/" + names[1]}, result.DeletedKeys)
+	assert.Equal(t, int64(len(names[1])), result.ReclaimedBytes)
+	assert.NotEmpty(t, result.Errors)
+}
+
+func TestApplyBucketBudget(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	bucket, err := NewLocalBackend(root, "")
+	require.NoError(t, err)
+
+	app := &appcfg.DatabaseConfig{Type: appcfg.DatabaseTypePostgres, Name: "app", BackupPrefix: "backups/app/"}
+	shop := &appcfg.DatabaseConfig{Type: appcfg.DatabaseTypeMySQL, Name: "shop", BackupPrefix: "backups/shop/"}
+
+	// 10 bytes each, interleaved in time across the two databases
+	for _, key := range []string{
+		"backups/app/postgres-app-20240101-000000.dump",
+		"backups/shop/mysql-shop-20240102-000000.sql",
+		"backups/app/postgres-app-20240103-000000.dump",
+		"backups/shop/mysql-shop-20240104-000000.sql",
+		"backups/app/postgres-app-20240105-000000.dump",
+		"other/notes.txt", // counts towards the budget but is never deleted
+		// Another deployment's database of the same name: counts towards the
+		// budget but is never deleted, nor kept in app's place
+		"staging/app/postgres-app-20231201-000000.dump",
+	} {
+		require.NoError(t, bucket.Upload(ctx, key, strings.NewReader("0123456789")))
+	}
+
+	members := []BudgetMember{{Database: app}, {Database: shop}}
+
+	result, err := ApplyBucketBudget(ctx, bucket, members, 45, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"backups/app/postgres-app-20240101-000000.dump",
+		"backups/shop/mysql-shop-20240102-000000.sql",
+		"backups/app/postgres-app-20240103-000000.dump",
+	}, result.DeletedKeys)
+	assert.Equal(t, int64(30), result.ReclaimedBytes)
+	assert.Len(t, listKeys(t, bucket), 7, "dry run deletes nothing")
+
+	// A dry run of per-database retention already counted app's oldest
+	// backup as deleted, so the budget doesn't count or pick it again
+	members[0].Deleted = []string{"backups/app/postgres-app-20240101-000000.dump"}
+	result, err = ApplyBucketBudget(ctx, bucket, members, 45, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"backups/shop/mysql-shop-20240102-000000.sql",
+		"backups/app/postgres-app-20240103-000000.dump",
+	}, result.DeletedKeys)
+	members[0].Deleted = nil
+
+	// Each database keeps its newest backup, even over budget
+	members[0].MinKeep = 2
+	result, err = ApplyBucketBudget(ctx, bucket, members, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"backups/app/postgres-app-20240101-000000.dump",
+		"backups/shop/mysql-shop-20240102-000000.sql",
+	}, result.DeletedKeys)
+	assert.ElementsMatch(t, []string{
+		"backups/app/postgres-app-20240103-000000.dump",
+		"backups/shop/mysql-shop-20240104-000000.sql",
+		"backups/app/postgres-app-20240105-000000.dump",
+		"other/notes.txt",
+		"staging/app/postgres-app-20231201-000000.dump",
+	}, listKeys(t, bucket))
+}
+
+// brokenBackend fails every upload after reading a little of it
+type brokenBackend struct {
+	*LocalBackend
+}
+
+func (b *brokenBackend) Upload(ctx context.Context, key string, body io.Reader) error {
+	if _, err := io.ReadFull(body, make([]byte, 3)); err != nil {
+		return err
+	}
+	return stderrors.New("bucket unavailable")
+}
+
+func TestUploadAll(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+	replica, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	// Large enough to need many writes, so the broken destination fails
+	// part way through the stream
+	data := strings.Repeat("backup data ", 100000)
+	results := UploadAll(ctx, []Destination{
+		{Name: "local", Backend: primary, Required: true},
+		{Name: "broken", Backend: &brokenBackend{primary}},
+		{Name: "replica", Backend: replica},
+	}, "backup.dump", strings.NewReader(data), 0)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, "local", results[0].Destination)
+	assert.NoError(t, results[0].Err)
+	assert.EqualError(t, results[1].Err, "bucket unavailable")
+	assert.NoError(t, results[2].Err)
+
+	for _, backend := range []*LocalBackend{primary, replica} {
+		body, err := backend.Download(ctx, "backups/mydb/backup.dump")
+		require.NoError(t, err)
+		stored, err := io.ReadAll(body)
+		body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, data, string(stored))
+	}
+}
+
+func TestUploadAll_SourceFailureFailsEveryDestination(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+	replica, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	dumpErr := stderrors.New("pg_dump exited with status 1")
+	results := UploadAll(ctx, []Destination{
+		{Name: "primary", Backend: primary, Required: true},
+		{Name: "replica", Backend: replica},
+	}, "backup.dump", io.MultiReader(strings.NewReader("partial"), &failingReader{err: dumpErr}), 0)
+
+	for _, result := range results {
+		assert.ErrorIs(t, result.Err, dumpErr, result.Destination)
+	}
+	for _, backend := range []*LocalBackend{primary, replica} {
+		_, err := backend.Stat(ctx, "backups/mydb/backup.dump")
+		assert.ErrorIs(t, err, errors.ErrObjectNotFound)
+	}
+}
+
+// stalledBackend never reads an upload, like a hung connection, until the
+// upload is canceled
+type stalledBackend struct {
+	*LocalBackend
+}
+
+func (b *stalledBackend) Upload(ctx context.Context, key string, body io.Reader) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// zeroReader is an endless stream of zeros, counting what was read
+type zeroReader struct {
+	n int64
+}
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	z.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestUploadAll_StalledReplicaIsDropped(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	// Many times the buffer, which the primary mustn't wait for
+	data := strings.Repeat("backup data ", 100000)
+	results := UploadAll(ctx, []Destination{
+		{Name: "primary", Backend: primary, Required: true},
+		{Name: "stalled", Backend: &stalledBackend{primary}},
+	}, "backup.dump", strings.NewReader(data), 64<<10)
+
+	require.NoError(t, results[0].Err)
+	assert.ErrorContains(t, results[1].Err, "fell more than 65536 bytes behind the backup stream")
+
+	body, err := primary.Download(ctx, "backups/mydb/backup.dump")
+	require.NoError(t, err)
+	defer body.Close()
+	stored, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(stored))
+}
+
+// slowBackend uploads to its LocalBackend a little at a time, like a
+// replica on a slower link
+type slowBackend struct {
+	*LocalBackend
+}
+
+func (b *slowBackend) Upload(ctx context.Context, key string, body io.Reader) error {
+	return b.LocalBackend.Upload(ctx, key, &slowReader{body})
+}
+
+type slowReader struct {
+	r io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return s.r.Read(p[:min(len(p), 256<<10)])
+}
+
+func TestUploadAll_SlowReplicaCompletes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+	replica, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	// Larger than an upload part, so the replica falls that far behind the
+	// primary, but it is still making progress
+	const size = 2 * uploadPartSize
+	results := UploadAll(ctx, []Destination{
+		{Name: "primary", Backend: primary, Required: true},
+		{Name: "replica", Backend: &slowBackend{replica}},
+	}, "backup.dump", io.LimitReader(&zeroReader{}, size), 0)
+
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	obj, err := replica.Stat(ctx, "backups/mydb/backup.dump")
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), obj.Size)
+}
+
+func TestUploadAll_RequiredFailureStopsStream(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+	replica, err := NewLocalBackend(t.TempDir(), "backups/mydb/")
+	require.NoError(t, err)
+
+	// The stream never ends, so the test only finishes if the primary's
+	// failure stops it
+	source := &zeroReader{}
+	results := UploadAll(ctx, []Destination{
+		{Name: "primary", Backend: &brokenBackend{primary}, Required: true},
+		{Name: "replica", Backend: replica},
+	}, "backup.dump", source, 0)
+
+	assert.EqualError(t, results[0].Err, "bucket unavailable")
+	assert.ErrorContains(t, results[1].Err, "upload to primary failed: bucket unavailable")
+	assert.Less(t, source.n, int64(DefaultReplicaBufferSize))
+
+	_, err = replica.Stat(ctx, "backups/mydb/backup.dump")
+	assert.ErrorIs(t, err, errors.ErrObjectNotFound)
+}
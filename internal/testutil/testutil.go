@@ -0,0 +1,53 @@
+// Package testutil holds fixtures shared by the tests of packages that read
+// backups back, so they build backups the same way.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+// Keyring returns a keyring of one valid 32-byte key
+func Keyring() *encrypt.Keyring {
+	key := make([]byte, encrypt.KeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return KeyringOf(key)
+}
+
+// KeyringOf returns a keyring of just key
+func KeyringOf(key []byte) *encrypt.Keyring {
+	keyring, err := encrypt.NewKeyring([]encrypt.Key{{ID: "test", Secret: key}}, "")
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
+// UploadBackup runs data through the same compress/encrypt stages as a
+// backup and stores it under name. A nil keyring leaves it unencrypted.
+func UploadBackup(t testing.TB, backend storage.Backend, name string, data []byte, compressed bool, keyring *encrypt.Keyring) {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(data)
+	if compressed {
+		r = compress.NewGzipCompressor().Compress(r)
+	}
+	if keyring != nil {
+		encryptor, err := keyring.Encryptor()
+		require.NoError(t, err)
+		r, err = encryptor.Encrypt(r)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, backend.Upload(context.Background(), name, r))
+}
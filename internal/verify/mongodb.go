@@ -0,0 +1,46 @@
+package verify
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type MongoDBValidator struct{}
+
+// Validate reads every entry of the tar archive of the mongodump output
+// directory and checks that it contains the dump
+func (v *MongoDBValidator) Validate(ctx context.Context, r io.Reader) (string, error) {
+	tr := tar.NewReader(r)
+	entries, collections := 0, 0
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read archive: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return "", fmt.Errorf("failed to read archive entry %s: %w", header.Name, err)
+		}
+
+		if header.Name != "dump" && !strings.HasPrefix(header.Name, "dump/") {
+			return "", fmt.Errorf("unexpected archive entry %s outside of dump/", header.Name)
+		}
+		entries++
+		if strings.HasSuffix(header.Name, ".bson") {
+			collections++
+		}
+	}
+
+	if entries == 0 {
+		return "", errors.New("archive is empty")
+	}
+
+	return fmt.Sprintf("tar archive with %d entries (%d collections)", entries, collections), nil
+}
@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// mysqlDumpTrailer is the comment mysqldump writes as its last line
+	// once the dump finished successfully
+	mysqlDumpTrailer = "-- Dump completed"
+
+	// mysqlTailSize is how much of the end of the dump is searched for
+	// the trailer
+	mysqlTailSize = 4096
+)
+
+type MySQLValidator struct{}
+
+// Validate reads the whole dump and checks that it ends with the
+// mysqldump completion trailer, which a truncated dump lacks
+func (v *MySQLValidator) Validate(ctx context.Context, r io.Reader) (string, error) {
+	tail := &tailBuffer{limit: mysqlTailSize}
+	n, err := io.Copy(tail, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dump: %w", err)
+	}
+	if n == 0 {
+		return "", errors.New("dump is empty")
+	}
+
+	if !bytes.Contains(tail.buf, []byte(mysqlDumpTrailer)) {
+		return "", errors.New("mysqldump completion trailer not found, the dump may be truncated")
+	}
+
+	return "dump ends with the mysqldump completion trailer", nil
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if excess := len(t.buf) - t.limit; excess > 0 {
+		t.buf = append(t.buf[:0], t.buf[excess:]...)
+	}
+	return len(p), nil
+}
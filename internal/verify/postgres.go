@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// pgCustomMagic starts every pg_dump custom-format archive
+const pgCustomMagic = "PGDMP"
+
+type PostgresValidator struct{}
+
+// Validate checks the custom-format header and, when pg_restore is
+// available, that pg_restore can read the archive's table of contents
+func (v *PostgresValidator) Validate(ctx context.Context, r io.Reader) (string, error) {
+	header := make([]byte, len(pgCustomMagic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", fmt.Errorf("failed to read dump header: %w", err)
+	}
+	if string(header) != pgCustomMagic {
+		return "", fmt.Errorf("not a pg_dump custom-format archive (missing %s header)", pgCustomMagic)
+	}
+
+	if _, err := exec.LookPath("pg_restore"); err != nil {
+		return "custom-format header present; pg_restore not found, table of contents not checked", nil
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_restore", "--list")
+	cmd.Stdin = io.MultiReader(bytes.NewReader(header), r)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("pg_restore --list failed: %w: %s", err, stderr.String())
+	}
+
+	return fmt.Sprintf("custom-format archive with %d table of contents entries", countTOCEntries(&stdout)), nil
+}
+
+// countTOCEntries counts the entries in pg_restore --list output, skipping
+// the ";" comment lines of its preamble
+func countTOCEntries(r io.Reader) int {
+	entries := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, ";") {
+			entries++
+		}
+	}
+	return entries
+}
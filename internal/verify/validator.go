@@ -0,0 +1,29 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+)
+
+// PayloadValidator checks that a raw dump, as produced by the matching
+// backup.Exporter, is complete and in the expected format. It returns a short
+// description of what was checked.
+type PayloadValidator interface {
+	Validate(ctx context.Context, r io.Reader) (string, error)
+}
+
+func NewPayloadValidator(dbType config.DatabaseType) (PayloadValidator, error) {
+	switch dbType {
+	case config.DatabaseTypePostgres:
+		return &PostgresValidator{}, nil
+	case config.DatabaseTypeMySQL:
+		return &MySQLValidator{}, nil
+	case config.DatabaseTypeMongoDB:
+		return &MongoDBValidator{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
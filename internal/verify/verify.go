@@ -0,0 +1,334 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+	"github.com/jorgepascosoto/auto-db-backups/internal/restore"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+// Names of the checks, in the order they are reported
+const (
+	CheckDownload      = "download"
+	CheckDecryption    = "decryption"
+	CheckDecompression = "decompression"
+	CheckPayload       = "payload"
+	CheckChecksum      = "checksum"
+	CheckSignature     = "signature"
+)
+
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Result describes the checks run against one backup
+type Result struct {
+	Key          string
+	DatabaseType config.DatabaseType
+	StoredSize   int64 // bytes downloaded
+	PayloadSize  int64 // bytes of the raw dump
+	Checks       []Check
+}
+
+// Passed reports whether no check failed
+func (r *Result) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Status == StatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify downloads the backup at key and proves it can be restored: the
+// whole object is read, every encrypted chunk must authenticate, the
+// compressed stream must be intact, the raw dump must pass the payload
+// checks for dbType, and the stored bytes must match the checksum in the
+// backup's manifest. With signatures, the manifest must also carry a valid
+// signature by one of its keys, proving the backup was produced by the
+// pipeline and not replaced in storage. That signature is then enough to
+// vouch for a backup there is no key to decrypt, such as an age backup
+// checked by the backup job, which only holds public keys: its checksum and
+// signature are checked instead. Without signatures, or without a manifest,
+// such a backup fails. The returned Result is never nil; the error is the
+// reason the first failing check failed.
+func Verify(ctx context.Context, backend storage.Backend, key string, dbType config.DatabaseType, keys encrypt.Keys, signatures *signing.Verifier) (*Result, error) {
+	result := &Result{Key: key, DatabaseType: dbType}
+
+	validator, err := NewPayloadValidator(dbType)
+	if err != nil {
+		return result, err
+	}
+
+	// An unreadable manifest fails the checksum check below; the backup is
+	// then read as its extensions describe it
+	m, manifestErr := manifest.Fetch(ctx, backend, key)
+	format := restore.FormatOf(m, key)
+
+	body, err := backend.Download(ctx, key)
+	if err != nil {
+		err = fmt.Errorf("failed to download backup: %w", err)
+		result.Checks = append(result.Checks, Check{Name: CheckDownload, Status: StatusFailed, Detail: err.Error()})
+		return result, err
+	}
+	defer body.Close()
+
+	p := &pipeline{}
+	hash := sha256.New()
+	stored := backup.NewCountingReader(io.TeeReader(body, hash))
+	download := p.add(CheckDownload, stored)
+	r := download
+
+	// Without a key for the backup only the stored bytes can be checked,
+	// which proves nothing unless a signature ties them to the pipeline
+	sealed := format.Encryption != "" && !keys.CanDecrypt(format.Encryption)
+
+	if sealed && signatures == nil {
+		p.fail(CheckDecryption, fmt.Errorf("no encryption key configured for %s", format.Encryption))
+	} else if sealed {
+		p.skip(CheckDecryption, fmt.Sprintf("no encryption key configured for %s, checking the signature instead", format.Encryption))
+	} else if format.Encryption != "" {
+		decrypted, err := restore.Decrypt(r, format.Encryption, keys)
+		if err != nil {
+			p.fail(CheckDecryption, err)
+		} else {
+			defer decrypted.Close()
+			r = p.add(CheckDecryption, decrypted)
+		}
+	} else {
+		p.skip(CheckDecryption, "backup is not encrypted")
+	}
+
+	var compression string
+	if !p.failed() && !sealed {
+		// Go by the magic bytes, as restores do
+		compression, r = compress.Detect(r)
+		if compression == "" {
+			compression = format.Compression
+		}
+	}
+
+	if p.failed() {
+		p.skip(CheckDecompression, "not reached")
+	} else if sealed {
+		p.skip(CheckDecompression, "backup cannot be decrypted")
+	} else if compression != "" && compression != compress.NoneName {
+		decompressed, err := restore.Decompress(r, compression)
+		if err != nil {
+			p.fail(CheckDecompression, err)
+		} else {
+			defer decompressed.Close()
+			r = p.add(CheckDecompression, decompressed)
+		}
+	} else {
+		p.skip(CheckDecompression, "backup is not compressed")
+	}
+
+	var payloadDetail string
+	var payloadErr error
+	if sealed && !p.failed() {
+		io.Copy(io.Discard, download)
+	} else if !p.failed() {
+		payload := backup.NewCountingReader(r)
+		payloadDetail, payloadErr = validator.Validate(ctx, payload)
+
+		// Validators may stop early; read the rest so every chunk is
+		// authenticated and the compressed stream is checked to the end
+		if _, err := io.Copy(io.Discard, payload); err != nil && payloadErr == nil {
+			payloadErr = err
+		}
+		result.PayloadSize = payload.Count()
+
+		// Hash anything stored past the end of the stream too
+		io.Copy(io.Discard, download)
+	}
+	result.StoredSize = stored.Count()
+
+	result.Checks = p.checks(result)
+
+	// A read error that surfaced in the payload check is blamed on the
+	// earliest stage that saw it
+	culprit := p.firstFailure()
+	var checkErr error
+	switch {
+	case culprit != nil:
+		result.Checks = append(result.Checks, Check{Name: CheckPayload, Status: StatusSkipped, Detail: "not reached"})
+		checkErr = fmt.Errorf("%s check failed: %w", culprit.name, culprit.err)
+	case sealed:
+		result.Checks = append(result.Checks, Check{Name: CheckPayload, Status: StatusSkipped, Detail: "backup cannot be decrypted"})
+	case payloadErr != nil:
+		result.Checks = append(result.Checks, Check{Name: CheckPayload, Status: StatusFailed, Detail: payloadErr.Error()})
+		checkErr = fmt.Errorf("%s check failed: %w", CheckPayload, payloadErr)
+	default:
+		result.Checks = append(result.Checks, Check{Name: CheckPayload, Status: StatusPassed, Detail: payloadDetail})
+	}
+
+	switch {
+	case manifestErr != nil:
+		result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusFailed, Detail: manifestErr.Error()})
+		if checkErr == nil {
+			checkErr = fmt.Errorf("%s check failed: %w", CheckChecksum, manifestErr)
+		}
+	case m == nil && sealed:
+		// The checksum is all there is to check
+		err := fmt.Errorf("backup has no manifest")
+		result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusFailed, Detail: err.Error()})
+		if checkErr == nil {
+			checkErr = fmt.Errorf("%s check failed: %w", CheckChecksum, err)
+		}
+	case m == nil:
+		result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusSkipped, Detail: "backup has no manifest"})
+	case culprit != nil:
+		result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusSkipped, Detail: "not reached"})
+	default:
+		sum := hex.EncodeToString(hash.Sum(nil))
+		if sum != m.SHA256 {
+			err := fmt.Errorf("stored bytes have SHA-256 %s, manifest records %s", sum, m.SHA256)
+			result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusFailed, Detail: err.Error()})
+			if checkErr == nil {
+				checkErr = fmt.Errorf("%s check failed: %w", CheckChecksum, err)
+			}
+		} else {
+			result.Checks = append(result.Checks, Check{Name: CheckChecksum, Status: StatusPassed, Detail: "SHA-256 matches manifest"})
+		}
+	}
+
+	if signatures != nil {
+		check := checkSignature(m, manifestErr, key, signatures)
+		result.Checks = append(result.Checks, check)
+		if check.Status == StatusFailed && checkErr == nil {
+			checkErr = fmt.Errorf("%s check failed: %s", CheckSignature, check.Detail)
+		}
+	}
+
+	return result, checkErr
+}
+
+// checkSignature checks that the manifest of the backup at key is signed by
+// one of signatures' keys. Together with the checksum, that ties the stored
+// bytes to a backup the pipeline produced.
+func checkSignature(m *manifest.Manifest, manifestErr error, key string, signatures *signing.Verifier) Check {
+	var err error
+	switch {
+	case manifestErr != nil:
+		err = manifestErr
+	case m == nil:
+		err = fmt.Errorf("backup has no manifest")
+	case m.Key != key:
+		// A signed manifest copied next to another backup
+		err = fmt.Errorf("manifest describes %s", m.Key)
+	default:
+		err = signatures.Verify(m)
+	}
+	if err != nil {
+		return Check{Name: CheckSignature, Status: StatusFailed, Detail: err.Error()}
+	}
+	return Check{Name: CheckSignature, Status: StatusPassed, Detail: fmt.Sprintf("signed by key %s", m.Signature.KeyID)}
+}
+
+// pipeline tracks the stages a backup is read through so a read error can be
+// attributed to the stage it originated from: an error from the download
+// also surfaces from every stage reading from it, so the earliest stage that
+// saw an error is the one that failed
+type pipeline struct {
+	stages []*stage
+}
+
+type stage struct {
+	name    string
+	r       io.Reader
+	err     error
+	skipped string
+}
+
+func (s *stage) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+func (p *pipeline) add(name string, r io.Reader) io.Reader {
+	s := &stage{name: name, r: r}
+	p.stages = append(p.stages, s)
+	return s
+}
+
+func (p *pipeline) fail(name string, err error) {
+	p.stages = append(p.stages, &stage{name: name, err: err})
+}
+
+func (p *pipeline) skip(name, reason string) {
+	p.stages = append(p.stages, &stage{name: name, skipped: reason})
+}
+
+func (p *pipeline) failed() bool {
+	return p.firstFailure() != nil
+}
+
+func (p *pipeline) firstFailure() *stage {
+	for _, s := range p.stages {
+		if s.err != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// checks reports the pipeline stages; stages after the one that failed are
+// reported as skipped since their input was never complete
+func (p *pipeline) checks(result *Result) []Check {
+	checks := make([]Check, 0, len(p.stages)+1)
+	culprit := p.firstFailure()
+	reached := true
+
+	for _, s := range p.stages {
+		switch {
+		case s.skipped != "":
+			checks = append(checks, Check{Name: s.name, Status: StatusSkipped, Detail: s.skipped})
+		case !reached:
+			checks = append(checks, Check{Name: s.name, Status: StatusSkipped, Detail: "not reached"})
+		case s == culprit:
+			checks = append(checks, Check{Name: s.name, Status: StatusFailed, Detail: s.err.Error()})
+			reached = false
+		default:
+			checks = append(checks, Check{Name: s.name, Status: StatusPassed, Detail: stageDetail(s.name, result)})
+		}
+	}
+
+	return checks
+}
+
+func stageDetail(name string, result *Result) string {
+	switch name {
+	case CheckDownload:
+		return fmt.Sprintf("%d bytes read", result.StoredSize)
+	case CheckDecryption:
+		return "ciphertext authenticated"
+	case CheckDecompression:
+		return fmt.Sprintf("%d bytes decompressed", result.PayloadSize)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,582 @@
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+	"github.com/jorgepascosoto/auto-db-backups/internal/testutil"
+)
+
+const testMySQLDump = "-- MySQL dump 10.13\n\nCREATE TABLE t (id int);\n\n-- Dump completed on 2024-01-15 14:05:32\n"
+
+func newTestBackend(t *testing.T) *storage.LocalBackend {
+	t.Helper()
+	backend, err := storage.NewLocalBackend(t.TempDir(), "backups/")
+	require.NoError(t, err)
+	return backend
+}
+
+// tamper flips a byte of a stored object at offset
+func tamper(t *testing.T, backend *storage.LocalBackend, key string, offset int64) {
+	t.Helper()
+	file := filepath.Join(backend.Root(), filepath.FromSlash(key))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	if offset < 0 {
+		offset += int64(len(data))
+	}
+	data[offset] ^= 0xff
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+}
+
+// writeManifest stores a manifest for the object at key recording the
+// checksum of its current contents
+func writeManifest(t *testing.T, backend *storage.LocalBackend, key, compression, encryption string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(backend.Root(), filepath.FromSlash(key)))
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+
+	m := &manifest.Manifest{Version: manifest.Version, Key: key, StoredSize: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), Compression: compression}
+	if encryption != "" {
+		m.Encryption = &manifest.Encryption{Algorithm: encryption}
+	}
+	var body bytes.Buffer
+	require.NoError(t, m.Encode(&body))
+	require.NoError(t, backend.Upload(context.Background(), strings.TrimPrefix(manifest.Key(key), "backups/"), &body))
+}
+
+// signManifest signs the manifest stored for the object at key with signer
+func signManifest(t *testing.T, backend *storage.LocalBackend, key string, signer *signing.Signer) {
+	t.Helper()
+	m, err := manifest.Fetch(context.Background(), backend, key)
+	require.NoError(t, err)
+	signer.Sign(m)
+	var body bytes.Buffer
+	require.NoError(t, m.Encode(&body))
+	require.NoError(t, backend.Upload(context.Background(), strings.TrimPrefix(manifest.Key(key), "backups/"), &body))
+}
+
+func newTestSigner(t *testing.T, fill byte) *signing.Signer {
+	t.Helper()
+	signer, err := signing.NewSigner(bytes.Repeat([]byte{fill}, 32))
+	require.NoError(t, err)
+	return signer
+}
+
+func checkStatuses(result *Result) map[string]Status {
+	statuses := make(map[string]Status)
+	for _, check := range result.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestVerify_CompressedAndEncrypted(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	keyring := testutil.Keyring()
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.gz.enc", []byte(testMySQLDump), true, keyring)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.gz.enc", config.DatabaseTypeMySQL, encrypt.Keys{Keyring: keyring}, nil)
+	require.NoError(t, err)
+
+	assert.True(t, result.Passed())
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusPassed,
+		CheckDecompression: StatusPassed,
+		CheckPayload:       StatusPassed,
+		CheckChecksum:      StatusSkipped,
+	}, checkStatuses(result))
+	assert.Equal(t, int64(len(testMySQLDump)), result.PayloadSize)
+	assert.Greater(t, result.StoredSize, int64(0))
+}
+
+func TestVerify_Zstd(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	require.NoError(t, backend.Upload(context.Background(), "mysql-app-20240115-140532.sql.zst",
+		compress.NewZstdCompressor().Compress(strings.NewReader(testMySQLDump))))
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.zst", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusPassed, checkStatuses(result)[CheckDecompression])
+	assert.Equal(t, int64(len(testMySQLDump)), result.PayloadSize)
+}
+
+func TestVerify_PlainBackupSkipsStages(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), false, nil)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusSkipped,
+		CheckDecompression: StatusSkipped,
+		CheckPayload:       StatusPassed,
+		CheckChecksum:      StatusSkipped,
+	}, checkStatuses(result))
+}
+
+func TestVerify_TamperedCiphertextFailsDecryption(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	keyring := testutil.Keyring()
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.gz.enc", []byte(testMySQLDump), true, keyring)
+	tamper(t, backend, "backups/mysql-app-20240115-140532.sql.gz.enc", -1)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.gz.enc", config.DatabaseTypeMySQL, encrypt.Keys{Keyring: keyring}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "decryption check failed")
+
+	assert.False(t, result.Passed())
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusFailed,
+		CheckDecompression: StatusSkipped,
+		CheckPayload:       StatusSkipped,
+		CheckChecksum:      StatusSkipped,
+	}, checkStatuses(result))
+}
+
+func TestVerify_WrongKeyFailsDecryption(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.enc", []byte(testMySQLDump), false, testutil.Keyring())
+
+	wrongKey := testutil.KeyringOf(make([]byte, encrypt.KeySize))
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.enc", config.DatabaseTypeMySQL, encrypt.Keys{Keyring: wrongKey}, nil)
+	require.Error(t, err)
+
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckDecryption])
+}
+
+func TestVerify_EncryptedWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.enc", []byte(testMySQLDump), false, testutil.Keyring())
+
+	writeManifest(t, backend, "backups/mysql-app-20240115-140532.sql.enc", "", encrypt.Algorithm)
+
+	// A matching checksum alone doesn't prove the backup restores
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.enc", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "decryption check failed: no encryption key configured for AES-256-GCM")
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckDecryption])
+	assert.False(t, result.Passed())
+}
+
+// A verifier holding only the public signing key can still prove an AES
+// backup came from the pipeline
+func TestVerify_SignatureWithoutEncryptionKey(t *testing.T) {
+	t.Parallel()
+
+	const key = "backups/mysql-app-20240115-140532.sql.gz.enc"
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.gz.enc", []byte(testMySQLDump), true, testutil.Keyring())
+	writeManifest(t, backend, key, compress.GzipName, encrypt.Algorithm)
+	signer := newTestSigner(t, 1)
+	signManifest(t, backend, key, signer)
+	verifier, err := signing.NewVerifier(signer.PublicKey())
+	require.NoError(t, err)
+
+	result, err := Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusSkipped,
+		CheckDecompression: StatusSkipped,
+		CheckPayload:       StatusSkipped,
+		CheckChecksum:      StatusPassed,
+		CheckSignature:     StatusPassed,
+	}, checkStatuses(result))
+
+	signManifest(t, backend, key, newTestSigner(t, 2))
+	_, err = Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+	assert.ErrorContains(t, err, "signature check failed")
+}
+
+// Without a manifest there is nothing to check an undecryptable backup
+// against, whatever the signature verifier
+func TestVerify_SealedWithoutManifest(t *testing.T) {
+	t.Parallel()
+
+	const key = "backups/mysql-app-20240115-140532.sql.enc"
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.enc", []byte(testMySQLDump), false, testutil.Keyring())
+	verifier, err := signing.NewVerifier(newTestSigner(t, 1).PublicKey())
+	require.NoError(t, err)
+
+	result, err := Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum check failed: backup has no manifest")
+	assert.Equal(t, StatusSkipped, checkStatuses(result)[CheckDecryption])
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckChecksum])
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckSignature])
+}
+
+func TestVerify_AgeRecipients(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	encryptor, err := encrypt.NewAgeEncryptor([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+	identities, err := encrypt.ParseAgeIdentities(strings.NewReader(identity.String()))
+	require.NoError(t, err)
+
+	backend := newTestBackend(t)
+	key := "backups/mysql-app-20240115-140532.sql.gz.age"
+	encrypted, err := encryptor.Encrypt(compress.NewGzipCompressor().Compress(strings.NewReader(testMySQLDump)))
+	require.NoError(t, err)
+	require.NoError(t, backend.Upload(context.Background(), "mysql-app-20240115-140532.sql.gz.age", encrypted))
+	writeManifest(t, backend, key, compress.GzipName, encrypt.AgeAlgorithm)
+
+	// With the private key every check runs
+	result, err := Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{AgeIdentities: identities}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusPassed,
+		CheckDecompression: StatusPassed,
+		CheckPayload:       StatusPassed,
+		CheckChecksum:      StatusPassed,
+	}, checkStatuses(result))
+
+	// The backup job only holds the public key, so it can't vouch for the
+	// backup without a signature
+	_, err = Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	assert.ErrorContains(t, err, "no encryption key configured for age-X25519")
+
+	// With one, the checksum and signature are checked instead
+	signer := newTestSigner(t, 1)
+	signManifest(t, backend, key, signer)
+	verifier, err := signing.NewVerifier(signer.PublicKey())
+	require.NoError(t, err)
+	result, err = Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusSkipped,
+		CheckDecompression: StatusSkipped,
+		CheckPayload:       StatusSkipped,
+		CheckChecksum:      StatusPassed,
+		CheckSignature:     StatusPassed,
+	}, checkStatuses(result))
+
+	tamper(t, backend, key, -1)
+	result, err = Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+	require.Error(t, err)
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckChecksum])
+}
+
+func TestVerify_CorruptGzipFailsDecompression(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.gz", []byte(strings.Repeat(testMySQLDump, 100)), true, nil)
+	// Corrupt the CRC in the gzip trailer
+	tamper(t, backend, "backups/mysql-app-20240115-140532.sql.gz", -6)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.gz", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "decompression check failed")
+
+	assert.Equal(t, map[string]Status{
+		CheckDownload:      StatusPassed,
+		CheckDecryption:    StatusSkipped,
+		CheckDecompression: StatusFailed,
+		CheckPayload:       StatusSkipped,
+		CheckChecksum:      StatusSkipped,
+	}, checkStatuses(result))
+}
+
+func TestVerify_TruncatedMySQLDumpFailsPayload(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	truncated := testMySQLDump[:strings.Index(testMySQLDump, "-- Dump completed")]
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql.gz", []byte(truncated), true, nil)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql.gz", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload check failed")
+
+	assert.Equal(t, StatusPassed, checkStatuses(result)[CheckDecompression])
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckPayload])
+}
+
+func TestVerify_MissingObject(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.Error(t, err)
+
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckDownload])
+}
+
+func TestVerify_ChecksumMatchesManifest(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), false, nil)
+	writeManifest(t, backend, "backups/mysql-app-20240115-140532.sql", "", "")
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusPassed, checkStatuses(result)[CheckChecksum])
+}
+
+func TestVerify_ChecksumMismatchFails(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), false, nil)
+	writeManifest(t, backend, "backups/mysql-app-20240115-140532.sql", "", "")
+	// Still a complete dump, just not the one that was backed up
+	tamper(t, backend, "backups/mysql-app-20240115-140532.sql", 30)
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum check failed")
+
+	assert.Equal(t, StatusPassed, checkStatuses(result)[CheckPayload])
+	assert.Equal(t, StatusFailed, checkStatuses(result)[CheckChecksum])
+}
+
+func TestVerify_Signature(t *testing.T) {
+	t.Parallel()
+
+	const key = "backups/mysql-app-20240115-140532.sql"
+	signer := newTestSigner(t, 1)
+	verifier, err := signing.NewVerifier(signer.PublicKey())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, backend *storage.LocalBackend)
+		wantErr string
+	}{
+		{"signed", func(t *testing.T, backend *storage.LocalBackend) {
+			signManifest(t, backend, key, signer)
+		}, ""},
+		{"replaced with a fresh manifest", func(t *testing.T, backend *storage.LocalBackend) {
+			// The checksum matches, but only the pipeline can sign
+			testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(strings.Replace(testMySQLDump, "id int", "id bigint", 1)), false, nil)
+			writeManifest(t, backend, key, "", "")
+		}, "manifest is not signed"},
+		{"signed by someone else", func(t *testing.T, backend *storage.LocalBackend) {
+			signManifest(t, backend, key, newTestSigner(t, 2))
+		}, "manifest is signed by untrusted key"},
+		{"manifest of another backup", func(t *testing.T, backend *storage.LocalBackend) {
+			other := "backups/mysql-app-20240101-000000.sql"
+			testutil.UploadBackup(t, backend, "mysql-app-20240101-000000.sql", []byte(testMySQLDump), false, nil)
+			writeManifest(t, backend, other, "", "")
+			signManifest(t, backend, other, signer)
+
+			m, err := manifest.Fetch(context.Background(), backend, other)
+			require.NoError(t, err)
+			var body bytes.Buffer
+			require.NoError(t, m.Encode(&body))
+			require.NoError(t, backend.Upload(context.Background(), strings.TrimPrefix(manifest.Key(key), "backups/"), &body))
+		}, "manifest describes backups/mysql-app-20240101-000000.sql"},
+		{"no manifest", func(t *testing.T, backend *storage.LocalBackend) {
+			require.NoError(t, backend.Delete(context.Background(), manifest.Key(key)))
+		}, "backup has no manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := newTestBackend(t)
+			testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), false, nil)
+			writeManifest(t, backend, key, "", "")
+			tt.setup(t, backend)
+
+			result, err := Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, verifier)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, StatusPassed, checkStatuses(result)[CheckSignature])
+				assert.Equal(t, "signed by key "+signer.KeyID(), result.Checks[len(result.Checks)-1].Detail)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "signature check failed: "+tt.wantErr)
+			assert.Equal(t, StatusFailed, checkStatuses(result)[CheckSignature])
+		})
+	}
+
+	// Without a verifier, signatures aren't checked at all
+	backend := newTestBackend(t)
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), false, nil)
+	writeManifest(t, backend, key, "", "")
+	result, err := Verify(context.Background(), backend, key, config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.NoError(t, err)
+	assert.NotContains(t, checkStatuses(result), CheckSignature)
+}
+
+func TestVerify_ManifestOverridesExtensions(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t)
+	// Compressed, but stored under a name without the .gz extension
+	testutil.UploadBackup(t, backend, "mysql-app-20240115-140532.sql", []byte(testMySQLDump), true, nil)
+	writeManifest(t, backend, "backups/mysql-app-20240115-140532.sql", compress.GzipName, "")
+
+	result, err := Verify(context.Background(), backend, "backups/mysql-app-20240115-140532.sql", config.DatabaseTypeMySQL, encrypt.Keys{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusPassed, checkStatuses(result)[CheckDecompression])
+	assert.Equal(t, int64(len(testMySQLDump)), result.PayloadSize)
+}
+
+// Tests for payload validators
+func TestNewPayloadValidator(t *testing.T) {
+	t.Parallel()
+
+	for _, dbType := range []config.DatabaseType{config.DatabaseTypePostgres, config.DatabaseTypeMySQL, config.DatabaseTypeMongoDB} {
+		validator, err := NewPayloadValidator(dbType)
+		require.NoError(t, err)
+		assert.NotNil(t, validator)
+	}
+
+	_, err := NewPayloadValidator("oracle")
+	assert.Error(t, err)
+}
+
+func TestPostgresValidator_RejectsPlainSQL(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&PostgresValidator{}).Validate(context.Background(), strings.NewReader("-- PostgreSQL database dump\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PGDMP")
+}
+
+func TestPostgresValidator_HeaderOnlyWithoutPgRestore(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	detail, err := (&PostgresValidator{}).Validate(context.Background(), strings.NewReader("PGDMP\x01\x0e\x00"))
+	require.NoError(t, err)
+	assert.Contains(t, detail, "pg_restore not found")
+}
+
+func TestCountTOCEntries(t *testing.T) {
+	t.Parallel()
+
+	output := `;
+; Archive created at 2024-01-15 14:05:32 UTC
+;     dbname: app
+;
+3; 2615 2200 SCHEMA - public pg_database_owner
+215; 1259 16385 TABLE public users app
+3340; 0 16385 TABLE DATA public users app
+`
+	assert.Equal(t, 3, countTOCEntries(strings.NewReader(output)))
+}
+
+func TestMySQLValidator_TrailerBeyondTailIsIgnored(t *testing.T) {
+	t.Parallel()
+
+	dump := testMySQLDump + strings.Repeat("INSERT INTO t VALUES (1);\n", 1000)
+
+	_, err := (&MySQLValidator{}).Validate(context.Background(), strings.NewReader(dump))
+	assert.Error(t, err)
+}
+
+func TestMySQLValidator_Empty(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&MySQLValidator{}).Validate(context.Background(), strings.NewReader(""))
+	assert.ErrorContains(t, err, "empty")
+}
+
+func TestTailBuffer(t *testing.T) {
+	t.Parallel()
+
+	tail := &tailBuffer{limit: 4}
+	for _, s := range []string{"ab", "cdef", "g"} {
+		n, err := tail.Write([]byte(s))
+		require.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+
+	assert.Equal(t, "defg", string(tail.buf))
+}
+
+func buildTar(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0o755}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 4}))
+		_, err := tw.Write([]byte("data"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestMongoDBValidator(t *testing.T) {
+	t.Parallel()
+
+	archive := buildTar(t, "dump/", "dump/app/", "dump/app/users.bson", "dump/app/users.metadata.json")
+
+	detail, err := (&MongoDBValidator{}).Validate(context.Background(), bytes.NewReader(archive))
+	require.NoError(t, err)
+	assert.Equal(t, "tar archive with 4 entries (1 collections)", detail)
+}
+
+func TestMongoDBValidator_Truncated(t *testing.T) {
+	t.Parallel()
+
+	archive := buildTar(t, "dump/", "dump/app/", "dump/app/users.bson")
+
+	_, err := (&MongoDBValidator{}).Validate(context.Background(), bytes.NewReader(archive[:700]))
+	assert.Error(t, err)
+}
+
+func TestMongoDBValidator_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&MongoDBValidator{}).Validate(context.Background(), bytes.NewReader(nil))
+	assert.ErrorContains(t, err, "archive is empty")
+
+	_, err = (&MongoDBValidator{}).Validate(context.Background(), bytes.NewReader(buildTar(t, "etc/passwd")))
+	assert.ErrorContains(t, err, "outside of dump/")
+}
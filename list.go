@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/notify"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+// databaseListing is the list output for one configured database
+type databaseListing struct {
+	Database  string          `json:"database"`
+	Type      string          `json:"type"`
+	Prefix    string          `json:"prefix"`
+	TotalSize int64           `json:"total_size"`
+	Backups   []backupListing `json:"backups"`
+}
+
+type backupListing struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	Timestamp    time.Time `json:"timestamp"`
+	LastModified time.Time `json:"last_modified"`
+	Compression  string    `json:"compression,omitempty"`
+	Encrypted    bool      `json:"encrypted"`
+}
+
+func runListCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Optional: list only the specified database's backups")
+	asJSON := flags.Bool("json", false, "Print the listing as JSON")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	databases := cfg.Databases
+	if *databaseName != "" {
+		db, err := findDatabase(cfg, *databaseName)
+		if err != nil {
+			return err
+		}
+		databases = []config.DatabaseConfig{*db}
+	}
+
+	listings := make([]databaseListing, 0, len(databases))
+	for i := range databases {
+		listing, err := listDatabaseBackups(ctx, cfg, &databases[i])
+		if err != nil {
+			return fmt.Errorf("failed to list backups for %s: %w", databases[i].Name, err)
+		}
+		listings = append(listings, *listing)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listings)
+	}
+
+	return printListings(os.Stdout, listings)
+}
+
+// listDatabaseBackups collects the backups of db, newest first. Objects
+// under the prefix that aren't backups of db are left out.
+func listDatabaseBackups(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig) (*databaseListing, error) {
+	backend, err := storage.NewBackend(ctx, cfg.ForDatabase(db), db.BackupPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	objects, err := backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &databaseListing{
+		Database: db.Name,
+		Type:     string(db.Type),
+		Prefix:   db.BackupPrefix,
+		Backups:  []backupListing{},
+	}
+
+	for _, obj := range objects {
+		info, err := backup.ParseKey(obj.Key)
+		if err != nil || !info.IsBackupOf(db) {
+			continue
+		}
+
+		listing.Backups = append(listing.Backups, backupListing{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			Timestamp:    info.Timestamp,
+			LastModified: obj.LastModified,
+			Compression:  info.Compression,
+			Encrypted:    info.Encrypted,
+		})
+		listing.TotalSize += obj.Size
+	}
+
+	// Order by the backup's own timestamp rather than upload time
+	sort.SliceStable(listing.Backups, func(i, j int) bool {
+		return listing.Backups[i].Timestamp.After(listing.Backups[j].Timestamp)
+	})
+
+	return listing, nil
+}
+
+func printListings(w io.Writer, listings []databaseListing) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for i, listing := range listings {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s) - %s - %d backup(s), %s total\n",
+			listing.Database, listing.Type, listing.Prefix, len(listing.Backups), notify.FormatBytes(listing.TotalSize))
+
+		if len(listing.Backups) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(tw, "  TIMESTAMP (UTC)\tSIZE\tCOMPRESSION\tENCRYPTED\tKEY")
+		for _, b := range listing.Backups {
+			compression := b.Compression
+			if compression == "" {
+				compression = "none"
+			}
+			encrypted := "no"
+			if b.Encrypted {
+				encrypted = "yes"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n",
+				b.Timestamp.Format("2006-01-02 15:04:05"), notify.FormatBytes(b.Size), compression, encrypted, b.Key)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -3,27 +3,36 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
-	"github.com/jorgepascosoto/auto-db-backups/internal/compress"
 	"github.com/jorgepascosoto/auto-db-backups/internal/config"
-	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
 	"github.com/jorgepascosoto/auto-db-backups/internal/notify"
+	"github.com/jorgepascosoto/auto-db-backups/internal/retry"
 	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+	"github.com/jorgepascosoto/auto-db-backups/internal/verify"
 )
 
 func main() {
-	// Parse command-line flags
-	databaseName := flag.String("database", "", "Optional: backup only the specified database by name")
-	flag.Parse()
+	// The first argument selects a command; without one, run a backup so
+	// existing invocations (`auto-db-backups --database x`) keep working
+	command, args := "backup", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -37,103 +46,107 @@ func main() {
 		cancel()
 	}()
 
-	if err := run(ctx, *databaseName); err != nil {
+	var err error
+	switch command {
+	case "backup":
+		err = runBackupCommand(ctx, args)
+	case "restore":
+		err = runRestoreCommand(ctx, args)
+	case "list":
+		err = runListCommand(ctx, args)
+	case "verify":
+		err = runVerifyCommand(ctx, args)
+	case "drill":
+		err = runDrillCommand(ctx, args)
+	case "validate":
+		err = runValidateCommand(ctx, args)
+	case "rekey":
+		err = runRekeyCommand(ctx, args)
+	default:
+		err = fmt.Errorf("unknown command %q (available: backup, restore, list, verify, drill, validate, rekey)", command)
+	}
+
+	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 }
 
-func run(ctx context.Context, databaseName string) error {
+func runBackupCommand(ctx context.Context, args []string) error {
+	// Parse command-line flags
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Optional: backup only the specified database by name")
+	dryRun := flags.Bool("dry-run", false, "Back up as usual, but only report which old backups retention would delete (same as RETENTION_DRY_RUN=true)")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	return run(ctx, *configPath, *databaseName, *dryRun)
+}
+
+// addConfigFlag registers the --config flag all commands share
+func addConfigFlag(flags *flag.FlagSet) *string {
+	return flags.String("config", "", "Path to a YAML config file (defaults to $CONFIG_FILE); environment variables take precedence over it")
+}
+
+func run(ctx context.Context, configPath, databaseName string, dryRun bool) error {
 	startTime := time.Now()
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.LoadFile(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	if dryRun {
+		cfg.RetentionDryRun = true
+	}
 
 	// Filter databases if specific database name is provided
 	if databaseName != "" {
-		var filtered []config.DatabaseConfig
-		for _, db := range cfg.Databases {
-			if db.Name == databaseName {
-				filtered = append(filtered, db)
-			}
-		}
-		if len(filtered) == 0 {
-			return fmt.Errorf("database '%s' not found in configuration. Available databases: %v", databaseName, getDatabaseNames(cfg.Databases))
+		db, err := findDatabase(cfg, databaseName)
+		if err != nil {
+			return err
 		}
-		cfg.Databases = filtered
+		cfg.Databases = []config.DatabaseConfig{*db}
 		log.Printf("Filtering to single database: %s", databaseName)
 	}
 
-	log.Printf("Starting backup for %d database(s)", len(cfg.Databases))
+	workers := min(cfg.Parallelism(), len(cfg.Databases))
+	log.Printf("Starting backup for %d database(s), %d at a time", len(cfg.Databases), workers)
+	if cfg.Signer != nil {
+		// The public key isn't secret; logging it is the easiest way to
+		// hand it to whoever verifies signatures
+		log.Printf("Signing manifests with key %s (public key %s)", cfg.Signer.KeyID(), base64.StdEncoding.EncodeToString(cfg.Signer.PublicKey()))
+	}
+
+	// Each worker writes only its own database's slot, so results need no
+	// locking and are aggregated in configuration order afterwards
+	summaries := make([]*notify.BackupSummary, len(cfg.Databases))
+	runParallel(ctx, len(cfg.Databases), workers, func(i int) {
+		db := &cfg.Databases[i]
+		logger := log.New(log.Writer(), fmt.Sprintf("[%d/%d %s] ", i+1, len(cfg.Databases), db.Name), log.Flags()|log.Lmsgprefix)
+		summaries[i] = backupDatabase(ctx, cfg, db, logger)
+	})
+
+	if cfg.RetentionBucketMaxSize > 0 {
+		applyBucketBudgets(ctx, cfg, summaries)
+	}
 
 	// Track results for all databases
 	var allBackupKeys []string
 	var allBackupSizes []int64
 	var failedDatabases []string
 
-	// Process each database
-	for i, db := range cfg.Databases {
-		dbStartTime := time.Now()
-		log.Printf("[%d/%d] Backing up %s database: %s", i+1, len(cfg.Databases), db.Type, db.Name)
-
-		// Create summary for this database
-		summary := &notify.BackupSummary{
-			DatabaseType: string(db.Type),
-			DatabaseName: db.Name,
-			Compressed:   cfg.Compression,
-			Encrypted:    cfg.HasEncryption(),
-		}
-
-		// Run the backup for this database
-		backupKey, backupSize, err := performBackup(ctx, cfg, &db)
-		summary.Duration = time.Since(dbStartTime)
-
-		if err != nil {
-			log.Printf("[%d/%d] FAILED: %s - %v", i+1, len(cfg.Databases), db.Name, err)
-			summary.Success = false
-			summary.Error = err
-			failedDatabases = append(failedDatabases, db.Name)
-
-			// Send failure notification for this database
-			if err := sendNotifications(ctx, cfg, summary); err != nil {
-				log.Printf("Warning: failed to send notifications for %s: %v", db.Name, err)
-			}
+	for i, summary := range summaries {
+		if summary == nil {
+			log.Printf("[%d/%d %s] SKIPPED: %v", i+1, len(cfg.Databases), cfg.Databases[i].Name, ctx.Err())
+			failedDatabases = append(failedDatabases, cfg.Databases[i].Name)
 			continue
 		}
-
-		log.Printf("[%d/%d] SUCCESS: %s -> %s (%d bytes)", i+1, len(cfg.Databases), db.Name, backupKey, backupSize)
-		summary.Success = true
-		summary.BackupKey = backupKey
-		summary.BackupSize = backupSize
-
-		allBackupKeys = append(allBackupKeys, backupKey)
-		allBackupSizes = append(allBackupSizes, backupSize)
-
-		// Apply retention policy for this database's prefix
-		if cfg.HasRetention() {
-			r2Client, err := storage.NewR2Client(ctx, cfg, db.BackupPrefix)
-			if err != nil {
-				log.Printf("Warning: failed to create R2 client for retention (%s): %v", db.Name, err)
-			} else {
-				result, err := storage.ApplyRetention(ctx, r2Client, storage.RetentionPolicy{
-					Days:  cfg.RetentionDays,
-					Count: cfg.RetentionCount,
-				})
-				if err != nil {
-					log.Printf("Warning: retention policy failed for %s: %v", db.Name, err)
-				} else if result.DeletedCount > 0 {
-					log.Printf("[%d/%d] Deleted %d old backup(s) for %s", i+1, len(cfg.Databases), result.DeletedCount, db.Name)
-					summary.DeletedBackups = result.DeletedCount
-				}
-			}
-		}
-
-		// Send success notification for this database
-		if err := sendNotifications(ctx, cfg, summary); err != nil {
-			log.Printf("Warning: failed to send notifications for %s: %v", db.Name, err)
+		if !summary.Success {
+			failedDatabases = append(failedDatabases, summary.DatabaseName)
+			continue
 		}
+		allBackupKeys = append(allBackupKeys, summary.BackupKey)
+		allBackupSizes = append(allBackupSizes, summary.BackupSize)
 	}
 
 	// Set GitHub Action outputs (aggregate results)
@@ -163,92 +176,455 @@ func run(ctx context.Context, databaseName string) error {
 	return nil
 }
 
-func performBackup(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig) (string, int64, error) {
+// runParallel calls fn for each index in [0, n) on up to workers goroutines.
+// Once ctx is canceled no further indexes are started; calls already running
+// are expected to stop through ctx themselves.
+func runParallel(ctx context.Context, n, workers int, fn func(i int)) {
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range n {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// backupDatabase backs up one database, applies retention to its prefix and
+// sends its notifications, logging through logger
+func backupDatabase(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig, logger *log.Logger) *notify.BackupSummary {
+	cfg = cfg.ForDatabase(db)
+	dbStartTime := time.Now()
+	logger.Printf("Backing up %s database: %s", db.Type, db.Name)
+
+	// Create summary for this database
+	summary := &notify.BackupSummary{
+		DatabaseType: string(db.Type),
+		DatabaseName: db.Name,
+		Compressed:   cfg.Compression,
+		Encrypted:    cfg.HasEncryption(),
+	}
+
+	// Notifications still go out if a shutdown signal canceled the backup
+	notifyCtx := context.WithoutCancel(ctx)
+
+	// Run the backup for this database. Each attempt streams a fresh export,
+	// since a failed upload can't resume a dump that was already consumed.
+	var m *manifest.Manifest
+	var destinations []notify.DestinationResult
+	policy := retry.Policy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+	}
+	attempts, err := retry.Do(ctx, policy, func(attempt int) error {
+		var err error
+		m, destinations, err = performBackup(ctx, cfg, db, logger)
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		logger.Printf("Attempt %d/%d failed, retrying in %s: %v", attempt, policy.MaxAttempts, delay.Round(time.Second), err)
+	})
+	summary.Attempts = attempts
+	summary.Duration = time.Since(dbStartTime)
+	if len(destinations) > 1 {
+		summary.Destinations = destinations
+	}
+
+	if err != nil {
+		logger.Printf("FAILED: %s - %v", db.Name, err)
+		summary.Success = false
+		summary.Error = err
+
+		// Send failure notification for this database
+		if err := sendNotifications(notifyCtx, cfg, summary); err != nil {
+			logger.Printf("Warning: failed to send notifications for %s: %v", db.Name, err)
+		}
+		return summary
+	}
+
+	logger.Printf("SUCCESS: %s -> %s (%d bytes)", db.Name, m.Key, m.StoredSize)
+	summary.Success = true
+	summary.BackupKey = m.Key
+	summary.BackupSize = m.StoredSize
+	summary.DumpCompression = m.DumpCompression
+	if m.Signature != nil {
+		summary.SignatureKeyID = m.Signature.KeyID
+	}
+
+	// Apply retention policy for this database's prefix
+	if cfg.HasRetention() {
+		applyRetention(ctx, cfg, db, m, destinations, summary, logger)
+	}
+
+	// Send success notification for this database
+	if err := sendNotifications(notifyCtx, cfg, summary); err != nil {
+		logger.Printf("Warning: failed to send notifications for %s: %v", db.Name, err)
+	}
+
+	return summary
+}
+
+// applyRetention prunes db's old backups, but only once the backup described
+// by m has passed verification, so a run that produced a broken backup never
+// deletes the good ones before it. Retention is applied to each destination
+// in destinations the backup reached; the outcome is recorded in summary.
+func applyRetention(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig, m *manifest.Manifest, destinations []notify.DestinationResult, summary *notify.BackupSummary, logger *log.Logger) {
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	if err != nil {
+		logger.Printf("Warning: failed to create storage client for retention (%s): %v", db.Name, err)
+		return
+	}
+
+	// Every destination received the same stream, so verifying the
+	// primary's copy vouches for the replicas too. A backup the job can't
+	// decrypt, such as an age backup, is vouched for by its signature.
+	logger.Printf("Verifying %s before applying retention...", m.Key)
+	if _, err := verify.Verify(ctx, backend, m.Key, db.Type, cfg.DecryptionKeys(), cfg.SignatureVerifier); err != nil {
+		logger.Printf("Warning: skipping retention for %s, the new backup failed verification: %v", db.Name, err)
+		summary.RetentionSkipped = fmt.Sprintf("new backup failed verification: %v", err)
+		return
+	}
+
+	policy := storage.RetentionPolicy{
+		Days:    cfg.RetentionDays,
+		Count:   cfg.RetentionCount,
+		Daily:   cfg.RetentionDaily,
+		Weekly:  cfg.RetentionWeekly,
+		Monthly: cfg.RetentionMonthly,
+		Yearly:  cfg.RetentionYearly,
+		MaxSize: cfg.RetentionMaxSize,
+		MinKeep: cfg.RetentionMinKeep,
+		DryRun:  cfg.RetentionDryRun,
+	}
+	summary.RetentionDryRun = policy.DryRun
+
+	for i, destination := range cfg.Destinations() {
+		// Replicas the backup didn't reach keep their older backups
+		if i > 0 && !reached(destinations, string(destination.StorageBackend)) {
+			continue
+		}
+		if i > 0 {
+			if backend, err = storage.NewBackend(ctx, destination, db.BackupPrefix); err != nil {
+				logger.Printf("Warning: failed to create %s storage client for retention (%s): %v", destination.StorageBackend, db.Name, err)
+				continue
+			}
+		}
+
+		result, err := storage.ApplyRetention(ctx, backend, db, policy)
+		if err != nil {
+			logger.Printf("Warning: retention policy failed for %s in %s storage: %v", db.Name, destination.StorageBackend, err)
+			continue
+		}
+
+		summary.DeletedBackups += result.DeletedCount
+		summary.ReclaimedBytes += result.ReclaimedBytes
+		if summary.RetentionDeletedKeys == nil {
+			summary.RetentionDeletedKeys = make(map[string][]string)
+		}
+		summary.RetentionDeletedKeys[destination.Destination()] = result.DeletedKeys
+		if result.DryRun {
+			logger.Printf("Dry run: retention would delete %d old backup(s) for %s in %s storage (%s)", result.DeletedCount, db.Name, destination.StorageBackend, notify.FormatBytes(result.ReclaimedBytes))
+		} else if result.DeletedCount > 0 {
+			logger.Printf("Deleted %d old backup(s) for %s in %s storage (%s)", result.DeletedCount, db.Name, destination.StorageBackend, notify.FormatBytes(result.ReclaimedBytes))
+		}
+	}
+}
+
+// reached reports whether the upload to the destination named name succeeded
+func reached(destinations []notify.DestinationResult, name string) bool {
+	for _, destination := range destinations {
+		if destination.Name == name {
+			return destination.Success
+		}
+	}
+	return false
+}
+
+// applyBucketBudgets enforces RETENTION_BUCKET_MAX_SIZE on each destination
+// the databases back up to, replicas included. Only databases whose backup
+// succeeded, reached the destination and passed verification this run have
+// old backups deleted there. Backups their own retention deleted, or with a
+// dry run would have, no longer count.
+func applyBucketBudgets(ctx context.Context, cfg *config.Config, summaries []*notify.BackupSummary) {
+	var destinations []string
+	members := make(map[string][]storage.BudgetMember)
+	effective := make(map[string]*config.Config)
+	for i, summary := range summaries {
+		if summary == nil || !summary.Success || summary.RetentionSkipped != "" {
+			continue
+		}
+		db := &cfg.Databases[i]
+		for j, dbCfg := range cfg.ForDatabase(db).Destinations() {
+			if j > 0 && !reached(summary.Destinations, string(dbCfg.StorageBackend)) {
+				continue
+			}
+			destination := dbCfg.Destination()
+			if _, ok := members[destination]; !ok {
+				destinations = append(destinations, destination)
+				effective[destination] = dbCfg
+			}
+			members[destination] = append(members[destination], storage.BudgetMember{
+				Database: db,
+				MinKeep:  dbCfg.RetentionMinKeep,
+				Deleted:  summary.RetentionDeletedKeys[destination],
+			})
+		}
+	}
+
+	for _, destination := range destinations {
+		summary := &notify.BudgetSummary{
+			Destination: destination,
+			Budget:      cfg.RetentionBucketMaxSize,
+			DryRun:      cfg.RetentionDryRun,
+		}
+
+		backend, err := storage.NewBackend(ctx, effective[destination], "")
+		var result *storage.RetentionResult
+		if err == nil {
+			result, err = storage.ApplyBucketBudget(ctx, backend, members[destination], cfg.RetentionBucketMaxSize, cfg.RetentionDryRun)
+		}
+
+		switch {
+		case err != nil:
+			summary.Error = err
+			log.Printf("Warning: storage budget failed for %s: %v", destination, err)
+		case result.DryRun:
+			log.Printf("Dry run: storage budget would delete %d old backup(s) in %s (%s)", result.DeletedCount, destination, notify.FormatBytes(result.ReclaimedBytes))
+		case result.DeletedCount > 0:
+			log.Printf("Storage budget deleted %d old backup(s) in %s (%s)", result.DeletedCount, destination, notify.FormatBytes(result.ReclaimedBytes))
+		}
+		if result != nil {
+			summary.DeletedBackups = result.DeletedCount
+			summary.ReclaimedBytes = result.ReclaimedBytes
+		}
+
+		if err := notify.WriteGitHubBudgetSummary(summary); err != nil {
+			log.Printf("Warning: failed to write GitHub summary: %v", err)
+		}
+	}
+}
+
+// performBackup streams one backup of db to every destination and uploads
+// its manifest next to each copy. It returns the outcome per destination,
+// primary first, and fails if the primary, or under REPLICA_POLICY=all any
+// replica, didn't receive the backup.
+func performBackup(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig, logger *log.Logger) (*manifest.Manifest, []notify.DestinationResult, error) {
+	// Cancel the export if anything downstream fails, so the dump command
+	// doesn't block forever writing to a pipe nobody is reading
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+
 	// Create database exporter
 	exporter, err := backup.NewExporter(db)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to create exporter: %w", err)
+		return nil, nil, fmt.Errorf("failed to create exporter: %w", err)
 	}
 
-	// Export database
-	log.Printf("  Exporting database...")
-	reader, err := exporter.Export(ctx)
+	// Build backup filename, e.g. postgres-mydb-20240115-140532.dump
+	filename := backup.Filename(db, startTime)
+
+	m := &manifest.Manifest{
+		Version:      manifest.Version,
+		DatabaseName: db.Name,
+		DatabaseType: string(db.Type),
+		StartedAt:    startTime.UTC(),
+	}
+	m.Repository, m.RunID, m.RunURL = notify.GitHubRunContext()
+
+	compressor, err := cfg.Compressor()
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to export database: %w", err)
+		return nil, nil, fmt.Errorf("failed to create compressor: %w", err)
+	}
+
+	// Let dump tools that compress by themselves know whether the pipeline
+	// compresses too, so the dump isn't compressed twice
+	if negotiator, ok := exporter.(backup.CompressionNegotiator); ok {
+		m.DumpCompression = negotiator.NegotiateCompression(compressor.Name())
+		if m.DumpCompression != "" {
+			logger.Printf("Dump is compressed by the dump tool itself (%s)", m.DumpCompression)
+		}
 	}
-	// Note: we don't defer Close() here because we need to check its error
-	// after reading all data (it captures pg_dump exit status)
 
-	// Build backup filename
-	timestamp := time.Now().UTC().Format("20060102-150405")
-	filename := fmt.Sprintf("%s-%s-%s", db.Type, db.Name, timestamp)
+	if version, err := exporter.ToolVersion(ctx); err != nil {
+		logger.Printf("Warning: %v", err)
+	} else {
+		m.ToolVersion = version
+	}
 
-	// Add extension based on database type
-	switch db.Type {
-	case config.DatabaseTypePostgres:
-		filename += ".dump"
-	case config.DatabaseTypeMySQL:
-		filename += ".sql"
-	case config.DatabaseTypeMongoDB:
-		filename += ".tar"
+	// Export database
+	logger.Printf("Exporting database...")
+	reader, err := exporter.Export(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to export database: %w", err)
 	}
 
-	var dataReader io.Reader = reader
+	// The dump's exit status (e.g. pg_dump failing halfway through) is only
+	// available after reading all output, so surface it as a read error at
+	// EOF. The uploader then aborts the multipart upload instead of
+	// completing it with a truncated object.
+	exportReader := backup.NewExitStatusReader(reader)
+	defer func() {
+		// Stop the dump first if it's still running, then reap it
+		cancel()
+		exportReader.Close()
+	}()
+
+	dumpCounter := backup.NewCountingReader(exportReader)
+	var dataReader io.Reader = dumpCounter
 
 	// Apply compression if enabled
 	if cfg.Compression {
-		log.Printf("  Compressing backup...")
-		compressor := compress.NewGzipCompressor()
+		logger.Printf("Compressing backup (%s)...", compressor.Name())
 		compressedReader := compressor.Compress(dataReader)
 		defer compressedReader.Close()
 		dataReader = compressedReader
 		filename += compressor.Extension()
+		m.Compression = compressor.Name()
 	}
 
 	// Apply encryption if enabled
 	if cfg.HasEncryption() {
-		log.Printf("  Encrypting backup...")
-		encryptor, err := encrypt.NewAESEncryptor(cfg.EncryptionKey)
+		logger.Printf("Encrypting backup...")
+		encryptor, err := cfg.Encryptor()
 		if err != nil {
-			return "", 0, fmt.Errorf("failed to create encryptor: %w", err)
+			return nil, nil, fmt.Errorf("failed to create encryptor: %w", err)
 		}
 		encryptedReader, err := encryptor.Encrypt(dataReader)
 		if err != nil {
-			return "", 0, fmt.Errorf("failed to encrypt backup: %w", err)
+			return nil, nil, fmt.Errorf("failed to encrypt backup: %w", err)
 		}
 		defer encryptedReader.Close()
 		dataReader = encryptedReader
 		filename += encryptor.Extension()
+		m.Encryption = &manifest.Encryption{Algorithm: encryptor.Algorithm(), KeyID: encryptor.KeyID()}
 	}
 
-	// Read all data into memory to get size before upload
-	// (Required because R2/S3 needs content length for some operations)
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, dataReader); err != nil {
-		reader.Close()
-		return "", 0, fmt.Errorf("failed to read backup data: %w", err)
+	// Stream straight into the multipart upload, counting and hashing bytes
+	// on the way so the stored size and checksum are known without
+	// buffering the backup
+	hash := sha256.New()
+	counter := backup.NewCountingReader(io.TeeReader(dataReader, hash))
+
+	// Upload to the configured storage backend and any replicas, all from
+	// the same stream
+	var destinations []storage.Destination
+	for i, destination := range cfg.Destinations() {
+		backend, err := storage.NewBackend(ctx, destination, db.BackupPrefix)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create %s storage client: %w", destination.StorageBackend, err)
+		}
+		destinations = append(destinations, storage.Destination{
+			Name:     string(destination.StorageBackend),
+			Backend:  backend,
+			Required: i == 0 || cfg.ReplicaPolicy == config.ReplicaPolicyAll,
+		})
 	}
-	backupSize := int64(buf.Len())
+	logger.Printf("Uploading backup to %s storage...", destinationNames(destinations))
 
-	// Close the reader to capture any errors from the dump command
-	// (pg_dump exit status is only available after reading all output)
-	if err := reader.Close(); err != nil {
-		return "", 0, fmt.Errorf("database export failed: %w", err)
+	uploads := storage.UploadAll(ctx, destinations, filename, counter, cfg.ReplicaBufferSize)
+
+	// A dump that failed mid-stream surfaces as a read error in every upload
+	if exportErr := exportReader.ExitErr(); exportErr != nil {
+		discardUploads(ctx, destinations, uploads, db.BackupPrefix+filename, logger)
+		return nil, nil, fmt.Errorf("database export failed: %w", exportErr)
 	}
 
-	// Upload to R2
-	log.Printf("  Uploading backup to R2...")
-	r2Client, err := storage.NewR2Client(ctx, cfg, db.BackupPrefix)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to create R2 client: %w", err)
+	results := make([]notify.DestinationResult, len(uploads))
+	var reachedDestinations []storage.Destination
+	for i, upload := range uploads {
+		results[i] = notify.DestinationResult{Name: upload.Destination, Success: upload.Err == nil}
+		if upload.Err == nil {
+			reachedDestinations = append(reachedDestinations, destinations[i])
+			continue
+		}
+		results[i].Error = upload.Err.Error()
+
+		if destinations[i].Required {
+			discardUploads(ctx, destinations, uploads, db.BackupPrefix+filename, logger)
+			return nil, results, fmt.Errorf("failed to upload backup to %s storage: %w", upload.Destination, upload.Err)
+		}
+		logger.Printf("Warning: failed to replicate backup to %s storage: %v", upload.Destination, upload.Err)
+	}
+
+	// The primary's upload read to EOF, so this just returns the recorded
+	// exit status
+	if err := exportReader.Close(); err != nil {
+		discardUploads(ctx, destinations, uploads, db.BackupPrefix+filename, logger)
+		return nil, nil, fmt.Errorf("database export failed: %w", err)
 	}
 
-	if err := r2Client.Upload(ctx, filename, &buf); err != nil {
-		return "", 0, fmt.Errorf("failed to upload backup: %w", err)
+	m.Key = db.BackupPrefix + filename
+	m.FinishedAt = time.Now().UTC()
+	m.UncompressedSize = dumpCounter.Count()
+	m.StoredSize = counter.Count()
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if cfg.Signer != nil {
+		cfg.Signer.Sign(m)
 	}
 
-	fullKey := db.BackupPrefix + filename
-	return fullKey, backupSize, nil
+	// The backup itself is complete at this point, so a failed manifest
+	// upload is only a warning
+	var body bytes.Buffer
+	if err := m.Encode(&body); err != nil {
+		logger.Printf("Warning: failed to encode manifest: %v", err)
+		return m, results, nil
+	}
+	for _, destination := range reachedDestinations {
+		if err := destination.Backend.Upload(ctx, manifest.Key(filename), bytes.NewReader(body.Bytes())); err != nil {
+			logger.Printf("Warning: failed to upload manifest to %s storage: %v", destination.Name, err)
+		}
+	}
+
+	return m, results, nil
+}
+
+// discardUploads deletes the copies of a failed backup that did upload. The
+// attempt is retried under a new name, and a copy left behind would pass for
+// a backup in listings and retention, with no manifest to check it against.
+// Deleting is best-effort: failures are only logged.
+func discardUploads(ctx context.Context, destinations []storage.Destination, uploads []storage.UploadResult, key string, logger *log.Logger) {
+	// Clean up even when a shutdown signal canceled the backup
+	ctx = context.WithoutCancel(ctx)
+	for i, upload := range uploads {
+		if upload.Err != nil {
+			continue
+		}
+		if err := destinations[i].Backend.Delete(ctx, key); err != nil {
+			logger.Printf("Warning: failed to delete incomplete backup %s from %s storage: %v", key, upload.Destination, err)
+			continue
+		}
+		logger.Printf("Deleted incomplete backup %s from %s storage", key, upload.Destination)
+	}
+}
+
+// destinationNames lists destinations for logging, e.g. "r2, s3"
+func destinationNames(destinations []storage.Destination) string {
+	names := make([]string, len(destinations))
+	for i, destination := range destinations {
+		names[i] = destination.Name
+	}
+	return strings.Join(names, ", ")
 }
 
 func sendNotifications(ctx context.Context, cfg *config.Config, summary *notify.BackupSummary) error {
@@ -271,6 +647,16 @@ func sendNotifications(ctx context.Context, cfg *config.Config, summary *notify.
 	return nil
 }
 
+// findDatabase looks up a configured database by name
+func findDatabase(cfg *config.Config, name string) (*config.DatabaseConfig, error) {
+	for i := range cfg.Databases {
+		if cfg.Databases[i].Name == name {
+			return &cfg.Databases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("database '%s' not found in configuration. Available databases: %v", name, getDatabaseNames(cfg.Databases))
+}
+
 func getDatabaseNames(databases []config.DatabaseConfig) []string {
 	names := make([]string, len(databases))
 	for i, db := range databases {
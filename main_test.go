@@ -1,9 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+	"github.com/jorgepascosoto/auto-db-backups/internal/notify"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+	"github.com/jorgepascosoto/auto-db-backups/internal/verify"
 )
 
 // TestMainPackageImports verifies that the main package can be compiled
@@ -15,6 +33,142 @@ func TestMainPackageImports(t *testing.T) {
 	assert.True(t, true)
 }
 
+// newLocalTestConfig returns a config using local storage in a temp directory
+func newLocalTestConfig(t *testing.T) (*config.Config, *config.DatabaseConfig) {
+	t.Helper()
+	db := config.DatabaseConfig{
+		Type:         config.DatabaseTypePostgres,
+		Name:         "app",
+		BackupPrefix: "backups/app/",
+	}
+	cfg := &config.Config{
+		Databases:        []config.DatabaseConfig{db},
+		StorageBackend:   config.StorageBackendLocal,
+		LocalStoragePath: t.TempDir(),
+	}
+	return cfg, &cfg.Databases[0]
+}
+
+func TestFindDatabase(t *testing.T) {
+	t.Parallel()
+
+	cfg, _ := newLocalTestConfig(t)
+
+	db, err := findDatabase(cfg, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "app", db.Name)
+
+	_, err = findDatabase(cfg, "missing")
+	assert.ErrorContains(t, err, "not found in configuration")
+}
+
+func TestListDatabaseBackups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg, db := newLocalTestConfig(t)
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	require.NoError(t, err)
+
+	for name, size := range map[string]int{
+		"postgres-app-20240101-000000.dump.gz":     10,
+		"postgres-app-20240103-000000.dump.gz.enc": 30,
+		"postgres-app-20240102-000000.dump":        20,
+		"postgres-app-v2-20240104-000000.dump":     5, // another database's backup
+		"notes.txt":                                1,
+	} {
+		require.NoError(t, backend.Upload(ctx, name, strings.NewReader(strings.Repeat("x", size))))
+	}
+
+	listing, err := listDatabaseBackups(ctx, cfg, db)
+	require.NoError(t, err)
+
+	require.Len(t, listing.Backups, 3)
+	assert.Equal(t, "backups/app/postgres-app-20240103-000000.dump.gz.enc", listing.Backups[0].Key)
+	assert.Equal(t, "backups/app/postgres-app-20240102-000000.dump", listing.Backups[1].Key)
+	assert.Equal(t, "backups/app/postgres-app-20240101-000000.dump.gz", listing.Backups[2].Key)
+	assert.Equal(t, int64(60), listing.TotalSize)
+	assert.True(t, listing.Backups[0].Encrypted)
+	assert.Equal(t, "gzip", listing.Backups[0].Compression)
+	assert.Empty(t, listing.Backups[1].Compression)
+
+	var out bytes.Buffer
+	require.NoError(t, printListings(&out, []databaseListing{*listing}))
+	assert.Contains(t, out.String(), "app (postgres) - backups/app/ - 3 backup(s), 60 B total")
+	assert.Contains(t, out.String(), "2024-01-03 00:00:00")
+}
+
+func TestLatestBackupKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg, db := newLocalTestConfig(t)
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	require.NoError(t, err)
+
+	_, err = latestBackupKey(ctx, backend, db)
+	assert.ErrorContains(t, err, "no backups found")
+
+	require.NoError(t, backend.Upload(ctx, "postgres-app-20240101-000000.dump", strings.NewReader("x")))
+	require.NoError(t, backend.Upload(ctx, "notes.txt", strings.NewReader("x")))
+
+	key, err := latestBackupKey(ctx, backend, db)
+	require.NoError(t, err)
+	assert.Equal(t, "backups/app/postgres-app-20240101-000000.dump", key)
+
+	// An older backup rewritten since, e.g. by rekey, is still older
+	require.NoError(t, backend.Upload(ctx, "postgres-app-20240102-000000.dump", strings.NewReader("x")))
+	require.NoError(t, backend.Upload(ctx, "postgres-app-20231231-000000.dump", strings.NewReader("x")))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(cfg.LocalStoragePath, "backups", "app", "postgres-app-20231231-000000.dump"), later, later))
+
+	key, err = latestBackupKey(ctx, backend, db)
+	require.NoError(t, err)
+	assert.Equal(t, "backups/app/postgres-app-20240102-000000.dump", key)
+}
+
+func TestRunParallel_LimitsConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var running, peak atomic.Int32
+	var calls [10]atomic.Int32
+
+	runParallel(context.Background(), len(calls), 3, func(i int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		calls[i].Add(1)
+		running.Add(-1)
+	})
+
+	for i := range calls {
+		assert.Equal(t, int32(1), calls[i].Load(), "index %d", i)
+	}
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	assert.Greater(t, peak.Load(), int32(1))
+}
+
+func TestRunParallel_StopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var started atomic.Int32
+
+	runParallel(ctx, 10, 2, func(i int) {
+		if started.Add(1) == 2 {
+			cancel()
+		}
+		<-ctx.Done()
+	})
+
+	assert.Equal(t, int32(2), started.Load(), "no databases should start after cancellation")
+}
+
 // Note: Full integration testing of main.go requires:
 // 1. A running database (postgres/mysql/mongodb)
 // 2. A real or mock S3/R2 endpoint
@@ -36,3 +190,239 @@ func TestMainPackageImports(t *testing.T) {
 // - internal/backup: 37.5% coverage (requires mocking exec.Command)
 // - internal/storage: 35.8% coverage (requires mocking S3 client)
 // - internal/notify: 95.4% coverage
+
+func TestCheckTools(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	problems := checkTools([]config.DatabaseConfig{
+		{Type: config.DatabaseTypePostgres, Name: "app"},
+		{Type: config.DatabaseTypePostgres, Name: "billing"},
+		{Type: config.DatabaseTypeMySQL, Name: "shop"},
+	})
+
+	require.Len(t, problems, 2)
+	assert.Equal(t, "PATH", problems[0].Field)
+	assert.Equal(t, "pg_dump not found, needed to back up app, billing", problems[0].Message)
+	assert.Equal(t, "mysqldump not found, needed to back up shop", problems[1].Message)
+}
+
+func TestPingStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg, db := newLocalTestConfig(t)
+	assert.NoError(t, pingStorage(context.Background(), cfg, db.BackupPrefix))
+}
+
+func TestApplyRetention_RequiresVerifiedBackup(t *testing.T) {
+	t.Parallel()
+
+	const dump = "-- MySQL dump 10.13\n\nCREATE TABLE t (id int);\n\n-- Dump completed on 2024-01-15 14:05:32\n"
+
+	tests := []struct {
+		name      string
+		newBackup string
+		remaining int
+	}{
+		{"verified backup prunes", dump, 1},
+		{"broken backup skips retention", dump[:20], 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			cfg, db := newLocalTestConfig(t)
+			db.Type = config.DatabaseTypeMySQL
+			cfg.RetentionCount = 1
+			backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+			require.NoError(t, err)
+
+			require.NoError(t, backend.Upload(ctx, "mysql-app-20240101-000000.sql", strings.NewReader(dump)))
+			require.NoError(t, backend.Upload(ctx, "mysql-app-20240102-000000.sql", strings.NewReader(tt.newBackup)))
+
+			summary := &notify.BackupSummary{}
+			m := &manifest.Manifest{Key: "backups/app/mysql-app-20240102-000000.sql"}
+			applyRetention(ctx, cfg, db, m, nil, summary, log.New(io.Discard, "", 0))
+
+			remaining, err := backend.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, remaining, tt.remaining)
+			assert.Equal(t, tt.remaining == 2, summary.RetentionSkipped != "")
+		})
+	}
+}
+
+func TestApplyBucketBudgets_OnlyVerifiedDatabases(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg, _ := newLocalTestConfig(t)
+	cfg.Databases = append(cfg.Databases, config.DatabaseConfig{
+		Type:         config.DatabaseTypePostgres,
+		Name:         "shop",
+		BackupPrefix: "backups/shop/",
+	})
+	cfg.RetentionBucketMaxSize = 1
+
+	bucket, err := storage.NewBackend(ctx, cfg, "")
+	require.NoError(t, err)
+	for _, key := range []string{
+		"backups/app/postgres-app-20240101-000000.dump",
+		"backups/app/postgres-app-20240102-000000.dump",
+		"backups/shop/postgres-shop-20240101-000000.dump",
+		"backups/shop/postgres-shop-20240102-000000.dump",
+	} {
+		require.NoError(t, bucket.Upload(ctx, key, strings.NewReader("x")))
+	}
+
+	applyBucketBudgets(ctx, cfg, []*notify.BackupSummary{
+		{Success: true},
+		{Success: true, RetentionSkipped: "new backup failed verification"},
+	})
+
+	remaining, err := bucket.List(ctx)
+	require.NoError(t, err)
+	var keys []string
+	for _, obj := range remaining {
+		keys = append(keys, obj.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		"backups/app/postgres-app-20240102-000000.dump",
+		"backups/shop/postgres-shop-20240101-000000.dump",
+		"backups/shop/postgres-shop-20240102-000000.dump",
+	}, keys)
+}
+
+func TestDiscardUploads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary, err := storage.NewLocalBackend(t.TempDir(), "backups/app/")
+	require.NoError(t, err)
+	replica, err := storage.NewLocalBackend(t.TempDir(), "backups/app/")
+	require.NoError(t, err)
+
+	// The replica received the backup, the primary didn't
+	const filename = "postgres-app-20240101-000000.dump"
+	require.NoError(t, replica.Upload(ctx, filename, strings.NewReader("x")))
+	destinations := []storage.Destination{
+		{Name: "local", Backend: primary, Required: true},
+		{Name: "replica", Backend: replica},
+	}
+	uploads := []storage.UploadResult{
+		{Destination: "local", Err: io.ErrUnexpectedEOF},
+		{Destination: "replica"},
+	}
+
+	var logs bytes.Buffer
+	discardUploads(ctx, destinations, uploads, "backups/app/"+filename, log.New(&logs, "", 0))
+
+	remaining, err := replica.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, remaining, "the orphaned copy is deleted")
+	assert.Contains(t, logs.String(), "Deleted incomplete backup backups/app/"+filename+" from replica storage")
+
+	// A copy that can't be deleted is only logged
+	logs.Reset()
+	discardUploads(ctx, destinations, uploads, "backups/app/"+filename, log.New(&logs, "", 0))
+	assert.Contains(t, logs.String(), "Warning: failed to delete incomplete backup")
+}
+
+func TestRekeyDatabase(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg, db := newLocalTestConfig(t)
+	db.Type = config.DatabaseTypeMySQL
+	const dump = "-- MySQL dump 10.13\n\nCREATE TABLE t (id int);\n\n-- Dump completed on 2024-01-15 14:05:32\n"
+	old := encrypt.Key{ID: "old", Secret: bytes.Repeat([]byte{1}, encrypt.KeySize)}
+	current := encrypt.Key{ID: "new", Secret: bytes.Repeat([]byte{2}, encrypt.KeySize)}
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	require.NoError(t, err)
+
+	// A backup encrypted with the old key, with its manifest
+	before, err := encrypt.NewKeyring([]encrypt.Key{old}, "")
+	require.NoError(t, err)
+	encryptor, err := before.Encryptor()
+	require.NoError(t, err)
+	encrypted, err := encryptor.Encrypt(strings.NewReader(dump))
+	require.NoError(t, err)
+	require.NoError(t, backend.Upload(ctx, "mysql-app-20240101-000000.sql.enc", encrypted))
+	var body bytes.Buffer
+	require.NoError(t, (&manifest.Manifest{
+		Version:    manifest.Version,
+		Key:        "backups/app/mysql-app-20240101-000000.sql.enc",
+		Encryption: &manifest.Encryption{Algorithm: encrypt.Algorithm, KeyID: "old"},
+	}).Encode(&body))
+	require.NoError(t, backend.Upload(ctx, manifest.Key("mysql-app-20240101-000000.sql.enc"), &body))
+
+	cfg.Keyring, err = encrypt.NewKeyring([]encrypt.Key{old, current}, "new")
+	require.NoError(t, err)
+	cfg.Signer, err = signing.NewSigner(bytes.Repeat([]byte{3}, 32))
+	require.NoError(t, err)
+	verifier, err := signing.NewVerifier(cfg.Signer.PublicKey())
+	require.NoError(t, err)
+	key := "backups/app/mysql-app-20240101-000000.sql.enc"
+
+	n, err := rekeyDatabase(ctx, cfg, db, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = rekeyDatabase(ctx, cfg, db, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// The backup now names the new key, decrypts with it alone, and its
+	// manifest matches the new object and is signed again
+	after, err := encrypt.NewKeyring([]encrypt.Key{current}, "")
+	require.NoError(t, err)
+	result, err := verify.Verify(ctx, backend, key, db.Type, encrypt.Keys{Keyring: after}, verifier)
+	require.NoError(t, err)
+	assert.True(t, result.Passed())
+
+	m, err := manifest.Fetch(ctx, backend, key)
+	require.NoError(t, err)
+	assert.Equal(t, "new", m.Encryption.KeyID)
+
+	// Nothing is left to re-encrypt
+	n, err = rekeyDatabase(ctx, cfg, db, false)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRekeyDatabase_KeyringToPassphrase(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cfg, db := newLocalTestConfig(t)
+	db.Type = config.DatabaseTypeMySQL
+	const dump = "-- MySQL dump 10.13\n\nCREATE TABLE t (id int);\n\n-- Dump completed on 2024-01-15 14:05:32\n"
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	require.NoError(t, err)
+
+	// A backup made with ENCRYPTION_KEY, before switching to a passphrase
+	cfg.Keyring, err = encrypt.NewKeyring([]encrypt.Key{{ID: "old", Secret: bytes.Repeat([]byte{1}, encrypt.KeySize)}}, "")
+	require.NoError(t, err)
+	encryptor, err := cfg.Keyring.Encryptor()
+	require.NoError(t, err)
+	encrypted, err := encryptor.Encrypt(strings.NewReader(dump))
+	require.NoError(t, err)
+	require.NoError(t, backend.Upload(ctx, "mysql-app-20240101-000000.sql.enc", encrypted))
+
+	cfg.Passphrase, err = encrypt.NewPassphraseWrapper("correct horse battery staple", encrypt.KDFParams{Algorithm: encrypt.KDFArgon2id, Time: 1, Memory: 64, Threads: 1})
+	require.NoError(t, err)
+
+	n, err := rekeyDatabase(ctx, cfg, db, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// The passphrase alone restores it now, and nothing is left to do
+	result, err := verify.Verify(ctx, backend, "backups/app/mysql-app-20240101-000000.sql.enc", db.Type, encrypt.Keys{Passphrase: cfg.Passphrase}, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Passed())
+
+	n, err = rekeyDatabase(ctx, cfg, db, false)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
+	"github.com/jorgepascosoto/auto-db-backups/internal/manifest"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+func runRekeyCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rekey", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Optional: re-encrypt only the specified database's backups")
+	dryRun := flags.Bool("dry-run", false, "Only report which backups would be re-encrypted")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	databases := cfg.Databases
+	if *databaseName != "" {
+		db, err := findDatabase(cfg, *databaseName)
+		if err != nil {
+			return err
+		}
+		databases = []config.DatabaseConfig{*db}
+	}
+
+	var rekeyed, failures int
+	for i := range databases {
+		db := &databases[i]
+		dbCfg := cfg.ForDatabase(db)
+		if target, err := dbCfg.EnvelopeWrapper(); err != nil || target == nil {
+			log.Printf("Skipping %s: no encryption keys or passphrase are configured", db.Name)
+			continue
+		}
+
+		for _, destination := range dbCfg.Destinations() {
+			n, err := rekeyDatabase(ctx, destination, db, *dryRun)
+			rekeyed += n
+			if err != nil {
+				log.Printf("Re-encryption failed for %s in %s storage: %v", db.Name, destination.StorageBackend, err)
+				failures++
+			}
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d backup(s) would be re-encrypted", rekeyed)
+	} else {
+		log.Printf("Re-encrypted %d backup(s)", rekeyed)
+	}
+	if failures > 0 {
+		return fmt.Errorf("re-encryption failed for %d database destination(s)", failures)
+	}
+	return nil
+}
+
+// rekeyDatabase re-encrypts every AES-encrypted backup of db that isn't
+// encrypted with the key new backups get, the passphrase if one is
+// configured or else the keyring's active key, returning how many it
+// re-encrypted (or would have, with dryRun). It carries on past a backup
+// that fails, and returns the first error. Backups encrypted to age
+// recipients are left alone: their private keys are never configured here.
+func rekeyDatabase(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig, dryRun bool) (int, error) {
+	target, err := cfg.EnvelopeWrapper()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	objects, err := backend.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var rekeyed int
+	var firstErr error
+	for _, obj := range objects {
+		info, err := backup.ParseKey(obj.Key)
+		if err != nil || !info.IsBackupOf(db) || !info.Encrypted {
+			continue
+		}
+		if algorithm, _ := encrypt.ByExtension(obj.Key); algorithm != encrypt.Algorithm {
+			continue
+		}
+
+		done, err := rekeyBackup(ctx, backend, cfg.DecryptionKeys(), target, cfg.Signer, obj.Key, dryRun)
+		if err != nil {
+			log.Printf("Failed to re-encrypt %s: %v", obj.Key, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if done {
+			rekeyed++
+		}
+	}
+	return rekeyed, firstErr
+}
+
+// rekeyBackup re-encrypts the backup at key with target, replacing the
+// object in place, and updates its manifest. It reports whether the backup
+// needed it. A backup with its own data key only has that rewrapped; older
+// backups are decrypted and encrypted again. Either way the new object is
+// streamed straight back into the upload, so a backup that fails to decrypt
+// is left as it was. The updated manifest is signed again by signer; without
+// one, its old signature no longer matches and is dropped.
+func rekeyBackup(ctx context.Context, backend storage.Backend, keys encrypt.Keys, target encrypt.KeyWrapper, signer *signing.Signer, key string, dryRun bool) (bool, error) {
+	body, err := backend.Download(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer body.Close()
+
+	r := bufio.NewReader(body)
+	keyID, err := encrypt.HeaderKeyID(r)
+	if err != nil {
+		return false, err
+	}
+	// Older backups may name the active key by its fingerprint
+	if keyID == target.KeyID() || (keys.Keyring != nil && keys.Keyring.Active().ID == target.KeyID() && keys.Keyring.IsActive(keyID)) {
+		return false, nil
+	}
+
+	from := keyID
+	if from == "" {
+		from = "unnamed key"
+	}
+	if dryRun {
+		log.Printf("Would re-encrypt %s (%s -> %s)", key, from, target.KeyID())
+		return true, nil
+	}
+
+	encrypted, err := keys.Rewrap(r, target)
+	switch {
+	case err == nil:
+		log.Printf("Rewrapping the data key of %s (%s -> %s)...", key, from, target.KeyID())
+	case stderrors.Is(err, encrypt.ErrNotEnvelope):
+		log.Printf("Re-encrypting %s (%s -> %s)...", key, from, target.KeyID())
+		decrypted, err := keys.Decrypt(r, encrypt.Algorithm)
+		if err != nil {
+			return false, fmt.Errorf("failed to decrypt backup: %w", err)
+		}
+		defer decrypted.Close()
+
+		reencrypted, err := encrypt.NewEnvelopeEncryptor(target).Encrypt(decrypted)
+		if err != nil {
+			return false, fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+		defer reencrypted.Close()
+		encrypted = reencrypted
+	default:
+		return false, fmt.Errorf("failed to rewrap data key: %w", err)
+	}
+
+	hash := sha256.New()
+	counter := backup.NewCountingReader(io.TeeReader(encrypted, hash))
+	if err := backend.Upload(ctx, strings.TrimPrefix(key, backend.Prefix()), counter); err != nil {
+		return false, fmt.Errorf("failed to upload re-encrypted backup: %w", err)
+	}
+
+	// The stored object changed, so the manifest's size and checksum did too
+	m, err := manifest.Fetch(ctx, backend, key)
+	if err != nil {
+		log.Printf("Warning: failed to update manifest of %s: %v", key, err)
+		return true, nil
+	}
+	if m == nil {
+		// Made before manifests existed
+		return true, nil
+	}
+	m.StoredSize = counter.Count()
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	m.Encryption = &manifest.Encryption{Algorithm: encrypt.Algorithm, KeyID: target.KeyID()}
+	if signer != nil {
+		signer.Sign(m)
+	} else if m.Signature != nil {
+		log.Printf("Warning: dropping the signature of %s's manifest, no SIGNING_KEY is configured to sign it again", key)
+		m.Signature = nil
+	}
+
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		log.Printf("Warning: failed to encode manifest of %s: %v", key, err)
+	} else if err := backend.Upload(ctx, strings.TrimPrefix(manifest.Key(key), backend.Prefix()), &buf); err != nil {
+		log.Printf("Warning: failed to upload manifest of %s: %v", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/restore"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+func runRestoreCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Name of the configured database whose backup to restore (required)")
+	key := flags.String("key", "", "Object key (or file name within the database's prefix) of the backup to restore")
+	latest := flags.Bool("latest", false, "Restore the most recent backup")
+	target := flags.String("target", "", "Connection string of the database to restore into (required)")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	if *databaseName == "" {
+		return fmt.Errorf("--database is required")
+	}
+	if *target == "" {
+		return fmt.Errorf("--target is required")
+	}
+	if (*key == "") == !*latest {
+		return fmt.Errorf("exactly one of --key or --latest is required")
+	}
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := findDatabase(cfg, *databaseName)
+	if err != nil {
+		return err
+	}
+	cfg = cfg.ForDatabase(db)
+
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	backupKey := *key
+	if *latest {
+		backupKey, err = latestBackupKey(ctx, backend, db)
+		if err != nil {
+			return err
+		}
+	} else if !strings.Contains(backupKey, "/") {
+		// A bare file name refers to the database's own prefix
+		backupKey = db.BackupPrefix + backupKey
+	}
+
+	targetDB, err := config.NewDatabaseConfig(*target, db.Type)
+	if err != nil {
+		return fmt.Errorf("invalid --target: %w", err)
+	}
+
+	importer, err := restore.NewImporter(targetDB)
+	if err != nil {
+		return fmt.Errorf("failed to create importer: %w", err)
+	}
+
+	startTime := time.Now()
+	log.Printf("Restoring %s into %s database %s...", backupKey, db.Type, targetDB.Name)
+
+	reader, err := restore.Open(ctx, backend, backupKey, cfg.DecryptionKeys())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := importer.Import(ctx, reader); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	log.Printf("Restore completed in %s", time.Since(startTime).Round(time.Second))
+	return nil
+}
+
+// latestBackupKey returns the key of the newest backup of db, going by the
+// timestamp in its name: rewriting a backup, e.g. with rekey, makes it the
+// most recently modified object without making it the newest backup
+func latestBackupKey(ctx context.Context, backend storage.Backend, db *config.DatabaseConfig) (string, error) {
+	objects, err := backend.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, obj := range objects {
+		// Skip anything that isn't one of this database's backups
+		info, err := backup.ParseKey(obj.Key)
+		if err != nil || !info.IsBackupOf(db) {
+			continue
+		}
+		if latest == "" || info.Timestamp.After(latestTime) {
+			latest, latestTime = obj.Key, info.Timestamp
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("no backups found for database '%s' under %s", db.Name, db.BackupPrefix)
+	}
+	return latest, nil
+}
@@ -3,12 +3,12 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/encrypt"
 )
 
 func main() {
@@ -30,8 +30,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	if len(key) != 32 {
-		fmt.Fprintf(os.Stderr, "Key must be 32 bytes, got %d\n", len(key))
+	// Handles both the chunked stream format and the legacy single-GCM format
+	decryptor, err := encrypt.NewAESEncryptor(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid key: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -42,39 +44,12 @@ func main() {
 	}
 	defer inputFile.Close()
 
-	// Read all encrypted data
-	encryptedData, err := io.ReadAll(inputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
-		os.Exit(1)
-	}
-
-	// AES-256-GCM: first 12 bytes are nonce
-	if len(encryptedData) < 12 {
-		fmt.Fprintln(os.Stderr, "Encrypted data too short")
-		os.Exit(1)
-	}
-
-	nonce := encryptedData[:12]
-	ciphertext := encryptedData[12:]
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create cipher: %v\n", err)
-		os.Exit(1)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create GCM: %v\n", err)
-		os.Exit(1)
-	}
-
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := decryptor.Decrypt(inputFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to decrypt: %v\n", err)
 		os.Exit(1)
 	}
+	defer plaintext.Close()
 
 	outputFile, err := os.Create(os.Args[2])
 	if err != nil {
@@ -83,8 +58,12 @@ func main() {
 	}
 	defer outputFile.Close()
 
-	if _, err := outputFile.Write(plaintext); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+	// Chunks are authenticated before being written, but a failure part way
+	// through still leaves a partial file behind, so remove it
+	if _, err := io.Copy(outputFile, plaintext); err != nil {
+		outputFile.Close()
+		os.Remove(os.Args[2])
+		fmt.Fprintf(os.Stderr, "Failed to decrypt: %v\n", err)
 		os.Exit(1)
 	}
 
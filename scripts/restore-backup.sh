@@ -38,10 +38,13 @@ TEMP_DIR=$(mktemp -d)
 trap "rm -rf $TEMP_DIR" EXIT
 
 echo "==> Decrypting backup..."
-go run "$PROJECT_ROOT/scripts/decrypt-backup.go" "$BACKUP_FILE" "$TEMP_DIR/backup.dump.gz"
+go run "$PROJECT_ROOT/scripts/decrypt-backup.go" "$BACKUP_FILE" "$TEMP_DIR/backup.dump.compressed"
 
 echo "==> Decompressing backup..."
-gunzip -c "$TEMP_DIR/backup.dump.gz" > "$TEMP_DIR/backup.dump"
+case "$BACKUP_FILE" in
+    *.zst.enc) zstd -dc "$TEMP_DIR/backup.dump.compressed" > "$TEMP_DIR/backup.dump" ;;
+    *)         gunzip -c "$TEMP_DIR/backup.dump.compressed" > "$TEMP_DIR/backup.dump" ;;
+esac
 
 echo "==> Creating database '$DB_NAME'..."
 createdb "$DB_NAME" 2>/dev/null || echo "Database already exists, will restore into it"
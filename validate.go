@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/backup"
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/drill"
+	"github.com/jorgepascosoto/auto-db-backups/internal/errors"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+)
+
+// connectTimeout bounds each connectivity check of `validate --connect`
+const connectTimeout = 30 * time.Second
+
+// probeKey is looked up, and expected to be missing, to check a storage
+// destination can be reached
+const probeKey = ".auto-db-backups-validate"
+
+func runValidateCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := addConfigFlag(flags)
+	connect := flags.Bool("connect", false, "Also connect to each database and its storage destination")
+	flags.Parse(args)
+
+	cfg, problems := config.Inspect(*configPath)
+	if cfg != nil {
+		problems = append(problems, checkTools(cfg.Databases)...)
+		if *connect {
+			problems = append(problems, checkConnectivity(ctx, cfg)...)
+		}
+	}
+
+	if len(problems) == 0 {
+		log.Printf("Configuration is valid (%d database(s))", len(cfg.Databases))
+		return nil
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stdout, "%s: %s\n", problem.Field, problem.Message)
+	}
+	return fmt.Errorf("configuration has %d problem(s)", len(problems))
+}
+
+// checkTools reports dump tools the configured databases need that aren't
+// on PATH
+func checkTools(databases []config.DatabaseConfig) config.Problems {
+	var tools []string
+	users := make(map[string][]string)
+	for _, db := range databases {
+		for _, tool := range backup.RequiredTools(db.Type) {
+			if _, ok := users[tool]; !ok {
+				tools = append(tools, tool)
+			}
+			users[tool] = append(users[tool], db.Name)
+		}
+	}
+
+	var problems config.Problems
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			problems.Add("PATH", "%s not found, needed to back up %s", tool, strings.Join(users[tool], ", "))
+		}
+	}
+	return problems
+}
+
+// checkConnectivity connects to each database and looks up a missing object
+// in each of its storage destinations
+func checkConnectivity(ctx context.Context, cfg *config.Config) config.Problems {
+	var problems config.Problems
+	for i := range cfg.Databases {
+		db := &cfg.Databases[i]
+
+		log.Printf("Connecting to %s...", db.Name)
+		if err := pingDatabase(ctx, db); err != nil {
+			problems.Add(config.DatabaseField(i, "connection"), "cannot connect: %v", err)
+		}
+		for _, destination := range cfg.ForDatabase(db).Destinations() {
+			if err := pingStorage(ctx, destination, db.BackupPrefix); err != nil {
+				problems.Add(config.DatabaseField(i, "storage"), "cannot reach %s storage: %v", destination.StorageBackend, err)
+			}
+		}
+	}
+	return problems
+}
+
+// pingDatabase runs a trivial query with the same client tools drills use
+func pingDatabase(ctx context.Context, db *config.DatabaseConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	server, err := drill.NewScratchServer(db)
+	if err != nil {
+		return err
+	}
+
+	query := "SELECT 1"
+	if db.Type == config.DatabaseTypeMongoDB {
+		query = "db.runCommand({ping: 1}).ok"
+	}
+	_, err = server.Query(ctx, db, query)
+	return err
+}
+
+func pingStorage(ctx context.Context, cfg *config.Config, prefix string) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	backend, err := storage.NewBackend(ctx, cfg, prefix)
+	if err != nil {
+		return err
+	}
+
+	// Reaching the destination and being told the object doesn't exist
+	// proves the credentials and bucket work
+	_, err = backend.Stat(ctx, prefix+probeKey)
+	if err == nil || stderrors.Is(err, errors.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jorgepascosoto/auto-db-backups/internal/config"
+	"github.com/jorgepascosoto/auto-db-backups/internal/notify"
+	"github.com/jorgepascosoto/auto-db-backups/internal/signing"
+	"github.com/jorgepascosoto/auto-db-backups/internal/storage"
+	"github.com/jorgepascosoto/auto-db-backups/internal/verify"
+)
+
+func runVerifyCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	databaseName := flags.String("database", "", "Name of a specific database to verify (verifies all if not specified)")
+	key := flags.String("key", "", "Object key (or file name within the database's prefix) of the backup to verify; defaults to the latest backup (requires --database)")
+	checkSignature := flags.Bool("signature", false, "Also require a valid manifest signature by one of SIGNING_PUBLIC_KEYS")
+	configPath := addConfigFlag(flags)
+	flags.Parse(args)
+
+	if *key != "" && *databaseName == "" {
+		return fmt.Errorf("--key requires --database")
+	}
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if *checkSignature && cfg.SignatureVerifier == nil {
+		return fmt.Errorf("--signature requires SIGNING_PUBLIC_KEYS or SIGNING_KEY")
+	}
+
+	databases := cfg.Databases
+	if *databaseName != "" {
+		db, err := findDatabase(cfg, *databaseName)
+		if err != nil {
+			return err
+		}
+		databases = []config.DatabaseConfig{*db}
+	}
+
+	var failures int
+	for i := range databases {
+		db := &databases[i]
+
+		summary := verifyDatabase(ctx, cfg, db, *key, *checkSignature)
+		if summary.Success {
+			log.Printf("Verified %s in %s", summary.BackupKey, summary.Duration.Round(time.Second))
+		} else {
+			log.Printf("Verification failed for %s: %v", db.Name, summary.Error)
+			failures++
+		}
+
+		if err := sendCheckNotifications(ctx, cfg.ForDatabase(db), summary); err != nil {
+			log.Printf("Warning: failed to send notifications: %v", err)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("verification failed for %d of %d database(s)", failures, len(databases))
+	}
+
+	return nil
+}
+
+// verifyDatabase verifies the backup at key, or the latest backup of db when
+// key is empty, checking its manifest signature too when checkSignature is
+// set
+func verifyDatabase(ctx context.Context, cfg *config.Config, db *config.DatabaseConfig, key string, checkSignature bool) *notify.CheckSummary {
+	cfg = cfg.ForDatabase(db)
+	startTime := time.Now()
+	summary := &notify.CheckSummary{
+		Kind:         "verify",
+		DatabaseType: string(db.Type),
+		DatabaseName: db.Name,
+	}
+	defer func() {
+		summary.Duration = time.Since(startTime)
+	}()
+
+	backend, err := storage.NewBackend(ctx, cfg, db.BackupPrefix)
+	if err != nil {
+		summary.Error = fmt.Errorf("failed to create storage client: %w", err)
+		return summary
+	}
+
+	if key == "" {
+		key, err = latestBackupKey(ctx, backend, db)
+		if err != nil {
+			summary.Error = err
+			return summary
+		}
+	} else if !strings.Contains(key, "/") {
+		// A bare file name refers to the database's own prefix
+		key = db.BackupPrefix + key
+	}
+	summary.BackupKey = key
+
+	log.Printf("Verifying %s...", key)
+	var signatures *signing.Verifier
+	if checkSignature {
+		signatures = cfg.SignatureVerifier
+	}
+	result, err := verify.Verify(ctx, backend, key, db.Type, cfg.DecryptionKeys(), signatures)
+	summary.Checks = checkResults(result.Checks)
+
+	summary.Success = err == nil
+	summary.Error = err
+	return summary
+}
+
+// checkResults logs checks and converts them for notifications
+func checkResults(checks []verify.Check) []notify.CheckResult {
+	results := make([]notify.CheckResult, 0, len(checks))
+	for _, check := range checks {
+		log.Printf("  %-13s %-7s %s", check.Name, check.Status, check.Detail)
+		results = append(results, notify.CheckResult{
+			Name:   check.Name,
+			Status: notify.CheckStatus(check.Status),
+			Detail: check.Detail,
+		})
+	}
+	return results
+}
+
+func sendCheckNotifications(ctx context.Context, cfg *config.Config, summary *notify.CheckSummary) error {
+	if err := notify.WriteGitHubCheckSummary(summary); err != nil {
+		log.Printf("Warning: failed to write GitHub summary: %v", err)
+	}
+
+	if cfg.WebhookURL != "" {
+		shouldNotify := (summary.Success && cfg.NotifyOnSuccess) || (!summary.Success && cfg.NotifyOnFailure)
+		if shouldNotify {
+			notifier := notify.NewWebhookNotifier(cfg.WebhookURL)
+			if err := notifier.NotifyCheck(ctx, summary); err != nil {
+				return fmt.Errorf("webhook notification failed: %w", err)
+			}
+		}
+	}
+
+	return nil
+}